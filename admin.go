@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vipnode/vipnode/v2/internal/pretty"
+	"github.com/vipnode/vipnode/v2/request"
+)
+
+// runAdmin sends a signed request for the admin subcommand to the pool, and
+// prints the result.
+func runAdmin(options Options, cmd string) error {
+	privkey, err := crypto.LoadECDSA(options.Admin.Key)
+	if err != nil {
+		return ErrExplain{err, "Failed to load the operator private key. Use --key to specify the path to a hex-encoded private key."}
+	}
+	service, err := poolHTTPService(options.Admin.Pool)
+	if err != nil {
+		return err
+	}
+
+	var method string
+	var args []interface{}
+	switch cmd {
+	case "nodes":
+		method = "admin_nodes"
+	case "node":
+		method = "admin_node"
+		args = append(args, options.Admin.Node.Args.NodeID)
+	case "kick":
+		method = "admin_kick"
+		args = append(args, options.Admin.Kick.Args.NodeID)
+	case "ban":
+		method = "admin_ban"
+		args = append(args, options.Admin.Ban.Args.Target, options.Admin.Ban.Args.Reason, options.Admin.Ban.Duration)
+	case "unban":
+		method = "admin_unban"
+		args = append(args, options.Admin.Unban.Args.Target)
+	case "bans":
+		method = "admin_bans"
+	case "allow":
+		method = "admin_allow"
+		args = append(args, options.Admin.Allow.Args.Target, options.Admin.Allow.Args.Reason, options.Admin.Allow.Duration)
+	case "disallow":
+		method = "admin_disallow"
+		args = append(args, options.Admin.Disallow.Args.Target)
+	case "allowed":
+		method = "admin_allowed"
+	case "credit":
+		amount, err := pretty.ParseEther(options.Admin.Credit.Args.Amount)
+		if err != nil {
+			return err
+		}
+		method = "admin_adjustBalance"
+		args = append(args, options.Admin.Credit.Args.Target, amount.String(), options.Admin.Credit.Args.Reason)
+	case "federation":
+		method = "admin_federation"
+	case "maintenance":
+		method = "admin_setMaintenance"
+		args = append(args, options.Admin.Maintenance.Args.State == "on")
+	default:
+		return fmt.Errorf("unknown admin command: %q", cmd)
+	}
+
+	req := request.AddressRequest{
+		Method:    method,
+		Address:   crypto.PubkeyToAddress(privkey.PublicKey).Hex(),
+		Nonce:     time.Now().UnixNano(),
+		ExtraArgs: args,
+	}
+	signedArgs, err := req.SignedArgs(privkey)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	var result json.RawMessage
+	if err := service.Call(ctx, &result, method, signedArgs...); err != nil {
+		return err
+	}
+	if len(result) == 0 || string(result) == "null" {
+		fmt.Fprintf(os.Stderr, "%s: ok\n", method)
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, result, "", "  "); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
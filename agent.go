@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/discv5"
@@ -23,6 +24,8 @@ var minUpdateInterval = time.Second * 5
 var maxUpdateInterval = store.ExpireInterval
 var maxBlockNumberDrift uint64 = 3
 var defaultPoolURI string = "wss://pool.vipnode.org/"
+var reconnectMinBackoff = time.Second * 2
+var reconnectMaxBackoff = time.Minute * 5
 
 // runAgent configures and starts a the agent. It blocks until the agent is
 // stopped or fails. runAgent also takes care of wrapping known arounds with
@@ -54,7 +57,7 @@ type agentRunner struct {
 	Agent         *agent.Agent
 	PrivateKey    *ecdsa.PrivateKey
 	RemotePool    pool.Pool
-	RemoteService *jsonrpc2.Remote
+	RemoteService *jsonrpc2.ReconnectingRemote
 	pool          *pool.VipnodePool // Only exists in :memory: mode:w
 }
 
@@ -110,6 +113,7 @@ func (runner *agentRunner) LoadAgent(options Options) error {
 		UpdateInterval: updateInterval,
 		NumHosts:       options.Agent.MinPeers,
 		StrictPeers:    options.Agent.StrictPeers,
+		MaxClients:     options.Agent.MaxClients,
 	}
 	runner.Agent = a
 	if options.Agent.NodeURI != "" {
@@ -154,6 +158,19 @@ func (runner *agentRunner) LoadAgent(options Options) error {
 			drifting = false
 		}
 	}
+
+	forked := false
+	a.BlockHashCallback = func(blockNumber uint64, blockHash string, poolBlockHash string) {
+		if !strings.EqualFold(blockHash, poolBlockHash) {
+			if !forked {
+				logger.Warningf("Local node may be on a fork, its block %d hash %s does not match the majority of pool hosts: %s", blockNumber, blockHash, poolBlockHash)
+				forked = true
+			}
+		} else if forked {
+			logger.Infof("Local node agrees with the majority of pool hosts on block %d hash: %s", blockNumber, blockHash)
+			forked = false
+		}
+	}
 	return nil
 }
 
@@ -212,19 +229,38 @@ func (runner *agentRunner) LoadPool(options Options) error {
 		if err := rpcServer.RegisterMethod("vipnode_whitelist", reverseService, "Whitelist"); err != nil {
 			return err
 		}
+		if err := rpcServer.RegisterMethod("vipnode_shutdown", reverseService, "Shutdown"); err != nil {
+			return err
+		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
-		poolCodec, err := ws.WebSocketDial(ctx, uri.String())
-		cancel()
-		if err != nil {
-			return ErrExplainRetry{ErrExplain{err, fmt.Sprintf("Failed to connect to the pool RPC API: %q", uri.String())}}
+		poolURI := uri.String()
+		rpcPool := &jsonrpc2.ReconnectingRemote{
+			Dial: func(ctx context.Context) (jsonrpc2.Codec, error) {
+				ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+				defer cancel()
+				return ws.WebSocketDial(ctx, poolURI)
+			},
+			Server:     rpcServer,
+			MinBackoff: reconnectMinBackoff,
+			MaxBackoff: reconnectMaxBackoff,
+			OnReconnect: func() {
+				logger.Warningf("Reconnected to the pool after the connection was lost: %s", poolURI)
+				ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+				defer cancel()
+				if err := runner.Agent.Reconnect(ctx); err != nil {
+					logger.Errorf("Failed to register with the pool after reconnecting: %s", err)
+				}
+			},
+		}
+		if err := rpcPool.Connect(context.Background()); err != nil {
+			return ErrExplainRetry{ErrExplain{err, fmt.Sprintf("Failed to connect to the pool RPC API: %q", poolURI)}}
 		}
 
-		rpcPool := &jsonrpc2.Remote{
-			Server: rpcServer,
-			Client: &jsonrpc2.Client{},
-			Codec:  poolCodec,
+		runner.Agent.ShutdownCallback = func(reconnectDelay time.Duration) {
+			logger.Warningf("Pool is shutting down, reconnecting in %s: %s", reconnectDelay, poolURI)
+			rpcPool.DelayReconnect(reconnectDelay)
 		}
+
 		runner.RemotePool = pool.Remote(rpcPool, runner.PrivateKey)
 		runner.RemoteService = rpcPool
 	case "http", "https":
@@ -268,13 +304,15 @@ func (runner *agentRunner) Run() error {
 		}
 	}()
 
-	errChan := make(chan error)
+	errChan := make(chan error, 2)
 	if runner.RemoteService != nil {
 		// RemoteService must be serving before we Start the agent, in case the
-		// Pool requires us to whitelist hosts on connect.
+		// Pool requires us to whitelist hosts on connect. It reconnects
+		// automatically until it is closed.
 		go func() {
 			errChan <- runner.RemoteService.Serve()
 		}()
+		defer runner.RemoteService.Close()
 	}
 
 	if err := runner.Agent.Start(runner.RemotePool); err != nil {
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -57,6 +56,18 @@ type Agent struct {
 	// number and the latest block number that the pool knows about.
 	BlockNumberCallback func(nodeBlockNumber uint64, poolBlockNumber uint64)
 
+	// BlockHashCallback is called every update that the pool knows which
+	// block hash the majority of its hosts have for the agent node's block
+	// at pool.ForkCheckpoint. If the hashes are different, then the node is
+	// on a fork.
+	// (Optional)
+	BlockHashCallback func(blockNumber uint64, nodeBlockHash string, poolBlockHash string)
+
+	// ShutdownCallback is called when the pool announces that it's shutting
+	// down, with the delay it suggests before reconnecting. It can be used to
+	// postpone reconnecting to the pool. (Optional)
+	ShutdownCallback func(reconnectDelay time.Duration)
+
 	// NumHosts is the minimum number of vipnode hosts the client should
 	// maintain connections with. (Optional)
 	NumHosts int
@@ -65,6 +76,11 @@ type Agent struct {
 	// (Optional)
 	Payout string
 
+	// MaxClients is the number of vipnode clients a host is willing to serve,
+	// or 0 for no limit. Use SetMaxClients to change it after the agent has
+	// started. (Optional)
+	MaxClients int
+
 	// UpdateInterval is the time between updates sent to the pool. If not set,
 	// then store.KeepaliveInterval is used.
 	UpdateInterval time.Duration
@@ -83,6 +99,13 @@ type Agent struct {
 	stopCh   chan struct{}
 	waitCh   chan error
 	nodeInfo ethnode.UserAgent // cached during Start
+	nodeCaps []string          // cached during Start
+	genesis  string            // cached during Start
+	pool     pool.Pool         // set during Start
+
+	// candidates are the node IDs of peers received from the pool since the
+	// last update, which are reported as failed if we didn't connect to them.
+	candidates map[string]struct{}
 }
 
 func (a *Agent) init() {
@@ -115,6 +138,28 @@ func (a *Agent) Start(p pool.Pool) error {
 	ua := a.EthNode.UserAgent()
 	logger.Printf("Connected to local %s node: %s", ua.KindType(), enode)
 
+	a.nodeInfo = ua
+	a.nodeCaps = a.caps(startCtx)
+	if a.genesis, err = a.EthNode.BlockHash(startCtx, 0); err != nil {
+		// Not fatal, the pool skips checking the genesis block
+		logger.Printf("Failed to get node genesis block: %s", err)
+	}
+	if err := a.register(startCtx, p); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.pool = p
+	a.mu.Unlock()
+
+	go func() {
+		a.waitCh <- a.serveUpdates(p)
+	}()
+	return nil
+}
+
+// register sends a connect request to the pool and an initial peer update.
+func (a *Agent) register(ctx context.Context, p pool.Pool) error {
 	version := a.Version
 	if version == "" {
 		version = "dev"
@@ -124,10 +169,12 @@ func (a *Agent) Start(p pool.Pool) error {
 		Payout:         a.Payout,
 		NodeURI:        a.NodeURI,
 		VipnodeVersion: version,
-		NodeInfo:       ua,
+		NodeInfo:       a.nodeInfo,
+		Caps:           a.nodeCaps,
+		MaxClients:     a.maxClients(),
+		GenesisHash:    a.genesis,
 	}
-	a.nodeInfo = connectReq.NodeInfo
-	resp, err := p.Connect(startCtx, connectReq)
+	resp, err := p.Connect(ctx, connectReq)
 	if err != nil {
 		return AgentPoolError{err, "Failed during pool connect request"}
 	}
@@ -137,14 +184,66 @@ func (a *Agent) Start(p pool.Pool) error {
 		a.PoolMessageCallback(resp.Message)
 	}
 
-	if err := a.UpdatePeers(startCtx, p); err != nil {
-		return err
+	return a.UpdatePeers(ctx, p)
+}
+
+// caps returns the sub-protocols that the node supports. Protocols that the
+// node reports without versions are included unless a versioned capability
+// for the same protocol is already known.
+func (a *Agent) caps(ctx context.Context) []string {
+	caps := a.nodeInfo.Caps()
+	withCaps, ok := a.EthNode.(interface {
+		Caps(context.Context) ([]string, error)
+	})
+	if !ok {
+		return caps
+	}
+	names, err := withCaps.Caps(ctx)
+	if err != nil {
+		logger.Printf("Failed to get node capabilities: %s", err)
+		return caps
+	}
+	known := make(map[string]struct{}, len(caps))
+	for _, s := range caps {
+		if c, err := ethnode.ParseCapability(s); err == nil {
+			known[c.Name] = struct{}{}
+		}
 	}
+	for _, name := range names {
+		if _, ok := known[name]; !ok {
+			caps = append(caps, name)
+		}
+	}
+	return caps
+}
 
-	go func() {
-		a.waitCh <- a.serveUpdates(p)
-	}()
-	return nil
+// SetMaxClients changes the number of vipnode clients a host is willing to
+// serve, which is sent to the pool with the next update.
+func (a *Agent) SetMaxClients(maxClients int) {
+	a.mu.Lock()
+	a.MaxClients = maxClients
+	a.mu.Unlock()
+}
+
+func (a *Agent) maxClients() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.MaxClients
+}
+
+// Reconnect registers the node with the pool again, for when the connection
+// to the pool was re-established after the agent was started. The pool
+// forgets about the node's connection when it is dropped, but the agent and
+// its node keep running in the meantime.
+func (a *Agent) Reconnect(ctx context.Context) error {
+	a.mu.Lock()
+	p := a.pool
+	a.mu.Unlock()
+	if p == nil {
+		return errors.New("agent must be started before reconnecting")
+	}
+	logger.Printf("Reconnected to pool, registering again.")
+	return a.register(ctx, p)
 }
 
 // Whitelist a peer for this node.
@@ -153,6 +252,17 @@ func (a *Agent) Whitelist(ctx context.Context, nodeID string) error {
 	return a.EthNode.AddTrustedPeer(ctx, nodeID)
 }
 
+// Shutdown is called by the pool before it shuts down, with a suggested delay
+// before reconnecting.
+func (a *Agent) Shutdown(ctx context.Context, notice pool.ShutdownNotice) error {
+	delay := time.Duration(notice.ReconnectDelay) * time.Millisecond
+	logger.Printf("Pool is shutting down, suggested reconnect delay: %s", delay)
+	if a.ShutdownCallback != nil {
+		a.ShutdownCallback(delay)
+	}
+	return nil
+}
+
 // Stop shuts down all the active connections cleanly.
 func (a *Agent) Stop() {
 	a.init()
@@ -176,7 +286,12 @@ func (a *Agent) serveUpdates(p pool.Pool) error {
 	for {
 		select {
 		case <-ticker:
-			if err := a.UpdatePeers(context.Background(), p); err != nil {
+			err := a.UpdatePeers(context.Background(), p)
+			if poolErr, ok := err.(AgentPoolError); ok && poolErr.Cause() == jsonrpc2.ErrConnectionClosed {
+				// The pool connection is being re-established, we'll
+				// register again once it's back.
+				logger.Printf("Skipping update while disconnected from pool: %s", err)
+			} else if err != nil {
 				return err
 			}
 		case <-a.stopCh:
@@ -221,9 +336,33 @@ func (a *Agent) UpdatePeers(ctx context.Context, p pool.Pool) error {
 		return err
 	}
 
+	// Report the hash of a block that's deep enough to not be reorged
+	var blockHash string
+	blockHashNumber := pool.ForkCheckpoint(blockNumber)
+	if blockHashNumber > 0 {
+		blockHash, err = a.EthNode.BlockHash(ctx, blockHashNumber)
+		if err != nil {
+			// Not fatal, the pool skips checking for forks
+			logger.Printf("Failed to get node block hash: %s", err)
+		}
+	}
+
+	syncing, err := a.EthNode.Syncing(ctx)
+	if err != nil {
+		// Not fatal, the pool treats the node as synced
+		logger.Printf("Failed to get node sync progress: %s", err)
+	} else if syncing != nil {
+		logger.Printf("Local node is still syncing: block=%d highest=%d", syncing.CurrentBlock, syncing.HighestBlock)
+	}
+
 	update, err := p.Update(ctx, pool.UpdateRequest{
-		PeerInfo:    peers,
-		BlockNumber: blockNumber,
+		PeerInfo:        peers,
+		BlockNumber:     blockNumber,
+		BlockHash:       blockHash,
+		BlockHashNumber: blockHashNumber,
+		FailedPeers:     a.failedCandidates(peers),
+		MaxClients:      a.maxClients(),
+		Syncing:         syncing,
 	})
 	if err != nil {
 		return AgentPoolError{err, "Failed during pool update request"}
@@ -294,6 +433,9 @@ func (a *Agent) UpdatePeers(ctx context.Context, p pool.Pool) error {
 	if a.BlockNumberCallback != nil {
 		a.BlockNumberCallback(blockNumber, update.LatestBlockNumber)
 	}
+	if a.BlockHashCallback != nil && blockHash != "" && update.BlockHash != "" {
+		a.BlockHashCallback(blockHashNumber, blockHash, update.BlockHash)
+	}
 
 	if len(errors) > 0 {
 		return fmt.Errorf("failed to disconnect from invalid peers: %q", errors)
@@ -302,35 +444,64 @@ func (a *Agent) UpdatePeers(ctx context.Context, p pool.Pool) error {
 	return nil
 }
 
+// failedCandidates returns the peers received from the pool since the last
+// update that the node is not connected to, and resets the candidates.
+func (a *Agent) failedCandidates(peers []ethnode.PeerInfo) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.candidates) == 0 {
+		return nil
+	}
+	for _, peerID := range ethnode.Peers(peers).IDs() {
+		delete(a.candidates, peerID)
+	}
+	failed := make([]string, 0, len(a.candidates))
+	for peerID := range a.candidates {
+		failed = append(failed, peerID)
+	}
+	a.candidates = nil
+	return failed
+}
+
 // AddPeers requests num peers from the pool and connects the node to them.
 func (a *Agent) AddPeers(ctx context.Context, p pool.Pool, num int) error {
 	kind := "" // Any kind of node by default
+	var protocols []string
 	if !a.nodeInfo.IsFullNode {
-		// Non-full-nodes need nodes of the same kind to peer with (light nodes)
+		// Non-full-nodes need hosts that serve their light protocol. Older
+		// pools only support matching by the same kind.
 		kind = a.nodeInfo.Kind.String()
+		protocols = a.nodeInfo.Caps()
 	}
 
-	logger.Printf("Requesting more kind=%q peers from pool: %d", kind, num)
+	logger.Printf("Requesting more kind=%q protocols=%q peers from pool: %d", kind, protocols, num)
 	peerResp, err := p.Peer(ctx, pool.PeerRequest{
-		Num:  num,
-		Kind: kind,
+		Num:       num,
+		Kind:      kind,
+		Protocols: protocols,
 	})
-	if err != nil && jsonrpc2.IsErrorCode(err, jsonrpc2.ErrCodeInternal) {
-		if strings.HasPrefix(err.Error(), "no available") {
-			return ErrNoPeers
-		} else {
-			// This can happen if there are some incompatible agents on the
-			// pool (e.g. outdated broken vipnode version)
-			logger.Printf("AddPeers RPC failed (possibly due to outdated agents on the pool): %s", err)
-			// We can't recover on this end. This should also yield errors on
-			// the broken agents' side so hopefully they'll update soon.
-			return ErrNoPeers
-		}
+	if _, ok := err.(pool.NoHostNodesError); ok {
+		return ErrNoPeers
+	} else if err != nil && jsonrpc2.IsErrorCode(err, jsonrpc2.ErrCodeInternal) {
+		// This can happen if there are some incompatible agents on the
+		// pool (e.g. outdated broken vipnode version)
+		logger.Printf("AddPeers RPC failed (possibly due to outdated agents on the pool): %s", err)
+		// We can't recover on this end. This should also yield errors on
+		// the broken agents' side so hopefully they'll update soon.
+		return ErrNoPeers
 	} else if err != nil {
 		return AgentPoolError{err, "Failed during pool peer request"}
 	}
 	nodes := peerResp.Peers
 	logger.Printf("Received %d peer candidates from pool.", len(nodes))
+	a.mu.Lock()
+	if a.candidates == nil {
+		a.candidates = make(map[string]struct{}, len(nodes))
+	}
+	for _, node := range nodes {
+		a.candidates[string(node.ID)] = struct{}{}
+	}
+	a.mu.Unlock()
 	for _, node := range nodes {
 		if err := a.EthNode.ConnectPeer(ctx, node.URI); err != nil {
 			return err
@@ -342,4 +513,5 @@ func (a *Agent) AddPeers(ctx context.Context, p pool.Pool, num int) error {
 // Service is the set of RPC calls exposed by an agent.
 type Service interface {
 	Whitelist(ctx context.Context, nodeID string) error
+	Shutdown(ctx context.Context, notice pool.ShutdownNotice) error
 }
@@ -5,9 +5,11 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/vipnode/vipnode/v2/ethnode"
 	"github.com/vipnode/vipnode/v2/internal/fakenode"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
 	"github.com/vipnode/vipnode/v2/pool"
 )
 
@@ -144,3 +146,33 @@ func TestAgentStrictPeers(t *testing.T) {
 		t.Errorf("mismatched enode URIs:\n got: %s\nwant: %s", got, want)
 	}
 }
+
+func TestAgentShutdown(t *testing.T) {
+	delays := make(chan time.Duration, 1)
+	agent := Agent{
+		EthNode: fakenode.Node("foo"),
+		ShutdownCallback: func(reconnectDelay time.Duration) {
+			delays <- reconnectDelay
+		},
+	}
+
+	rpcPool, rpcAgent := jsonrpc2.ServePipe()
+	defer rpcPool.Close()
+	defer rpcAgent.Close()
+	if err := rpcAgent.Server.RegisterMethod("vipnode_shutdown", &agent, "Shutdown"); err != nil {
+		t.Fatal(err)
+	}
+
+	notice := pool.ShutdownNotice{ReconnectDelay: 1500}
+	if err := rpcPool.Notify(context.Background(), "vipnode_shutdown", notice); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-delays:
+		if want := 1500 * time.Millisecond; got != want {
+			t.Errorf("wrong reconnect delay: got %s; want %s", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for shutdown callback")
+	}
+}
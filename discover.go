@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+)
+
+// poolHTTPService returns an RPC service for the pool at poolURI over HTTP,
+// for one-off commands that don't need a persistent connection.
+func poolHTTPService(poolURI string) (*jsonrpc2.HTTPService, error) {
+	if poolURI == "" {
+		poolURI = defaultPoolURI
+	}
+	uri, err := url.Parse(poolURI)
+	if err != nil {
+		return nil, ErrExplain{err, `Failed to parse the pool URI. It should look something like: "wss://pool.vipnode.org/"`}
+	}
+	// Pools serve the same RPC API over HTTP POST as over websockets.
+	switch uri.Scheme {
+	case "", "wss":
+		uri.Scheme = "https"
+	case "ws":
+		uri.Scheme = "http"
+	}
+	return &jsonrpc2.HTTPService{
+		Endpoint: uri.String(),
+	}, nil
+}
+
+// runDiscover prints the OpenRPC document served by a pool.
+func runDiscover(options Options) error {
+	service, err := poolHTTPService(options.Discover.Args.Pool)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	var doc json.RawMessage
+	if err := service.Call(ctx, &doc, jsonrpc2.DiscoverMethod); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, doc, "", "  "); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
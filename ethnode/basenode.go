@@ -2,6 +2,8 @@ package ethnode
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"strconv"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -34,3 +36,71 @@ func (n *baseNode) BlockNumber(ctx context.Context) (uint64, error) {
 	}
 	return strconv.ParseUint(result, 0, 64)
 }
+
+func (n *baseNode) BlockHash(ctx context.Context, number uint64) (string, error) {
+	var result *struct {
+		Hash string `json:"hash"`
+	}
+	if err := n.client.CallContext(ctx, &result, "eth_getBlockByNumber", "0x"+strconv.FormatUint(number, 16), false); err != nil {
+		return "", err
+	}
+	if result == nil {
+		return "", fmt.Errorf("block not found: %d", number)
+	}
+	return result.Hash, nil
+}
+
+func (n *baseNode) Syncing(ctx context.Context) (*SyncProgress, error) {
+	var result json.RawMessage
+	if err := n.client.CallContext(ctx, &result, "eth_syncing"); err != nil {
+		return nil, err
+	}
+	return parseSyncProgress(result)
+}
+
+// SyncProgress is the progress of a node that is still importing the chain.
+type SyncProgress struct {
+	StartingBlock uint64 `json:"starting_block"`
+	CurrentBlock  uint64 `json:"current_block"`
+	HighestBlock  uint64 `json:"highest_block"`
+}
+
+// parseSyncProgress parses the result of eth_syncing, which is false if the
+// node is not syncing, or an object of hex-encoded block numbers.
+func parseSyncProgress(result json.RawMessage) (*SyncProgress, error) {
+	var syncing bool
+	if err := json.Unmarshal(result, &syncing); err == nil {
+		if syncing {
+			// Some nodes only report that they're syncing
+			return &SyncProgress{}, nil
+		}
+		return nil, nil
+	}
+	var raw struct {
+		StartingBlock string `json:"startingBlock"`
+		CurrentBlock  string `json:"currentBlock"`
+		HighestBlock  string `json:"highestBlock"`
+	}
+	if err := json.Unmarshal(result, &raw); err != nil {
+		return nil, err
+	}
+	var progress SyncProgress
+	for _, field := range []struct {
+		s  string
+		to *uint64
+	}{
+		{raw.StartingBlock, &progress.StartingBlock},
+		{raw.CurrentBlock, &progress.CurrentBlock},
+		{raw.HighestBlock, &progress.HighestBlock},
+	} {
+		if field.s == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(field.s, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		*field.to = v
+	}
+	return &progress, nil
+}
@@ -0,0 +1,115 @@
+package ethnode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Capability is a devp2p sub-protocol that a node supports, in the same
+// format as PeerInfo.Caps, such as "eth/63" or "les/2".
+type Capability struct {
+	Name    string
+	Version int // Version is 0 if it's unknown.
+}
+
+// ParseCapability parses a capability string such as "les/2". The version
+// can be omitted, such as "les", in which case it is unknown.
+func ParseCapability(s string) (Capability, error) {
+	parts := strings.SplitN(s, "/", 2)
+	c := Capability{Name: strings.ToLower(parts[0])}
+	if c.Name == "" {
+		return c, fmt.Errorf("invalid capability: %q", s)
+	}
+	if len(parts) == 2 {
+		version, err := strconv.Atoi(parts[1])
+		if err != nil || version < 0 {
+			return c, fmt.Errorf("invalid capability version: %q", s)
+		}
+		c.Version = version
+	}
+	return c, nil
+}
+
+func (c Capability) String() string {
+	if c.Version == 0 {
+		return c.Name
+	}
+	return fmt.Sprintf("%s/%d", c.Name, c.Version)
+}
+
+// Satisfies returns whether the capability is the same protocol as required,
+// with at least the required version. Capabilities with unknown versions are
+// assumed to satisfy any version.
+func (c Capability) Satisfies(required Capability) bool {
+	if c.Name != required.Name {
+		return false
+	}
+	return c.Version == 0 || c.Version >= required.Version
+}
+
+// ParseCapabilities parses a list of capability strings.
+func ParseCapabilities(caps []string) ([]Capability, error) {
+	r := make([]Capability, 0, len(caps))
+	for _, s := range caps {
+		c, err := ParseCapability(s)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, c)
+	}
+	return r, nil
+}
+
+// SupportsAll returns whether caps satisfy all of the required capabilities.
+// Unparseable caps are ignored.
+func SupportsAll(caps []string, required []Capability) bool {
+	supported := make([]Capability, 0, len(caps))
+	for _, s := range caps {
+		if c, err := ParseCapability(s); err == nil {
+			supported = append(supported, c)
+		}
+	}
+	for _, req := range required {
+		found := false
+		for _, c := range supported {
+			if c.Satisfies(req) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Caps returns the capabilities that can be derived from the user agent's
+// protocol version, such as "eth/63" for full nodes or "les/2" for geth light
+// clients. Parity full nodes also include "pip", since they serve Parity
+// light clients by default. It is empty if the protocol version is unknown.
+func (ua *UserAgent) Caps() []string {
+	protocol, err := strconv.ParseInt(ua.EthProtocol, 0, 32)
+	if err != nil || protocol <= 0 {
+		return nil
+	}
+	if ua.IsFullNode {
+		caps := []string{fmt.Sprintf("eth/%d", protocol)}
+		if ua.Kind == Parity {
+			// The PIP version isn't reported, so it's unknown
+			caps = append(caps, "pip")
+		}
+		return caps
+	}
+	switch ua.Kind {
+	case Parity:
+		return []string{fmt.Sprintf("pip/%d", protocol)}
+	case Geth:
+		// Geth light clients report the LES version offset by 10000
+		if protocol > 10000 {
+			return []string{fmt.Sprintf("les/%d", protocol-10000)}
+		}
+	}
+	return nil
+}
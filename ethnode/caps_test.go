@@ -0,0 +1,72 @@
+package ethnode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCapability(t *testing.T) {
+	testcases := []struct {
+		have     string
+		required string
+		want     bool
+	}{
+		{"les/2", "les/2", true},
+		{"les/3", "les/2", true},
+		{"les/1", "les/2", false},
+		{"les", "les/2", true},
+		{"eth/63", "les", false},
+		{"LES/2", "les", true},
+	}
+
+	for i, tc := range testcases {
+		have, err := ParseCapability(tc.have)
+		if err != nil {
+			t.Fatalf("[case %d] unexpected error: %s", i, err)
+		}
+		required, err := ParseCapability(tc.required)
+		if err != nil {
+			t.Fatalf("[case %d] unexpected error: %s", i, err)
+		}
+		if got := have.Satisfies(required); got != tc.want {
+			t.Errorf("[case %d] %s satisfies %s: got %t; want %t", i, have, required, got, tc.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "/2", "les/x", "les/-1"} {
+		if _, err := ParseCapability(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+
+	required := []Capability{{"eth", 63}, {"les", 2}}
+	if !SupportsAll([]string{"eth/63", "eth/64", "les"}, required) {
+		t.Error("expected caps to support all required")
+	}
+	if SupportsAll([]string{"eth/63"}, required) {
+		t.Error("expected caps to not support les")
+	}
+}
+
+func TestUserAgentCaps(t *testing.T) {
+	testcases := []struct {
+		clientVersion   string
+		protocolVersion string
+		want            []string
+	}{
+		{"Geth/v1.8.16-unstable/linux-amd64/go1.10.3", "0x2712", []string{"les/2"}},
+		{"Geth/foo/v1.8.13-unstable/linux-amd64/go1.10.3", "0x3f", []string{"eth/63"}},
+		{"Parity-Ethereum//v2.0.5-stable-7dc4d349a1-20180917/x86_64-linux-gnu/rustc1.29.0", "1", []string{"pip/1"}},
+		{"Parity-Ethereum//v2.0.5-stable-7dc4d349a1-20180917/x86_64-linux-gnu/rustc1.29.0", "0x3f", []string{"eth/63", "pip"}},
+	}
+
+	for i, tc := range testcases {
+		ua, err := ParseUserAgent(tc.clientVersion, tc.protocolVersion, "1")
+		if err != nil {
+			t.Fatalf("[case %d] unexpected error: %s", i, err)
+		}
+		if got := ua.Caps(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("[case %d] got caps %q; want %q", i, got, tc.want)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package ethnode
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
 	"strings"
 )
 
@@ -74,3 +76,22 @@ func (n *gethNode) Enode(ctx context.Context) (string, error) {
 	}
 	return info.Enode, nil
 }
+
+// Caps returns the names of the sub-protocols that the node is running, such
+// as "eth" and "les" if it's also serving light clients. Versions are not
+// included in admin_nodeInfo.
+func (n *gethNode) Caps(ctx context.Context) ([]string, error) {
+	var info struct {
+		Protocols map[string]json.RawMessage `json:"protocols"`
+	}
+	err := n.client.CallContext(ctx, &info, "admin_nodeInfo")
+	if err != nil {
+		return nil, err
+	}
+	caps := make([]string, 0, len(info.Protocols))
+	for name := range info.Protocols {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+	return caps, nil
+}
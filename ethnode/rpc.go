@@ -88,6 +88,24 @@ func (id NetworkID) String() string {
 	return "unknown"
 }
 
+// GenesisHash returns the hex-encoded hash of the network's genesis block, or
+// empty if it's not known.
+func (id NetworkID) GenesisHash() string {
+	switch id {
+	case Mainnet:
+		return "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+	case Ropsten:
+		return "0x41941023680923e0fe4d74a34bdac8141f2540e3ae90623718e47d66d1ca4a2d"
+	case Rinkeby:
+		return "0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177"
+	case Kovan:
+		return "0xa3c565fc15c7478862d50ccd6561e3c06b24cc509bf388941c25ea985ce32cb9"
+	case Goerli:
+		return "0xbf7e331f7f7c1dd2e05159666b3bf8bc7a8a3a9eb1d518969eab529dd9b88c1a"
+	}
+	return ""
+}
+
 // Is compares the ID to a network name.
 func (id NetworkID) Is(network string) bool {
 	return id.String() == strings.ToLower(network)
@@ -290,6 +308,12 @@ type EthNode interface {
 	Peers(ctx context.Context) ([]PeerInfo, error)
 	// BlockNumber returns the current sync'd block number.
 	BlockNumber(ctx context.Context) (uint64, error)
+	// BlockHash returns the hex-encoded hash of the block with the number,
+	// such as 0 for the genesis block.
+	BlockHash(ctx context.Context, number uint64) (string, error)
+	// Syncing returns the progress of importing the chain, or nil if the
+	// node is not syncing.
+	Syncing(ctx context.Context) (*SyncProgress, error)
 }
 
 // RemoteNode autodetects the node kind and returns the appropriate EthNode
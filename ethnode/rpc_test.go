@@ -29,3 +29,30 @@ func TestParseUserAgent(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSyncProgress(t *testing.T) {
+	testcases := []struct {
+		result string
+		want   *SyncProgress
+	}{
+		{`false`, nil},
+		{`true`, &SyncProgress{}},
+		{`{"startingBlock":"0x0","currentBlock":"0x1f4","highestBlock":"0x3e8"}`, &SyncProgress{0, 500, 1000}},
+		{`{"startingBlock":"0x64","currentBlock":"0x1f4","highestBlock":"0x3e8","knownStates":"0x2"}`, &SyncProgress{100, 500, 1000}},
+	}
+
+	for i, tc := range testcases {
+		got, err := parseSyncProgress([]byte(tc.result))
+		if err != nil {
+			t.Errorf("[case %d] unexpected error: %s", i, err)
+			continue
+		}
+		if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+			t.Errorf("[case %d] wrong progress: got %+v; want %+v", i, got, tc.want)
+		}
+	}
+
+	if _, err := parseSyncProgress([]byte(`{"currentBlock":"foo"}`)); err == nil {
+		t.Error("expected error for malformed block number")
+	}
+}
@@ -52,6 +52,8 @@ type FakeNode struct {
 	Calls           Calls
 	FakePeers       []ethnode.PeerInfo
 	FakeBlockNumber uint64
+	FakeBlockHash   string
+	FakeSyncing     *ethnode.SyncProgress
 	IsFullNode      bool
 }
 
@@ -124,6 +126,15 @@ func (n *FakeNode) Peers(ctx context.Context) ([]ethnode.PeerInfo, error) {
 func (n *FakeNode) BlockNumber(ctx context.Context) (uint64, error) {
 	return n.FakeBlockNumber, nil
 }
+func (n *FakeNode) BlockHash(ctx context.Context, number uint64) (string, error) {
+	if number == 0 {
+		return n.UserAgent().Network.GenesisHash(), nil
+	}
+	return n.FakeBlockHash, nil
+}
+func (n *FakeNode) Syncing(ctx context.Context) (*ethnode.SyncProgress, error) {
+	return n.FakeSyncing, nil
+}
 
 func FakePeers(num int) []ethnode.PeerInfo {
 	peers := make([]ethnode.PeerInfo, 0, num)
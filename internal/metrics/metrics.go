@@ -0,0 +1,383 @@
+// Package metrics implements counters, gauges, and histograms which are
+// written in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are histogram buckets for latencies in seconds, from 5ms to
+// 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelSep separates label values in series keys, it can't appear in valid
+// UTF-8 label values.
+const labelSep = "\xff"
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Registry is a set of metrics which are written together.
+type Registry struct {
+	mu        sync.Mutex
+	metrics   []metric
+	names     map[string]struct{}
+	onCollect []func()
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names == nil {
+		r.names = map[string]struct{}{}
+	}
+	if _, ok := r.names[name]; ok {
+		panic(fmt.Sprintf("metrics: %q is already registered", name))
+	}
+	r.names[name] = struct{}{}
+	r.metrics = append(r.metrics, m)
+}
+
+// OnCollect adds a callback which is called before the metrics are written,
+// such as to update gauges which are derived from other state.
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onCollect = append(r.onCollect, fn)
+}
+
+// Counter registers a new Counter.
+func (r *Registry) Counter(name string, help string, labels ...string) *Counter {
+	c := &Counter{newFamily(name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+// Gauge registers a new Gauge.
+func (r *Registry) Gauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily(name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+// Histogram registers a new Histogram with the given upper bounds of its
+// buckets, in increasing order.
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  newFamily(name, help, "histogram", labels),
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	r.register(name, h)
+	return h
+}
+
+// WriteTo writes all of the metrics in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	onCollect := r.onCollect
+	metrics := r.metrics
+	r.mu.Unlock()
+
+	for _, fn := range onCollect {
+		fn()
+	}
+	cw := &countingWriter{w: w}
+	buf := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	err := buf.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics for scraping.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func newFamily(name string, help string, kind string, labels []string) family {
+	return family{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: map[string]float64{},
+	}
+}
+
+// family is the name, labels, and values of each series of a metric.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // Keyed by joined label values
+}
+
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %q has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, labelSep)
+}
+
+func (f *family) add(v float64, labelValues []string) {
+	key := f.key(labelValues)
+	f.mu.Lock()
+	f.values[key] += v
+	f.mu.Unlock()
+}
+
+func (f *family) set(v float64, labelValues []string) {
+	key := f.key(labelValues)
+	f.mu.Lock()
+	f.values[key] = v
+	f.mu.Unlock()
+}
+
+func (f *family) get(labelValues []string) float64 {
+	key := f.key(labelValues)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[key]
+}
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writeHeader(w)
+	if len(f.labels) == 0 && len(f.values) == 0 {
+		// Unlabelled metrics are always written
+		fmt.Fprintf(w, "%s 0\n", f.name)
+		return
+	}
+	for _, key := range sortedKeys(f.values) {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, key, ""), formatValue(f.values[key]))
+	}
+}
+
+// Counter is a value which only increases, such as a number of calls.
+type Counter struct {
+	family
+}
+
+// Inc adds one to the series with the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.family.add(1, labelValues)
+}
+
+// Add adds v to the series with the label values. Negative values are
+// ignored, since counters only increase.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.family.add(v, labelValues)
+}
+
+// Value returns the value of the series with the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.family.get(labelValues)
+}
+
+// Gauge is a value which can go up and down, such as a number of connections.
+type Gauge struct {
+	family
+}
+
+// Set sets the value of the series with the label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.family.set(v, labelValues)
+}
+
+// Add adds v, which can be negative, to the series with the label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.family.add(v, labelValues)
+}
+
+// Inc adds one to the series with the label values.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.family.add(1, labelValues)
+}
+
+// Dec subtracts one from the series with the label values.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.family.add(-1, labelValues)
+}
+
+// Value returns the value of the series with the label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.family.get(labelValues)
+}
+
+// Reset removes all of the series, such as before setting the current values
+// of a gauge whose label values come and go.
+func (g *Gauge) Reset() {
+	g.mu.Lock()
+	g.values = map[string]float64{}
+	g.mu.Unlock()
+}
+
+// Histogram counts observations in buckets, such as latencies.
+type Histogram struct {
+	family
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Non-cumulative count per bucket
+	count  uint64
+	sum    float64
+}
+
+// Observe adds the value to the series with the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Since observes the number of seconds since start.
+func (h *Histogram) Since(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns the number of observations of the series with the label
+// values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, formatValue(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key, ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, ""), s.count)
+	}
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels returns the label set of a series, including the le label of a
+// histogram bucket if it's not empty.
+func formatLabels(labels []string, key string, le string) string {
+	if len(labels) == 0 && le == "" {
+		return ""
+	}
+	var values []string
+	if len(labels) > 0 {
+		values = strings.Split(key, labelSep)
+	}
+	pairs := make([]string, 0, len(labels)+1)
+	for i, label := range labels {
+		pairs = append(pairs, label+`="`+escapeLabel(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// escapeLabel escapes backslashes, newlines, and quotes in label values.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
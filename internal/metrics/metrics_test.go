@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	calls := r.Counter("calls_total", "Calls made.", "method", "code")
+	conns := r.Gauge("connections", "Open connections.")
+	latency := r.Histogram("latency_seconds", "Call latency.", []float64{0.1, 1}, "method")
+
+	calls.Inc("foo", "0")
+	calls.Inc("foo", "0")
+	calls.Add(-1, "foo", "0")
+	calls.Inc(`b"a\r`, "-32601")
+	latency.Observe(0.05, "foo")
+	latency.Observe(0.5, "foo")
+	latency.Observe(5, "foo")
+
+	collected := false
+	r.OnCollect(func() {
+		collected = true
+		conns.Set(3)
+	})
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !collected {
+		t.Error("OnCollect callback was not called")
+	}
+
+	want := `# HELP calls_total Calls made.
+# TYPE calls_total counter
+calls_total{method="b\"a\\r",code="-32601"} 1
+calls_total{method="foo",code="0"} 2
+# HELP connections Open connections.
+# TYPE connections gauge
+connections 3
+# HELP latency_seconds Call latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="foo",le="0.1"} 1
+latency_seconds_bucket{method="foo",le="1"} 2
+latency_seconds_bucket{method="foo",le="+Inf"} 3
+latency_seconds_sum{method="foo"} 5.55
+latency_seconds_count{method="foo"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := calls.Value("foo", "0"); got != 2 {
+		t.Errorf("wrong counter value: %v", got)
+	}
+	if got := latency.Count("foo"); got != 3 {
+		t.Errorf("wrong histogram count: %d", got)
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("foo", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic registering a duplicate metric")
+		}
+	}()
+	r.Gauge("foo", "")
+}
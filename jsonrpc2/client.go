@@ -1,10 +1,16 @@
 package jsonrpc2
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"sync/atomic"
 )
 
+// ErrMissingBatchResponse is set on a BatchCall when the batch response did
+// not include a response for the call.
+var ErrMissingBatchResponse = errors.New("missing response for batch call")
+
 type Requester interface {
 	// Request takes call inputs and creates a valid request Message.
 	Request(method string, params ...interface{}) (*Message, error)
@@ -37,3 +43,82 @@ func (c *Client) Request(method string, params ...interface{}) (*Message, error)
 	}
 	return msg, nil
 }
+
+// Notifier can send notifications, which are requests that do not receive a
+// response.
+type Notifier interface {
+	// Notify sends a notification for the method. It returns once the
+	// notification is sent, without waiting for it to be executed.
+	Notify(ctx context.Context, method string, params ...interface{}) error
+}
+
+// notification creates a request Message without an ID using the requester.
+func notification(requester Requester, method string, params ...interface{}) (*Message, error) {
+	msg, err := requester.Request(method, params...)
+	if err != nil {
+		return nil, err
+	}
+	msg.ID = nil
+	return msg, nil
+}
+
+// BatchCall is a single call within a batch of calls.
+type BatchCall struct {
+	Method string
+	Params []interface{}
+	// Result is unmarshalled into when the call succeeds. (Optional)
+	Result interface{}
+	// Error is set when the call fails.
+	Error error
+}
+
+// BatchService is a Service which can also send multiple calls in a single
+// batch request.
+type BatchService interface {
+	Service
+	// CallBatch sends all of the calls in one batch request and waits for the
+	// responses. Each call's Result or Error is set from its response. The
+	// returned error is only set if the batch failed as a whole.
+	CallBatch(ctx context.Context, calls []BatchCall) error
+}
+
+// batchRequest creates a batch request Message using the requester for each
+// of the calls.
+func batchRequest(requester Requester, calls []BatchCall) (*Message, error) {
+	batch := &Message{
+		Batch: make([]*Message, 0, len(calls)),
+	}
+	for _, call := range calls {
+		msg, err := requester.Request(call.Method, call.Params...)
+		if err != nil {
+			return nil, err
+		}
+		batch.Batch = append(batch.Batch, msg)
+	}
+	return batch, nil
+}
+
+// setBatchResults matches the responses of a batch request to the calls by ID,
+// and sets the results (or errors) on the calls. Responses can be in any order.
+func setBatchResults(calls []BatchCall, req *Message, resp *Message) error {
+	if !resp.IsBatch() {
+		// Failed batches are answered with a single error response
+		if resp.Response != nil && resp.Response.Error != nil {
+			return resp.Response.Error
+		}
+		return ErrMissingBatchResponse
+	}
+	responses := make(map[string]*Message, len(resp.Batch))
+	for _, msg := range resp.Batch {
+		responses[string(msg.ID)] = msg
+	}
+	for i, msg := range req.Batch {
+		r, ok := responses[string(msg.ID)]
+		if !ok || r.Response == nil {
+			calls[i].Error = ErrMissingBatchResponse
+			continue
+		}
+		calls[i].Error = r.Response.UnmarshalResult(calls[i].Result)
+	}
+	return nil
+}
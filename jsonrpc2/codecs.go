@@ -2,6 +2,7 @@ package jsonrpc2
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 
 	"github.com/vipnode/vipnode/v2/internal/pretty"
@@ -13,6 +14,10 @@ type rwc struct {
 	io.Closer
 }
 
+// ErrMessageTooLarge is returned by codecs which enforce a size limit when a
+// received message exceeds it.
+var ErrMessageTooLarge = errors.New("message too large")
+
 // Codec is an straction for receiving and sending JSONRPC messages.
 type Codec interface {
 	ReadMessage() (*Message, error)
@@ -1,9 +1,12 @@
 /*
 	Package jsonrpc2 implements bidirectional JSONRPC 2.0. This implementation
-	does not include Subscription/Notifications, as these features are
-	extraneous when bidirectional RPC is available.
+	does not include Subscriptions, as they are extraneous when bidirectional
+	RPC is available. Notifications (requests without an ID) are executed
+	without producing a response, and can be sent with a Notifier.
 
 	Server is an RPC method registry. Given a receiver, it will expose callable
+	methods. Interceptors can be added with Server.Use to wrap every method
+	call, regardless of which transport the call arrived on.
 
 	Client is an RPC caller implementation.
 
@@ -13,9 +16,18 @@
 
 	Remote is a Codec, Server, and Client. Note that it can be a Server and
 	Client at the same time, which allows for bidirectional calls.
+	ReconnectingRemote keeps a Remote's Server across connections, re-dialing
+	whenever the connection is lost.
 
 	When a Remote receives a call, it includes a context which contains a
 	service value that can be acquired with CtxService(ctx). The service can be
-	used to send calls back to the caller.
+	used to send calls back to the caller. The context is scoped to the
+	connection: it is cancelled when the Remote stops serving or when the caller
+	cancels the call, and it carries any values set with CtxSetValue during
+	earlier calls on the same connection.
+
+	Batch requests are supported: Server executes each call in a batch and
+	returns a batch response, and BatchService implementations (Remote, Local,
+	HTTPService) can send a batch of calls with CallBatch.
 */
 package jsonrpc2
@@ -24,6 +24,26 @@ func (f *FruitService) Durian() error {
 	return errors.New("durian failure")
 }
 
+type QuotaError struct {
+	Remaining int `json:"remaining"`
+}
+
+func (err QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: %d remaining", err.Remaining)
+}
+
+func (err QuotaError) ErrorCode() int {
+	return -32042
+}
+
+func (err QuotaError) ErrorData() interface{} {
+	return err
+}
+
+func (f *FruitService) Elderberry() error {
+	return QuotaError{Remaining: 3}
+}
+
 type Pinger struct {
 	PongService Service
 }
@@ -63,3 +83,36 @@ func (f *Fib) Fibonacci(ctx context.Context, a int, b int, steps int) (int, erro
 	}
 	return b, nil
 }
+
+type Listener struct {
+	Received chan string
+}
+
+func (l *Listener) Announce(msg string) {
+	l.Received <- msg
+}
+
+type Waiter struct {
+	Started chan struct{}
+	Stopped chan error
+}
+
+func (w *Waiter) Wait(ctx context.Context) error {
+	w.Started <- struct{}{}
+	<-ctx.Done()
+	w.Stopped <- ctx.Err()
+	return ctx.Err()
+}
+
+type sessionKey struct{}
+
+type Session struct{}
+
+func (s *Session) Login(ctx context.Context, name string) error {
+	return CtxSetValue(ctx, sessionKey{}, name)
+}
+
+func (s *Session) Whoami(ctx context.Context) string {
+	name, _ := ctx.Value(sessionKey{}).(string)
+	return name
+}
@@ -59,8 +59,13 @@ func (h *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("content-type", httpContentType)
 	resp := h.Server.Handle(r.Context(), msg)
+	if resp == nil {
+		// Notifications don't get a response
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("content-type", httpContentType)
 	err = codec.WriteMessage(resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -68,7 +73,8 @@ func (h *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-var _ Service = &HTTPService{}
+var _ BatchService = &HTTPService{}
+var _ Notifier = &HTTPService{}
 
 type HTTPService struct {
 	Client
@@ -85,32 +91,82 @@ func (service *HTTPService) Call(ctx context.Context, result interface{}, method
 	if err != nil {
 		return err
 	}
-	body, err := json.Marshal(msg)
+	respMsg, err := service.do(ctx, msg)
 	if err != nil {
 		return err
 	}
+	return respMsg.Response.UnmarshalResult(result)
+}
 
-	req, err := http.NewRequest(http.MethodPost, service.Endpoint, bytes.NewReader(body))
+// CallBatch sends the calls in a single batch HTTP request.
+func (service *HTTPService) CallBatch(ctx context.Context, calls []BatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	msg, err := batchRequest(&service.Client, calls)
+	if err != nil {
+		return err
+	}
+	respMsg, err := service.do(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return setBatchResults(calls, msg, respMsg)
+}
+
+// Notify sends a notification as an HTTP request. The server does not
+// respond with a message, so only transport errors are returned.
+func (service *HTTPService) Notify(ctx context.Context, method string, params ...interface{}) error {
+	msg, err := notification(&service.Client, method, params...)
+	if err != nil {
+		return err
+	}
+	resp, err := service.post(ctx, msg)
 	if err != nil {
 		return err
 	}
+	return resp.Body.Close()
+}
+
+// post sends the message as an HTTP request and returns the response if it
+// has a successful status code. The response body must be closed.
+func (service *HTTPService) post(ctx context.Context, msg *Message) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, service.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", httpContentType)
 	req.Header.Set("Accept", httpContentType)
 	req = req.WithContext(ctx)
 
 	resp, err := service.HTTPClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return HTTPRequestError{
+		resp.Body.Close()
+		return nil, HTTPRequestError{
 			Response: resp,
 			Reason:   fmt.Sprintf("bad status code: %d", resp.StatusCode),
 		}
 	}
+	return resp, nil
+}
+
+// do sends the message as an HTTP request and decodes the response message.
+func (service *HTTPService) do(ctx context.Context, msg *Message) (*Message, error) {
+	resp, err := service.post(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 	if service.MaxContentLength > 0 && resp.ContentLength > service.MaxContentLength {
-		return HTTPRequestError{
+		return nil, HTTPRequestError{
 			Response: resp,
 			Reason:   "response too large",
 		}
@@ -123,15 +179,15 @@ func (service *HTTPService) Call(ctx context.Context, result interface{}, method
 
 	var respMsg Message
 	if err := json.NewDecoder(r).Decode(&respMsg); err != nil {
-		return err
+		return nil, err
 	}
-	if respMsg.Response == nil {
-		return HTTPRequestError{
+	if !respMsg.IsBatch() && respMsg.Response == nil {
+		return nil, HTTPRequestError{
 			Response: resp,
 			Reason:   "missing response in RPC message",
 		}
 	}
-	return respMsg.Response.UnmarshalResult(result)
+	return &respMsg, nil
 }
 
 // HTTPRequestError is used when RPC over HTTP encounters an error during transport.
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -71,3 +72,94 @@ func TestHTTPService(t *testing.T) {
 	default:
 	}
 }
+
+func TestHTTPServiceBatch(t *testing.T) {
+	server := HTTPServer{}
+	if err := server.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	endpoint := fmt.Sprintf("http://%s", serverConn.Addr().String())
+	go http.Serve(serverConn, &server)
+
+	// Try manual HTTP request first
+	resp, err := http.Post(endpoint, "application/json", strings.NewReader(`[{"jsonrpc":"2.0","id":1,"method":"apple"},{"jsonrpc":"2.0","id":2,"method":"cherry"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var respMsgs []Message
+	if err := json.NewDecoder(resp.Body).Decode(&respMsgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(respMsgs) != 2 {
+		t.Fatalf("wrong number of responses: %v", respMsgs)
+	}
+	if got, want := string(respMsgs[1].Result), `"Cherry"`; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+
+	// Try rpc.CallBatch
+	rpc := HTTPService{
+		Endpoint: endpoint,
+	}
+	var apple, cherry string
+	calls := []BatchCall{
+		{Method: "apple", Result: &apple},
+		{Method: "durian"},
+		{Method: "cherry", Result: &cherry},
+	}
+	if err := rpc.CallBatch(context.Background(), calls); err != nil {
+		t.Fatal(err)
+	}
+	if apple != "Apple" || cherry != "Cherry" {
+		t.Errorf("wrong results: %q, %q", apple, cherry)
+	}
+	if calls[0].Error != nil || calls[2].Error != nil {
+		t.Errorf("unexpected errors: %v", calls)
+	}
+	if calls[1].Error == nil || calls[1].Error.Error() != "durian failure" {
+		t.Errorf("unexpected error: %v", calls[1].Error)
+	}
+}
+
+func TestHTTPServiceNotify(t *testing.T) {
+	listener := &Listener{Received: make(chan string, 1)}
+	server := HTTPServer{}
+	if err := server.Register("", listener); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	endpoint := fmt.Sprintf("http://%s", serverConn.Addr().String())
+	go http.Serve(serverConn, &server)
+
+	resp, err := http.Post(endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"announce","params":["hi"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("wrong status code: %d", resp.StatusCode)
+	}
+	if got, want := <-listener.Received, "hi"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+
+	rpc := HTTPService{
+		Endpoint: endpoint,
+	}
+	if err := rpc.Notify(context.Background(), "announce", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-listener.Received, "hello"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// HandlerFunc executes a call to the named method with raw JSON params, and
+// returns the result or an error.
+type HandlerFunc func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// Interceptor wraps a HandlerFunc with additional behaviour, such as logging,
+// timing, or authorization. It can modify the inputs before calling next, the
+// outputs after, or skip calling next altogether.
+type Interceptor func(next HandlerFunc) HandlerFunc
+
+// serverError is returned by the Server's own HandlerFunc for failures that
+// have a specific error code, such as a missing method.
+type serverError struct {
+	ErrResponse
+}
+
+// errResponse converts an error returned by a HandlerFunc into an error
+// response.
+//
+// Errors can specify their own error code by implementing
+// `ErrorCode() int`, and attach structured data to the response by
+// implementing `ErrorData() interface{}`. Otherwise, ErrCodeInternal is used.
+// Error responses received from another remote call are not passed through
+// as-is, since their codes are relative to that remote.
+func errResponse(err error) *ErrResponse {
+	resp := &ErrResponse{
+		Code:    ErrCodeInternal,
+		Message: err.Error(),
+	}
+	switch typedErr := err.(type) {
+	case *serverError:
+		return &typedErr.ErrResponse
+	case *ErrResponse:
+		return resp
+	}
+
+	if codeErr, ok := err.(interface{ ErrorCode() int }); ok {
+		resp.Code = codeErr.ErrorCode()
+	}
+	if dataErr, ok := err.(interface{ ErrorData() interface{} }); ok {
+		data, marshalErr := json.Marshal(dataErr.ErrorData())
+		if marshalErr != nil {
+			logger.Printf("Failed to marshal error data for %T: %s", err, marshalErr)
+		} else {
+			resp.Data = data
+		}
+	}
+	return resp
+}
+
+// ResponseCode returns the code of the error response that err is sent as,
+// or 0 if err is nil. This is useful for interceptors that record failures.
+func ResponseCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return errResponse(err).Code
+}
+
+// PanicError is returned by the Recover interceptor when a method panics.
+type PanicError struct {
+	Method string
+	Value  interface{}
+}
+
+func (err PanicError) Error() string {
+	return fmt.Sprintf("method %s panicked: %v", err.Method, err.Value)
+}
+
+// Recover is an Interceptor which recovers from panics in the method call and
+// returns them as a PanicError.
+func Recover(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, method string, params json.RawMessage) (result interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Printf("Recovered from panic in method %s: %v", method, r)
+				result, err = nil, PanicError{Method: method, Value: r}
+			}
+		}()
+		return next(ctx, method, params)
+	}
+}
+
+// LimitExceededError is returned when a request is rejected because too many
+// requests are already being handled.
+type LimitExceededError struct {
+	Limit int
+}
+
+func (err LimitExceededError) Error() string {
+	return fmt.Sprintf("too many concurrent requests (limit %d)", err.Limit)
+}
+
+func (err LimitExceededError) ErrorCode() int {
+	return ErrCodeLimitExceeded
+}
+
+// ConcurrencyLimit returns an Interceptor which allows at most max method
+// calls to execute concurrently. Calls beyond the limit are rejected with a
+// LimitExceededError. Used with Server.Use, the limit is shared by every
+// connection that the Server is handling.
+func ConcurrencyLimit(max int) Interceptor {
+	sem := make(chan struct{}, max)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+			select {
+			case sem <- struct{}{}:
+			default:
+				return nil, LimitExceededError{Limit: max}
+			}
+			defer func() { <-sem }()
+			return next(ctx, method, params)
+		}
+	}
+}
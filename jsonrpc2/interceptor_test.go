@@ -0,0 +1,109 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerUse(t *testing.T) {
+	var calls []string
+	tracer := func(label string) Interceptor {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+				calls = append(calls, label+":"+method)
+				return next(ctx, method, params)
+			}
+		}
+	}
+	deny := func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+			if method == "banana" {
+				return nil, errors.New("denied")
+			}
+			return next(ctx, method, params)
+		}
+	}
+
+	rpc := Local{}
+	if err := rpc.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+	rpc.Use(tracer("a"), tracer("b"))
+	rpc.Use(deny)
+
+	var got string
+	if err := rpc.Call(context.Background(), &got, "apple"); err != nil {
+		t.Error(err)
+	}
+	if want := "Apple"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+	if err := rpc.Call(context.Background(), nil, "banana"); err == nil || err.Error() != "denied" {
+		t.Errorf("expected denied error, got: %v", err)
+	}
+
+	want := []string{"a:apple", "b:apple", "a:banana", "b:banana"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got: %q; want %q", calls, want)
+	}
+}
+
+type Panicker struct{}
+
+func (p *Panicker) Boom() string {
+	panic("boom")
+}
+
+func TestRecover(t *testing.T) {
+	server, client := ServePipe()
+	server.Server.Register("", &Panicker{})
+	server.Server.(*Server).Use(Recover)
+
+	err := client.Call(context.Background(), nil, "boom")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := err.Error(), (PanicError{"boom", "boom"}).Error(); got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	rpc := Local{}
+	waiter := &Waiter{Started: make(chan struct{}), Stopped: make(chan error, 1)}
+	if err := rpc.Register("", waiter); err != nil {
+		t.Fatal(err)
+	}
+	if err := rpc.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+	rpc.Use(ConcurrencyLimit(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go rpc.Call(ctx, nil, "wait")
+	<-waiter.Started
+
+	if err := rpc.Call(context.Background(), nil, "apple"); !IsErrorCode(err, ErrCodeLimitExceeded) {
+		t.Errorf("expected limit exceeded error, got: %v", err)
+	}
+
+	cancel()
+	<-waiter.Stopped
+	// The slot is released shortly after the handler returns
+	deadline := time.Now().Add(time.Second)
+	for {
+		var got string
+		err := rpc.Call(context.Background(), &got, "apple")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call failed after limit was freed: %s", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
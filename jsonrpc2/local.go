@@ -4,7 +4,8 @@ import (
 	"context"
 )
 
-var _ Service = &Local{}
+var _ BatchService = &Local{}
+var _ Notifier = &Local{}
 
 // Local is a Service implementation for a local Server. It's like Remote, but
 // no Codec.
@@ -22,3 +23,29 @@ func (loc *Local) Call(ctx context.Context, result interface{}, method string, p
 	resp := loc.Server.Handle(ctx, req)
 	return resp.UnmarshalResult(result)
 }
+
+// CallBatch executes a batch of calls against the local server.
+func (loc *Local) CallBatch(ctx context.Context, calls []BatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	req, err := batchRequest(&loc.Client, calls)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, ctxService, loc)
+	resp := loc.Server.Handle(ctx, req)
+	return setBatchResults(calls, req, resp)
+}
+
+// Notify executes a notification against the local server. Unlike remote
+// notifications, it blocks until the method returns.
+func (loc *Local) Notify(ctx context.Context, method string, params ...interface{}) error {
+	req, err := notification(&loc.Client, method, params...)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, ctxService, loc)
+	loc.Server.Handle(ctx, req)
+	return nil
+}
@@ -35,6 +35,8 @@ func methodArgTypes(methodType reflect.Type) (argTypes []reflect.Type, hasCtx bo
 func methodErrPos(methodType reflect.Type) (int, bool) {
 	switch methodType.NumOut() {
 	case 0:
+		// No return values, useful for notifications
+		return -1, true
 	case 1:
 		if methodType.Out(0) == typeOfError {
 			// Single error return value
@@ -139,11 +141,23 @@ type Method struct {
 	ArgTypes []reflect.Type
 	ErrPos   int
 	HasCtx   bool
+
+	// ParamNames are the names of the arguments (excluding the context), used
+	// for calls with named (by-object) params. If not set, named params are
+	// only supported by methods with a single struct argument. (Optional)
+	ParamNames []string
+}
+
+// parseArgs parses JSON-encoded args, which can be either positional
+// (array) or named (object). Trailing args which are nillable (such as
+// pointers) are optional and can be omitted.
+func (m *Method) parseArgs(rawArgs json.RawMessage) ([]reflect.Value, error) {
+	return parseArguments(rawArgs, m.ArgTypes, m.ParamNames)
 }
 
 // CallJSON wraps Call but supports JSON-encoded args
 func (m *Method) CallJSON(ctx context.Context, rawArgs json.RawMessage) (interface{}, error) {
-	args, err := parsePositionalArguments(rawArgs, m.ArgTypes)
+	args, err := m.parseArgs(rawArgs)
 	if err != nil {
 		return nil, err
 	}
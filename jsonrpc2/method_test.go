@@ -43,3 +43,70 @@ func TestMethodArgs(t *testing.T) {
 	}
 
 }
+
+func (s *SomeType) Greet(req SomeReq) string {
+	return req.Foo + " " + req.Bar
+}
+
+func (s *SomeType) Repeat(word string, times int, suffix *string) string {
+	r := ""
+	for i := 0; i < times; i++ {
+		r += word
+	}
+	if suffix != nil {
+		r += *suffix
+	}
+	return r
+}
+
+func TestMethodNamedArgs(t *testing.T) {
+	receiver := &SomeType{}
+
+	greet, err := MethodByName(receiver, "Greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := greet.CallJSON(context.Background(), json.RawMessage(`{"foo": "hello", "bar": "bye"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.(string), "hello bye"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+
+	repeat, err := MethodByName(receiver, "Repeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repeat.CallJSON(context.Background(), json.RawMessage(`{"word": "a", "times": 3}`)); err == nil {
+		t.Error("expected error for named args without param names")
+	}
+
+	repeat.ParamNames = []string{"word", "times", "suffix"}
+	testcases := []struct {
+		args string
+		want string
+		err  bool
+	}{
+		{`{"word": "a", "times": 3}`, "aaa", false},
+		{`{"times": 2, "word": "b", "suffix": "!"}`, "bb!", false},
+		{`{"word": "a"}`, "", true},
+		{`{"word": "a", "times": 1, "extra": true}`, "", true},
+		{`["c", 2]`, "cc", false},
+		{`["c"]`, "", true},
+	}
+	for _, tc := range testcases {
+		res, err := repeat.CallJSON(context.Background(), json.RawMessage(tc.args))
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got: %v", tc.args, res)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.args, err)
+		} else if got := res.(string); got != tc.want {
+			t.Errorf("%s: got %q; want %q", tc.args, got, tc.want)
+		}
+	}
+}
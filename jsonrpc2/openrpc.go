@@ -0,0 +1,254 @@
+package jsonrpc2
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenRPCVersion is the version of the OpenRPC specification that generated
+// documents conform to.
+const OpenRPCVersion = "1.2.6"
+
+// DiscoverMethod is the RPC method name that serves the OpenRPC document.
+const DiscoverMethod = "rpc_discover"
+
+// OpenRPCDocument describes the methods of a server, following the OpenRPC
+// specification: https://spec.open-rpc.org/
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []OpenRPCMethod   `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+}
+
+// OpenRPCInfo is the metadata about the API.
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenRPCMethod describes a single method.
+type OpenRPCMethod struct {
+	Name   string              `json:"name"`
+	Params []ContentDescriptor `json:"params"`
+	Result ContentDescriptor   `json:"result"`
+}
+
+// ContentDescriptor describes a param or result of a method.
+type ContentDescriptor struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// OpenRPCComponents contains the schemas of named struct types, which are
+// referenced by the method schemas.
+type OpenRPCComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Schema is the subset of JSON Schema used to describe Go types.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var typeOfTime = reflect.TypeOf(time.Time{})
+var typeOfBigInt = reflect.TypeOf(big.Int{})
+var typeOfRawMessage = reflect.TypeOf(json.RawMessage{})
+var typeOfJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var typeOfTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// OpenRPC returns an OpenRPC document describing the methods in the server's
+// registry, derived from the methods' argument and return types. Param names
+// are taken from SetParamNames when available.
+func (s *Server) OpenRPC(info OpenRPCInfo) *OpenRPCDocument {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.registry))
+	for name := range s.registry {
+		if name == DiscoverMethod {
+			continue
+		}
+		names = append(names, name)
+	}
+	methods := make([]Method, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		methods = append(methods, s.registry[name])
+	}
+	s.mu.Unlock()
+
+	doc := &OpenRPCDocument{
+		OpenRPC: OpenRPCVersion,
+		Info:    info,
+		Methods: make([]OpenRPCMethod, 0, len(methods)),
+		Components: OpenRPCComponents{
+			Schemas: map[string]*Schema{},
+		},
+	}
+	for i, m := range methods {
+		doc.Methods = append(doc.Methods, m.openRPC(names[i], doc.Components.Schemas))
+	}
+	return doc
+}
+
+// RegisterDiscover registers DiscoverMethod, which serves the OpenRPC document
+// of the server's registry.
+func (s *Server) RegisterDiscover(info OpenRPCInfo) error {
+	return s.RegisterMethod(DiscoverMethod, &Discovery{Server: s, Info: info}, "Discover")
+}
+
+// Discovery serves the OpenRPC document of a Server, see
+// Server.RegisterDiscover.
+type Discovery struct {
+	Server *Server
+	Info   OpenRPCInfo
+}
+
+// Discover returns the OpenRPC document.
+func (d *Discovery) Discover() *OpenRPCDocument {
+	return d.Server.OpenRPC(d.Info)
+}
+
+// openRPC describes the method, adding any named struct schemas to
+// components.
+func (m *Method) openRPC(name string, components map[string]*Schema) OpenRPCMethod {
+	r := OpenRPCMethod{
+		Name:   name,
+		Params: make([]ContentDescriptor, 0, len(m.ArgTypes)),
+		Result: ContentDescriptor{
+			Name:   "result",
+			Schema: &Schema{Type: "null"},
+		},
+	}
+
+	// Only trailing optional args can be omitted, see parseArguments
+	numRequired := len(m.ArgTypes)
+	for numRequired > 0 && isOptionalType(m.ArgTypes[numRequired-1]) {
+		numRequired--
+	}
+	for i, argType := range m.ArgTypes {
+		paramName := fmt.Sprintf("arg%d", i)
+		if i < len(m.ParamNames) {
+			paramName = m.ParamNames[i]
+		}
+		r.Params = append(r.Params, ContentDescriptor{
+			Name:     paramName,
+			Required: i < numRequired,
+			Schema:   typeSchema(argType, components),
+		})
+	}
+
+	methodType := m.Method.Type
+	if methodType.NumOut() > 0 && m.ErrPos != 0 {
+		r.Result.Schema = typeSchema(methodType.Out(0), components)
+	}
+	return r
+}
+
+// typeSchema returns the JSON Schema for how a type is encoded by
+// encoding/json. Named structs are added to components and referenced.
+func typeSchema(t reflect.Type, components map[string]*Schema) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case typeOfTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case typeOfBigInt:
+		return &Schema{Type: "integer"}
+	case typeOfRawMessage:
+		return &Schema{}
+	}
+	if t.Implements(typeOfJSONMarshaler) || reflect.PtrTo(t).Implements(typeOfJSONMarshaler) {
+		// Custom encoding, could be anything.
+		return &Schema{}
+	}
+	if t.Implements(typeOfTextMarshaler) || reflect.PtrTo(t).Implements(typeOfTextMarshaler) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: typeSchema(t.Elem(), components)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), components)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, components)
+		}
+		key := strings.Replace(t.String(), "*", "", -1)
+		if _, ok := components[key]; !ok {
+			// Reserve the key first, in case the struct is recursive.
+			components[key] = nil
+			components[key] = structSchema(t, components)
+		}
+		return &Schema{Ref: "#/components/schemas/" + key}
+	}
+	// Interfaces and anything else can be any value.
+	return &Schema{}
+}
+
+// structSchema returns the object schema of a struct's JSON fields.
+func structSchema(t reflect.Type, components map[string]*Schema) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{},
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				// Embedded struct fields are promoted
+				for k, v := range structSchema(fieldType, components).Properties {
+					if _, ok := schema.Properties[k]; !ok {
+						schema.Properties[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = typeSchema(field.Type, components)
+	}
+	return schema
+}
@@ -0,0 +1,64 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOpenRPC(t *testing.T) {
+	rpc := Local{}
+	s := &rpc.Server
+	if err := s.Register("", &SomeType{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetParamNames("repeat", "word", "times", "suffix"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterDiscover(OpenRPCInfo{Title: "test", Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	var doc OpenRPCDocument
+	if err := rpc.Call(context.Background(), &doc, DiscoverMethod); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenRPC != OpenRPCVersion || doc.Info.Title != "test" {
+		t.Errorf("unexpected document header: %+v", doc)
+	}
+
+	var names []string
+	for _, m := range doc.Methods {
+		names = append(names, m.Name)
+	}
+	if want := []string{"greet", "hello", "repeat"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got methods: %q; want %q", names, want)
+	}
+
+	repeat := doc.Methods[2]
+	got, err := json.Marshal(repeat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"name":"repeat","params":[{"name":"word","required":true,"schema":{"type":"string"}},{"name":"times","required":true,"schema":{"type":"integer"}},{"name":"suffix","schema":{"type":"string"}}],"result":{"name":"result","schema":{"type":"string"}}}`
+	if string(got) != want {
+		t.Errorf("wrong repeat method:\n  got: %s\n want: %s", got, want)
+	}
+
+	hello := doc.Methods[1]
+	if got, want := hello.Result.Schema.Ref, "#/components/schemas/jsonrpc2.SomeResp"; got != want {
+		t.Errorf("got result ref: %q; want %q", got, want)
+	}
+	if got, want := hello.Params[0].Name, "arg0"; got != want {
+		t.Errorf("got param name: %q; want %q", got, want)
+	}
+
+	req, ok := doc.Components.Schemas["jsonrpc2.SomeReq"]
+	if !ok {
+		t.Fatalf("missing component schema: %v", doc.Components.Schemas)
+	}
+	if req.Type != "object" || req.Properties["foo"].Type != "string" || len(req.Properties) != 2 {
+		t.Errorf("wrong component schema: %+v", req)
+	}
+}
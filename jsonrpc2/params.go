@@ -0,0 +1,95 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// isOptionalType returns true if arguments of this type can be omitted, in
+// which case they're set to their zero value (nil).
+func isOptionalType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return true
+	}
+	return false
+}
+
+// isStructType returns true if the type is a struct or a pointer to a struct.
+func isStructType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// isNamedArguments returns true if the raw args are a JSON object.
+func isNamedArguments(rawArgs json.RawMessage) bool {
+	rawArgs = bytes.TrimLeft(rawArgs, " \t\r\n")
+	return len(rawArgs) > 0 && rawArgs[0] == '{'
+}
+
+// parseArguments parses the raw args as either positional (array) or named
+// (object) arguments.
+func parseArguments(rawArgs json.RawMessage, types []reflect.Type, names []string) ([]reflect.Value, error) {
+	if isNamedArguments(rawArgs) {
+		return parseNamedArguments(rawArgs, types, names)
+	}
+	return parsePositionalArguments(rawArgs, types)
+}
+
+// parseNamedArguments parses a JSON object of args. If names are provided,
+// then each key is mapped to the argument with the same name. Otherwise, the
+// object is decoded into the only argument, which must be a struct.
+func parseNamedArguments(rawArgs json.RawMessage, types []reflect.Type, names []string) ([]reflect.Value, error) {
+	if len(names) == 0 {
+		if len(types) != 1 || !isStructType(types[0]) {
+			return nil, &invalidParamsError{"named arguments are not supported by this method"}
+		}
+		argval := reflect.New(types[0])
+		if err := json.Unmarshal(rawArgs, argval.Interface()); err != nil {
+			return nil, &invalidParamsError{fmt.Sprintf("invalid argument: %v", err)}
+		}
+		return []reflect.Value{argval.Elem()}, nil
+	}
+
+	if len(names) != len(types) {
+		return nil, &invalidParamsError{fmt.Sprintf("wrong number of parameter names, want %d", len(types))}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rawArgs, &fields); err != nil {
+		return nil, &invalidParamsError{fmt.Sprintf("invalid arguments: %v", err)}
+	}
+
+	args := make([]reflect.Value, 0, len(types))
+	for i, name := range names {
+		raw, ok := fields[name]
+		if !ok {
+			if !isOptionalType(types[i]) {
+				return nil, &invalidParamsError{fmt.Sprintf("missing value for required argument %q", name)}
+			}
+			args = append(args, reflect.Zero(types[i]))
+			continue
+		}
+		delete(fields, name)
+		argval := reflect.New(types[i])
+		if err := json.Unmarshal(raw, argval.Interface()); err != nil {
+			return nil, &invalidParamsError{fmt.Sprintf("invalid argument %q: %v", name, err)}
+		}
+		args = append(args, argval.Elem())
+	}
+
+	if len(fields) > 0 {
+		unknown := make([]string, 0, len(fields))
+		for name := range fields {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, &invalidParamsError{fmt.Sprintf("unknown arguments: %q", unknown)}
+	}
+	return args, nil
+}
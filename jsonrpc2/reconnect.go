@@ -0,0 +1,233 @@
+package jsonrpc2
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 5 * time.Minute
+)
+
+// DialFunc opens a new connection and returns its Codec.
+type DialFunc func(ctx context.Context) (Codec, error)
+
+var _ BatchService = &ReconnectingRemote{}
+var _ Notifier = &ReconnectingRemote{}
+
+// ReconnectingRemote is a Service over a connection which is re-dialed
+// whenever it is lost. The Server is kept across connections, so that the
+// other side can continue making reverse calls after reconnecting.
+//
+// Calls made while disconnected fail with ErrConnectionClosed.
+type ReconnectingRemote struct {
+	Dial   DialFunc
+	Client Requester
+	Server Handler
+
+	// MinBackoff is the delay before the first re-dial attempt, which doubles
+	// after every failed attempt up to MaxBackoff. Each delay is jittered by
+	// up to half of its duration. Defaults to 1 second and 5 minutes.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnReconnect is called in its own goroutine after the connection is
+	// re-established, which is a good time to re-register any state that the
+	// other side lost with the old connection. (Optional)
+	OnReconnect func()
+
+	initOnce sync.Once
+	closeCh  chan struct{}
+
+	mu          sync.Mutex
+	remote      *Remote
+	closed      bool
+	delayRedial time.Duration // delayRedial is the minimum delay before the next re-dial, see DelayReconnect.
+}
+
+func (r *ReconnectingRemote) init() {
+	r.initOnce.Do(func() {
+		r.closeCh = make(chan struct{})
+		if r.Client == nil {
+			r.Client = &Client{}
+		}
+	})
+}
+
+// Connect dials the initial connection. It is called by Serve if it was not
+// called before, but calling it first allows failing early.
+func (r *ReconnectingRemote) Connect(ctx context.Context) error {
+	r.init()
+	codec, err := r.Dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		codec.Close()
+		return ErrConnectionClosed
+	}
+	r.remote = &Remote{
+		Codec:  codec,
+		Client: r.Client,
+		Server: r.Server,
+	}
+	return nil
+}
+
+// Serve handles the current connection and re-dials it whenever it is lost.
+// It blocks until Close is called.
+func (r *ReconnectingRemote) Serve() error {
+	r.init()
+	if r.current() == nil {
+		if err := r.Connect(context.Background()); err == ErrConnectionClosed {
+			return nil
+		} else if err != nil {
+			logger.Printf("ReconnectingRemote: Failed to connect, retrying: %s", err)
+			if err := r.redial(); err != nil {
+				return nil
+			}
+		}
+	}
+
+	for {
+		remote := r.current()
+		if remote == nil {
+			// Closed
+			return nil
+		}
+		err := remote.Serve()
+		remote.Codec.Close()
+
+		r.mu.Lock()
+		r.remote = nil
+		closed := r.closed
+		r.mu.Unlock()
+		if closed {
+			return nil
+		}
+
+		logger.Printf("ReconnectingRemote: Connection lost, reconnecting: %s", err)
+		if err := r.redial(); err != nil {
+			return nil
+		}
+		if r.OnReconnect != nil {
+			go r.OnReconnect()
+		}
+	}
+}
+
+// redial retries dialing with backoff until it succeeds, or fails with
+// ErrConnectionClosed if Close is called first.
+func (r *ReconnectingRemote) redial() error {
+	backoff := r.MinBackoff
+	if backoff <= 0 {
+		backoff = defaultMinBackoff
+	}
+	maxBackoff := r.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	r.mu.Lock()
+	minDelay := r.delayRedial
+	r.delayRedial = 0
+	r.mu.Unlock()
+
+	for {
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if delay < minDelay {
+			delay = minDelay
+		}
+		minDelay = 0
+		select {
+		case <-time.After(delay):
+		case <-r.closeCh:
+			return ErrConnectionClosed
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-r.closeCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err := r.Connect(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		} else if err == ErrConnectionClosed {
+			return err
+		}
+
+		logger.Printf("ReconnectingRemote: Failed to reconnect, retrying: %s", err)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// DelayReconnect makes the next re-dial wait for at least the delay, such as
+// when the other side announced that it's going away and suggested when to
+// come back.
+func (r *ReconnectingRemote) DelayReconnect(delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delayRedial = delay
+}
+
+func (r *ReconnectingRemote) current() *Remote {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remote
+}
+
+// Close closes the current connection and stops reconnecting.
+func (r *ReconnectingRemote) Close() error {
+	r.init()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.closeCh)
+	if r.remote != nil {
+		return r.remote.Codec.Close()
+	}
+	return nil
+}
+
+// Call sends an RPC over the current connection.
+func (r *ReconnectingRemote) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	remote := r.current()
+	if remote == nil {
+		return ErrConnectionClosed
+	}
+	return remote.Call(ctx, result, method, params...)
+}
+
+// CallBatch sends a batch of calls over the current connection.
+func (r *ReconnectingRemote) CallBatch(ctx context.Context, calls []BatchCall) error {
+	remote := r.current()
+	if remote == nil {
+		return ErrConnectionClosed
+	}
+	return remote.CallBatch(ctx, calls)
+}
+
+// Notify sends a notification over the current connection.
+func (r *ReconnectingRemote) Notify(ctx context.Context, method string, params ...interface{}) error {
+	remote := r.current()
+	if remote == nil {
+		return ErrConnectionClosed
+	}
+	return remote.Notify(ctx, method, params...)
+}
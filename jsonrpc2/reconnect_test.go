@@ -0,0 +1,143 @@
+package jsonrpc2
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconnectingRemote(t *testing.T) {
+	var mu sync.Mutex
+	var servers []*Remote
+	var conns []net.Conn
+	dial := func(ctx context.Context) (Codec, error) {
+		c1, c2 := net.Pipe()
+		server := &Remote{Codec: IOCodec(c2), Client: &Client{}, Server: &Server{}}
+		server.Server.(*Server).Register("", &FruitService{})
+		go server.Serve()
+
+		mu.Lock()
+		servers = append(servers, server)
+		conns = append(conns, c2)
+		mu.Unlock()
+		return IOCodec(c1), nil
+	}
+
+	listener := &Listener{Received: make(chan string, 2)}
+	reconnected := make(chan struct{}, 1)
+	client := &ReconnectingRemote{
+		Dial:       dial,
+		Server:     &Server{},
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Millisecond * 10,
+		OnReconnect: func() {
+			reconnected <- struct{}{}
+		},
+	}
+	client.Server.(*Server).Register("", listener)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- client.Serve()
+	}()
+
+	var got string
+	if err := client.Call(context.Background(), &got, "apple"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the connection from the other side
+	mu.Lock()
+	conns[0].Close()
+	mu.Unlock()
+
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+
+	if err := client.Call(context.Background(), &got, "apple"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Apple"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+
+	// Reverse calls are still handled on the new connection
+	mu.Lock()
+	server := servers[len(servers)-1]
+	mu.Unlock()
+	if err := server.Call(context.Background(), nil, "announce", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-listener.Received, "hello"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Error(err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("unexpected serve error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+	if err := client.Call(context.Background(), &got, "apple"); err != ErrConnectionClosed {
+		t.Errorf("expected ErrConnectionClosed, got: %v", err)
+	}
+}
+
+func TestReconnectingRemoteDelay(t *testing.T) {
+	var mu sync.Mutex
+	var conns []net.Conn
+	dial := func(ctx context.Context) (Codec, error) {
+		c1, c2 := net.Pipe()
+		server := &Remote{Codec: IOCodec(c2), Client: &Client{}, Server: &Server{}}
+		go server.Serve()
+
+		mu.Lock()
+		conns = append(conns, c2)
+		mu.Unlock()
+		return IOCodec(c1), nil
+	}
+
+	reconnected := make(chan struct{}, 1)
+	client := &ReconnectingRemote{
+		Dial:       dial,
+		Server:     &Server{},
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Millisecond * 10,
+		OnReconnect: func() {
+			reconnected <- struct{}{}
+		},
+	}
+	defer client.Close()
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	go client.Serve()
+
+	delay := time.Millisecond * 100
+	client.DelayReconnect(delay)
+	dropped := time.Now()
+	mu.Lock()
+	conns[0].Close()
+	mu.Unlock()
+
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	if elapsed := time.Since(dropped); elapsed < delay {
+		t.Errorf("reconnected too early: %s < %s", elapsed, delay)
+	}
+}
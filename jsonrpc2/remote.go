@@ -3,14 +3,12 @@ package jsonrpc2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
-	"time"
 )
 
-// TODO: Handle batch?
-
 // ServePipe sets up symmetric server/clients over a net.Pipe() and starts
 // both in goroutines. Useful for testing. Services still need to be registered.
 // FIXME: This is a testing helper, ideally we want to get rid of it. It leaks
@@ -55,12 +53,49 @@ func CtxService(ctx context.Context) (Service, error) {
 	return s, nil
 }
 
+// CtxSetValue stores a connection-scoped value on the Remote that is serving
+// the call in ctx. The value is visible to the context of this call and all
+// subsequent calls on the same connection, which is useful for remembering
+// things like an authenticated identity.
+func CtxSetValue(ctx context.Context, key, value interface{}) error {
+	r, ok := ctx.Value(ctxService).(*Remote)
+	if !ok {
+		return ContextMissingValueError{ctxService}
+	}
+	r.SetValue(key, value)
+	return nil
+}
+
+// connContext is a handler context which also includes the connection-scoped
+// values of a Remote.
+type connContext struct {
+	context.Context
+	remote *Remote
+}
+
+func (ctx connContext) Value(key interface{}) interface{} {
+	if value, ok := ctx.remote.value(key); ok {
+		return value
+	}
+	return ctx.Context.Value(key)
+}
+
+// ErrConnectionClosed is returned by calls on a Remote whose connection was
+// closed before a response was received.
+var ErrConnectionClosed = errors.New("jsonrpc2: connection closed")
+
+// CancelMethod is the notification sent by a Remote when the context of a call
+// is cancelled before its response is received, with the ID of the call as the
+// only param. The receiving Remote cancels the context of the handler.
+const CancelMethod = "rpc_cancel"
+
 // Service represents a remote service that can be called.
 type Service interface {
 	Call(ctx context.Context, result interface{}, method string, params ...interface{}) error
 }
 
-var _ Service = &Remote{}
+var _ BatchService = &Remote{}
+var _ Notifier = &Remote{}
 
 // TODO: Make Remote private with a Remote() helper?
 
@@ -72,77 +107,287 @@ type Remote struct {
 	Client Requester
 	Server Handler
 
-	// PendingLimit is the number of messages to hold before oldest messages get discarded.
-	PendingLimit int
-	// PendingDiscard is the number of oldest messages that get discarded when PendingLimit is reached.
+	// MaxConcurrent is the maximum number of requests from the remote that
+	// are handled concurrently (optional). Each entry of a batch counts as a
+	// request. Requests beyond the limit are rejected with
+	// ErrCodeLimitExceeded, including whole batches that don't fit.
+	MaxConcurrent int
+
+	// PendingLimit and PendingDiscard have no effect, pending calls are
+	// removed when they complete or when the connection closes.
+	// DEPRECATED: Kept for compatibility, will be removed.
+	PendingLimit   int
 	PendingDiscard int
 
-	mu      sync.Mutex
-	pending map[string]pendingMsg
+	mu       sync.Mutex
+	active   int
+	pending  map[string]chan *Message
+	closed   bool
+	values   map[interface{}]interface{}
+	inflight map[string]context.CancelFunc
 }
 
-// clearPending removes num oldest entries, must hold the r.mu lock.
-func (r *Remote) cleanPending(num int) {
-	// Clear oldest entries
-	for _, item := range pendingOldest(r.pending, num) {
-		delete(r.pending, item.key)
+// SetValue stores a connection-scoped value which is visible to the contexts
+// of all handler calls on this Remote.
+func (r *Remote) SetValue(key, value interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values == nil {
+		r.values = map[interface{}]interface{}{}
 	}
+	r.values[key] = value
 }
 
-func (r *Remote) getPendingChan(key string) chan Message {
+func (r *Remote) value(key interface{}) (interface{}, bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	value, ok := r.values[key]
+	return value, ok
+}
+
+// addPending registers a call which is waiting for a response with the given
+// ID. It fails with ErrConnectionClosed if the Remote is no longer serving.
+func (r *Remote) addPending(ID json.RawMessage) (chan *Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrConnectionClosed
+	}
 	if r.pending == nil {
-		r.pending = map[string]pendingMsg{}
+		r.pending = map[string]chan *Message{}
 	}
-	if r.PendingLimit > 0 && len(r.pending) >= r.PendingLimit && r.PendingDiscard > 0 {
-		r.cleanPending(r.PendingDiscard)
+	msgChan := make(chan *Message, 1)
+	r.pending[string(ID)] = msgChan
+	return msgChan, nil
+}
+
+// removePending unregisters calls, for when they're no longer waiting.
+func (r *Remote) removePending(IDs ...json.RawMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ID := range IDs {
+		delete(r.pending, string(ID))
 	}
+}
 
-	pending, ok := r.pending[key]
-	if !ok {
-		pending = pendingMsg{
-			msgChan:   make(chan Message, 1),
-			timestamp: time.Now(),
-		}
-		r.pending[key] = pending
+// closePending fails all of the pending calls with ErrConnectionClosed, and
+// any new calls until the Remote is served again.
+func (r *Remote) closePending() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for _, msgChan := range r.pending {
+		close(msgChan)
 	}
-	return pending.msgChan
+	r.pending = nil
 }
 
-func (r *Remote) handleRequest(msg *Message) error {
-	ctx := context.WithValue(context.Background(), ctxService, r)
+func (r *Remote) handleRequest(ctx context.Context, msg *Message) error {
+	ctx = connContext{context.WithValue(ctx, ctxService, r), r}
+	if !msg.IsBatch() && !msg.IsNotification() {
+		// Single calls can be cancelled by the caller
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		key := string(msg.ID)
+		r.mu.Lock()
+		if r.inflight == nil {
+			r.inflight = map[string]context.CancelFunc{}
+		}
+		r.inflight[key] = cancel
+		r.mu.Unlock()
+
+		defer func() {
+			r.mu.Lock()
+			delete(r.inflight, key)
+			r.mu.Unlock()
+		}()
+	}
 	resp := r.Server.Handle(ctx, msg)
+	if resp == nil {
+		// Notifications don't get a response
+		return nil
+	}
 	return r.Codec.WriteMessage(resp)
 }
 
+// Serve reads messages from the codec until it fails, handling requests and
+// routing responses to pending calls. It is equivalent to
+// ServeContext(context.Background()).
 func (r *Remote) Serve() error {
+	return r.ServeContext(context.Background())
+}
+
+// ServeContext is like Serve, but handler contexts are derived from ctx. The
+// handler contexts are cancelled once ServeContext returns, so that handlers
+// can stop working on behalf of a connection which has been closed.
+//
+// Once ServeContext returns, any calls still waiting for a response fail with
+// ErrConnectionClosed.
+func (r *Remote) ServeContext(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r.mu.Lock()
+	r.closed = false
+	r.mu.Unlock()
+	defer r.closePending()
+
 	for {
 		msg, err := r.Codec.ReadMessage()
 		if err != nil {
 			return err
 		}
-		if msg.Request != nil {
-			// FIXME: Anything we can do with error handling here?
-			go r.handleRequest(msg)
-		} else if len(msg.ID) > 0 {
-			r.getPendingChan(string(msg.ID)) <- *msg
+		if msg.IsBatch() && isResponseBatch(msg) {
+			for _, resp := range msg.Batch {
+				r.routeResponse(resp)
+			}
+		} else if msg.IsNotification() && msg.Request.Method == CancelMethod {
+			r.cancelInflight(msg.Request.Params)
+		} else if msg.IsBatch() || msg.Request != nil {
+			n := 1
+			if msg.IsBatch() && len(msg.Batch) > 0 {
+				// Batch entries are handled concurrently
+				n = len(msg.Batch)
+			}
+			if !r.acquire(n) {
+				r.reject(msg, LimitExceededError{Limit: r.MaxConcurrent})
+				continue
+			}
+			go func(msg *Message, n int) {
+				defer r.release(n)
+				// FIXME: Anything we can do with error handling here?
+				r.handleRequest(ctx, msg)
+			}(msg, n)
 		} else {
-			logger.Printf("Remote.Serve(): Dropping invalid message: %s", msg)
+			r.routeResponse(msg)
+		}
+	}
+}
+
+// routeResponse delivers a response message to the pending call that is
+// waiting for it. Responses that nobody is waiting for are dropped.
+func (r *Remote) routeResponse(msg *Message) {
+	if len(msg.ID) == 0 || string(msg.ID) == string(nullID) {
+		logger.Printf("Remote.Serve(): Dropping invalid message: %s", msg)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := string(msg.ID)
+	msgChan, ok := r.pending[key]
+	if !ok {
+		logger.Printf("Remote.Serve(): Dropping unexpected response: %s", msg)
+		return
+	}
+	delete(r.pending, key)
+	msgChan <- msg
+}
+
+// acquire reserves n slots for handling requests, returns false if they
+// would exceed MaxConcurrent.
+func (r *Remote) acquire(n int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.MaxConcurrent > 0 && r.active+n > r.MaxConcurrent {
+		return false
+	}
+	r.active += n
+	return true
+}
+
+func (r *Remote) release(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active -= n
+}
+
+// reject responds to a request with an error without handling it.
+// Notifications are dropped.
+func (r *Remote) reject(msg *Message, err error) {
+	errResp := func(req *Message) *Message {
+		if req.IsNotification() {
+			return nil
+		}
+		ID := req.ID
+		if len(ID) == 0 {
+			ID = nullID
+		}
+		return &Message{
+			Response: &Response{
+				Error: errResponse(err),
+			},
+			ID:      ID,
+			Version: Version,
+		}
+	}
+
+	var resp *Message
+	if msg.IsBatch() {
+		resp = &Message{
+			Batch: make([]*Message, 0, len(msg.Batch)),
+		}
+		for _, entry := range msg.Batch {
+			if m := errResp(entry); m != nil {
+				resp.Batch = append(resp.Batch, m)
+			}
+		}
+		if len(resp.Batch) == 0 {
+			resp = nil
+		}
+	} else {
+		resp = errResp(msg)
+	}
+
+	if resp == nil {
+		logger.Printf("Remote.Serve(): Dropping rejected notification: %s", err)
+		return
+	}
+	if err := r.Codec.WriteMessage(resp); err != nil {
+		logger.Printf("Remote.Serve(): Failed to write rejection: %s", err)
+	}
+}
+
+// cancelInflight cancels the context of the in-flight call with the ID given
+// in the params of a CancelMethod notification.
+func (r *Remote) cancelInflight(params json.RawMessage) {
+	var ids []json.RawMessage
+	if err := json.Unmarshal(params, &ids); err != nil || len(ids) != 1 {
+		logger.Printf("Remote.Serve(): Dropping invalid cancel notification: %s", params)
+		return
+	}
+	r.mu.Lock()
+	cancel, ok := r.inflight[string(ids[0])]
+	r.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// isResponseBatch returns true if every message in the batch is a response.
+func isResponseBatch(msg *Message) bool {
+	if len(msg.Batch) == 0 {
+		return false
+	}
+	for _, entry := range msg.Batch {
+		if entry.Request != nil || entry.Response == nil {
+			return false
 		}
 	}
+	return true
 }
 
-// receive blocks until the given message ID is received. Use Call for an
-// end-to-end solution.
-func (r *Remote) receive(ctx context.Context, ID json.RawMessage) (*Message, error) {
-	key := string(ID)
+// receive blocks until the pending call's response is received. Use Call for
+// an end-to-end solution.
+func (r *Remote) receive(ctx context.Context, msgChan chan *Message) (*Message, error) {
 	select {
-	case msg := <-r.getPendingChan(key):
-		r.mu.Lock()
-		delete(r.pending, key)
-		r.mu.Unlock()
-		return &msg, nil
+	case msg, ok := <-msgChan:
+		if !ok {
+			return nil, ErrConnectionClosed
+		}
+		return msg, nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
@@ -157,12 +402,78 @@ func (r *Remote) Call(ctx context.Context, result interface{}, method string, pa
 	if err != nil {
 		return err
 	}
+	msgChan, err := r.addPending(req.ID)
+	if err != nil {
+		return err
+	}
+	defer r.removePending(req.ID)
 	if err = r.Codec.WriteMessage(req); err != nil {
 		return err
 	}
-	resp, err := r.receive(ctx, req.ID)
+	resp, err := r.receive(ctx, msgChan)
 	if err != nil {
+		if ctx.Err() != nil {
+			// Let the remote know that we're no longer waiting, so it can
+			// stop working on the call.
+			if err := r.Notify(context.Background(), CancelMethod, req.ID); err != nil {
+				logger.Printf("Remote.Call(): Failed to send cancel notification: %s", err)
+			}
+		}
 		return err
 	}
 	return resp.UnmarshalResult(result)
 }
+
+// Notify sends a notification to the remote, which will not be responded to.
+func (r *Remote) Notify(ctx context.Context, method string, params ...interface{}) error {
+	if r.Client == nil {
+		r.Client = &Client{}
+	}
+	msg, err := notification(r.Client, method, params...)
+	if err != nil {
+		return err
+	}
+	return r.Codec.WriteMessage(msg)
+}
+
+// CallBatch sends a batch of calls in a single message and receives the
+// corresponding responses synchronously.
+func (r *Remote) CallBatch(ctx context.Context, calls []BatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	if r.Client == nil {
+		r.Client = &Client{}
+	}
+	req, err := batchRequest(r.Client, calls)
+	if err != nil {
+		return err
+	}
+	IDs := make([]json.RawMessage, 0, len(req.Batch))
+	msgChans := make([]chan *Message, 0, len(req.Batch))
+	defer func() {
+		r.removePending(IDs...)
+	}()
+	for _, msg := range req.Batch {
+		msgChan, err := r.addPending(msg.ID)
+		if err != nil {
+			return err
+		}
+		IDs = append(IDs, msg.ID)
+		msgChans = append(msgChans, msgChan)
+	}
+	if err = r.Codec.WriteMessage(req); err != nil {
+		return err
+	}
+	resp := &Message{
+		Batch: make([]*Message, 0, len(req.Batch)),
+	}
+	for _, msgChan := range msgChans {
+		m, err := r.receive(ctx, msgChan)
+		if err != nil {
+			return err
+		}
+		resp.Batch = append(resp.Batch, m)
+	}
+	return setBatchResults(calls, req, resp)
+}
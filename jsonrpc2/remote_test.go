@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"net"
 	"reflect"
-	"sort"
 	"testing"
 	"time"
 
@@ -109,39 +108,80 @@ func TestRemoteContextService(t *testing.T) {
 	}
 }
 
-func TestRemoteCleanPending(t *testing.T) {
-	r := Remote{
-		PendingLimit:   5,
-		PendingDiscard: 3,
-	}
-	now := time.Now().Add(-time.Second * 100)
-	r.pending = map[string]pendingMsg{
-		"1": pendingMsg{timestamp: now.Add(time.Second * 1)},
-		"2": pendingMsg{timestamp: now.Add(time.Second * 2)},
-		"3": pendingMsg{timestamp: now.Add(time.Second * 3)},
-		"4": pendingMsg{timestamp: now.Add(time.Second * 4)},
-		"5": pendingMsg{timestamp: now.Add(time.Second * 5)},
+func TestRemoteClosePending(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	s1 := Server{}
+	client := Remote{Codec: IOCodec(conn1), Client: &Client{}, Server: &Server{}}
+	server := Remote{Codec: IOCodec(conn2), Client: &Client{}, Server: &s1}
+
+	waiter := &Waiter{Started: make(chan struct{}), Stopped: make(chan error, 1)}
+	s1.Register("", waiter)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- client.Serve()
+	}()
+	go server.Serve()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Call(context.Background(), nil, "wait")
+	}()
+	<-waiter.Started
+
+	conn2.Close()
+	<-serveErr
+
+	// In-flight calls fail as soon as the connection is closed
+	select {
+	case err := <-errCh:
+		if err != ErrConnectionClosed {
+			t.Errorf("unexpected call error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight call did not fail after the connection closed")
 	}
 
-	if want, got := 5, len(r.pending); got != want {
-		t.Errorf("got: %d; want: %d", got, want)
+	// New calls fail immediately
+	if err := client.Call(context.Background(), nil, "wait"); err != ErrConnectionClosed {
+		t.Errorf("unexpected call error: %v", err)
 	}
 
-	// Should trigger a cleanup of 3, add 1.
-	r.getPendingChan("6")
-	if want, got := 3, len(r.pending); got != want {
-		t.Errorf("got: %d; want: %d", got, want)
+	client.mu.Lock()
+	numPending := len(client.pending)
+	client.mu.Unlock()
+	if numPending != 0 {
+		t.Errorf("unexpected pending calls: %d", numPending)
 	}
+}
+
+func TestRemoteUnexpectedResponse(t *testing.T) {
+	server, client := ServePipe()
+	server.Server.Register("", &FruitService{})
 
-	keys := []string{}
-	for k, _ := range r.pending {
-		keys = append(keys, k)
+	// Nobody is waiting for this response, so it should be dropped
+	if err := server.WriteMessage(&Message{
+		ID:       json.RawMessage(`"unexpected"`),
+		Version:  Version,
+		Response: &Response{Result: json.RawMessage(`"surprise"`)},
+	}); err != nil {
+		t.Fatal(err)
 	}
-	sort.Strings(keys)
 
-	if want, got := []string{"4", "5", "6"}, keys; !reflect.DeepEqual(got, want) {
+	var got string
+	if err := client.Call(context.Background(), &got, "apple"); err != nil {
+		t.Error(err)
+	}
+	if want := "Apple"; got != want {
 		t.Errorf("got: %q; want %q", got, want)
 	}
+
+	client.mu.Lock()
+	numPending := len(client.pending)
+	client.mu.Unlock()
+	if numPending != 0 {
+		t.Errorf("unexpected pending calls: %d", numPending)
+	}
 }
 
 func TestRemoteServeInvalid(t *testing.T) {
@@ -155,3 +195,226 @@ func TestRemoteServeInvalid(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRemoteBatch(t *testing.T) {
+	server, client := ServePipe()
+	server.Server.Register("", &FruitService{})
+
+	var apple, cherry string
+	calls := []BatchCall{
+		{Method: "apple", Result: &apple},
+		{Method: "durian"},
+		{Method: "cherry", Result: &cherry},
+	}
+	if err := client.CallBatch(context.Background(), calls); err != nil {
+		t.Fatal(err)
+	}
+	if apple != "Apple" || cherry != "Cherry" {
+		t.Errorf("wrong results: %q, %q", apple, cherry)
+	}
+	if calls[1].Error == nil || calls[1].Error.Error() != "durian failure" {
+		t.Errorf("unexpected error: %v", calls[1].Error)
+	}
+}
+
+func TestRemoteNotify(t *testing.T) {
+	server, client := ServePipe()
+	listener := &Listener{Received: make(chan string, 1)}
+	server.Server.Register("", listener)
+	server.Server.Register("", &FruitService{})
+
+	if err := client.Notify(context.Background(), "announce", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-listener.Received:
+		if want := "hello"; got != want {
+			t.Errorf("got: %q; want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+
+	// Calls still work after a notification, and no stray response was
+	// queued up for them.
+	var got string
+	if err := client.Call(context.Background(), &got, "apple"); err != nil {
+		t.Error(err)
+	}
+	if want := "Apple"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+	client.mu.Lock()
+	numPending := len(client.pending)
+	client.mu.Unlock()
+	if numPending != 0 {
+		t.Errorf("unexpected pending messages: %d", numPending)
+	}
+}
+
+func TestRemoteServeContext(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	s1 := Server{}
+	client := Remote{Codec: IOCodec(conn1), Client: &Client{}, Server: &Server{}}
+	server := Remote{Codec: IOCodec(conn2), Client: &Client{}, Server: &s1}
+
+	waiter := &Waiter{Started: make(chan struct{}), Stopped: make(chan error, 1)}
+	s1.Register("", waiter)
+
+	go client.Serve()
+	go server.Serve()
+
+	go client.Call(context.Background(), nil, "wait")
+	<-waiter.Started
+
+	// Handlers are cancelled when the connection is closed
+	conn1.Close()
+	select {
+	case err := <-waiter.Stopped:
+		if err != context.Canceled {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("handler was not cancelled after the connection closed")
+	}
+}
+
+func TestRemoteCancel(t *testing.T) {
+	server, client := ServePipe()
+	waiter := &Waiter{Started: make(chan struct{}), Stopped: make(chan error, 1)}
+	server.Server.Register("", waiter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Call(ctx, nil, "wait")
+	}()
+	<-waiter.Started
+	cancel()
+
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("unexpected call error: %v", err)
+	}
+	select {
+	case err := <-waiter.Stopped:
+		if err != context.Canceled {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("handler was not cancelled by the caller")
+	}
+}
+
+func TestRemoteSetValue(t *testing.T) {
+	server, client := ServePipe()
+	server.Server.Register("", &Session{})
+
+	var got string
+	if err := client.Call(context.Background(), &got, "whoami"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("unexpected session before login: %q", got)
+	}
+	if err := client.Call(context.Background(), nil, "login", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(context.Background(), &got, "whoami"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+
+	// Values are scoped to the connection
+	server2, client2 := ServePipe()
+	server2.Server.Register("", &Session{})
+	if err := client2.Call(context.Background(), &got, "whoami"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("unexpected session on another connection: %q", got)
+	}
+}
+
+func TestRemoteMaxConcurrent(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	defer conn1.Close()
+	s1 := Server{}
+	client := Remote{Codec: IOCodec(conn1), Client: &Client{}, Server: &Server{}}
+	server := Remote{Codec: IOCodec(conn2), Client: &Client{}, Server: &s1, MaxConcurrent: 1}
+
+	waiter := &Waiter{Started: make(chan struct{}), Stopped: make(chan error, 1)}
+	s1.Register("", waiter)
+	s1.Register("", &FruitService{})
+
+	go client.Serve()
+	go server.Serve()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go client.Call(ctx, nil, "wait")
+	<-waiter.Started
+
+	if err := client.Call(context.Background(), nil, "apple"); !IsErrorCode(err, ErrCodeLimitExceeded) {
+		t.Errorf("expected limit exceeded error, got: %v", err)
+	}
+
+	calls := []BatchCall{{Method: "apple"}, {Method: "cherry"}}
+	if err := client.CallBatch(context.Background(), calls); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range calls {
+		if !IsErrorCode(call.Error, ErrCodeLimitExceeded) {
+			t.Errorf("expected limit exceeded error for %s, got: %v", call.Method, call.Error)
+		}
+	}
+
+	cancel()
+	<-waiter.Stopped
+	deadline := time.Now().Add(time.Second)
+	for {
+		var got string
+		err := client.Call(context.Background(), &got, "apple")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call failed after limit was freed: %s", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRemoteMaxConcurrentBatch(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	defer conn1.Close()
+	s1 := Server{}
+	client := Remote{Codec: IOCodec(conn1), Client: &Client{}, Server: &Server{}}
+	server := Remote{Codec: IOCodec(conn2), Client: &Client{}, Server: &s1, MaxConcurrent: 2}
+	s1.Register("", &FruitService{})
+
+	go client.Serve()
+	go server.Serve()
+
+	// Each batch entry counts against the limit
+	calls := []BatchCall{{Method: "apple"}, {Method: "banana"}, {Method: "cherry"}}
+	if err := client.CallBatch(context.Background(), calls); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range calls {
+		if !IsErrorCode(call.Error, ErrCodeLimitExceeded) {
+			t.Errorf("expected limit exceeded error for %s, got: %v", call.Method, call.Error)
+		}
+	}
+
+	var apple, cherry string
+	calls = []BatchCall{{Method: "apple", Result: &apple}, {Method: "cherry", Result: &cherry}}
+	if err := client.CallBatch(context.Background(), calls); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range calls {
+		if call.Error != nil {
+			t.Errorf("unexpected error for %s: %s", call.Method, call.Error)
+		}
+	}
+}
@@ -29,8 +29,54 @@ var _ Handler = &Server{}
 
 // Server contains the method registry.
 type Server struct {
-	mu       sync.Mutex
-	registry map[string]Method
+	mu           sync.Mutex
+	registry     map[string]Method
+	interceptors []Interceptor
+}
+
+// Use adds interceptors which wrap every method call handled by the server.
+// Interceptors are called in the order they were added, so the first one is
+// the outermost.
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+// handler returns the HandlerFunc for method calls, wrapped by the
+// interceptors.
+func (s *Server) handler() HandlerFunc {
+	s.mu.Lock()
+	interceptors := s.interceptors
+	s.mu.Unlock()
+
+	h := s.call
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		h = interceptors[i](h)
+	}
+	return h
+}
+
+// call looks up the method in the registry and calls it with the params.
+func (s *Server) call(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	m, ok := s.registry[method]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, &serverError{ErrResponse{
+			Code:    ErrCodeMethodNotFound,
+			Message: fmt.Sprintf("method not found: %s", method),
+		}}
+	}
+	args, err := m.parseArgs(params)
+	if err != nil {
+		return nil, &serverError{ErrResponse{
+			Code:    ErrCodeInvalidParams,
+			Message: fmt.Sprintf("invalid params for %s: %s", method, err),
+		}}
+	}
+	return m.Call(ctx, args)
 }
 
 // Register adds valid methods from the receiver to the registry with the given
@@ -99,8 +145,45 @@ func (s *Server) RegisterMethod(rpcName string, receiver interface{}, methodName
 	return nil
 }
 
-// Handle executes a request message against the server registry.
+// SetParamNames assigns names to the arguments of a registered method, in the
+// order of the arguments (excluding the context). This allows the method to be
+// called with named (by-object) params.
+func (s *Server) SetParamNames(rpcName string, names ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.registry[rpcName]
+	if !ok {
+		return fmt.Errorf("method not found: %s", rpcName)
+	}
+	if len(names) != len(m.ArgTypes) {
+		return fmt.Errorf("wrong number of param names for method %s: expected %d, got %d", rpcName, len(m.ArgTypes), len(names))
+	}
+	m.ParamNames = names
+	s.registry[rpcName] = m
+	return nil
+}
+
+// Handle executes a request message against the server registry. Batch
+// requests are executed concurrently and return a batch response.
+// Notifications are executed but return a nil response, as do batches which
+// only contain notifications.
 func (s *Server) Handle(ctx context.Context, req *Message) *Message {
+	if req.IsBatch() {
+		return s.handleBatch(ctx, req)
+	}
+	resp := s.handle(ctx, req)
+	if req.IsNotification() {
+		if resp.Error != nil {
+			logger.Printf("Server.Handle(): Notification %q failed: %s", req.Method, resp.Error)
+		}
+		return nil
+	}
+	return resp
+}
+
+// handle executes a single request message and returns the response.
+func (s *Server) handle(ctx context.Context, req *Message) *Message {
 	r := &Message{
 		Response: &Response{
 			Result: nullResult,
@@ -116,31 +199,9 @@ func (s *Server) Handle(ctx context.Context, req *Message) *Message {
 		return r
 	}
 
-	s.mu.Lock()
-	m, ok := s.registry[req.Request.Method]
-	s.mu.Unlock()
-
-	if !ok {
-		r.Response.Error = &ErrResponse{
-			Code:    ErrCodeMethodNotFound,
-			Message: fmt.Sprintf("method not found: %s", req.Method),
-		}
-		return r
-	}
-	args, err := parsePositionalArguments(req.Params, m.ArgTypes)
-	if err != nil {
-		r.Error = &ErrResponse{
-			Code:    ErrCodeInvalidParams,
-			Message: fmt.Sprintf("invalid params: %s %s", req.Method, req.Params),
-		}
-		return r
-	}
-	res, err := m.Call(ctx, args)
+	res, err := s.handler()(ctx, req.Method, req.Params)
 	if err != nil {
-		r.Error = &ErrResponse{
-			Code:    ErrCodeInternal,
-			Message: err.Error(),
-		}
+		r.Error = errResponse(err)
 		return r
 	}
 	if res == nil {
@@ -154,3 +215,49 @@ func (s *Server) Handle(ctx context.Context, req *Message) *Message {
 	}
 	return r
 }
+
+// handleBatch executes each request in a batch concurrently and returns the
+// responses in the same order.
+func (s *Server) handleBatch(ctx context.Context, req *Message) *Message {
+	if len(req.Batch) == 0 {
+		return &Message{
+			Response: &Response{
+				Error: &ErrResponse{
+					Code:    ErrCodeInvalidRequest,
+					Message: "server received empty batch",
+				},
+			},
+			ID:      nullID,
+			Version: Version,
+		}
+	}
+
+	responses := make([]*Message, len(req.Batch))
+	var wg sync.WaitGroup
+	for i, entry := range req.Batch {
+		wg.Add(1)
+		go func(i int, entry *Message) {
+			defer wg.Done()
+			if entry.IsBatch() {
+				// Nested batches are not allowed
+				entry = &Message{ID: nullID}
+			}
+			responses[i] = s.Handle(ctx, entry)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	// Notifications don't get responses
+	r := &Message{
+		Batch: make([]*Message, 0, len(responses)),
+	}
+	for _, resp := range responses {
+		if resp != nil {
+			r.Batch = append(r.Batch, resp)
+		}
+	}
+	if len(r.Batch) == 0 {
+		return nil
+	}
+	return r
+}
@@ -3,6 +3,8 @@ package jsonrpc2
 import (
 	"context"
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -58,3 +60,173 @@ func TestServer(t *testing.T) {
 		t.Errorf("unexpected error message: %q", resp.Error)
 	}
 }
+
+func TestServerBatch(t *testing.T) {
+	s := Server{}
+	if err := s.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var req Message
+	if err := json.Unmarshal([]byte(`[
+		{"jsonrpc": "2.0", "id": 1, "method": "apple"},
+		{"jsonrpc": "2.0", "id": 2, "method": "durian"},
+		1,
+		{"jsonrpc": "2.0", "id": 3, "method": "cherry"}
+	]`), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.Handle(context.Background(), &req)
+	if !resp.IsBatch() {
+		t.Fatalf("expected batch response, got: %s", resp)
+	}
+	if len(resp.Batch) != 4 {
+		t.Fatalf("wrong number of responses: %s", resp)
+	}
+
+	if got, want := resp.Batch[0].String(), `{"result":"Apple","id":1,"jsonrpc":"2.0"}`; got != want {
+		t.Errorf("got: %s; want %s", got, want)
+	}
+	if got, want := resp.Batch[1].Error, (&ErrResponse{Code: ErrCodeInternal, Message: "durian failure"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v; want %v", got, want)
+	}
+	if got, want := resp.Batch[2].Error.Code, ErrCodeInvalidRequest; got != want {
+		t.Errorf("got: %d; want %d", got, want)
+	}
+	if got, want := string(resp.Batch[2].ID), "null"; got != want {
+		t.Errorf("got: %s; want %s", got, want)
+	}
+	if got, want := string(resp.Batch[3].Result), `"Cherry"`; got != want {
+		t.Errorf("got: %s; want %s", got, want)
+	}
+
+	// Empty batch is answered with a single error
+	resp = s.Handle(context.Background(), &Message{Batch: []*Message{}})
+	if resp.IsBatch() {
+		t.Fatalf("expected single response, got: %s", resp)
+	}
+	if got, want := resp.String(), `{"error":{"code":-32600,"message":"server received empty batch"},"id":null,"jsonrpc":"2.0"}`; got != want {
+		t.Errorf("got: %s; want %s", got, want)
+	}
+}
+
+func TestServerNotification(t *testing.T) {
+	listener := &Listener{Received: make(chan string, 3)}
+	s := Server{}
+	if err := s.Register("", listener); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.Handle(context.Background(), &Message{
+		Version: Version,
+		Request: &Request{
+			Method: "announce",
+			Params: json.RawMessage(`["hello"]`),
+		},
+	})
+	if resp != nil {
+		t.Errorf("unexpected response to notification: %s", resp)
+	}
+	if got, want := <-listener.Received, "hello"; got != want {
+		t.Errorf("got: %q; want %q", got, want)
+	}
+
+	// Notifications are omitted from batch responses
+	var req Message
+	if err := json.Unmarshal([]byte(`[
+		{"jsonrpc": "2.0", "method": "announce", "params": ["a"]},
+		{"jsonrpc": "2.0", "id": 1, "method": "announce", "params": ["b"]}
+	]`), &req); err != nil {
+		t.Fatal(err)
+	}
+	resp = s.Handle(context.Background(), &req)
+	if resp == nil || len(resp.Batch) != 1 || string(resp.Batch[0].ID) != "1" {
+		t.Errorf("unexpected batch response: %s", resp)
+	}
+
+	// Batch of only notifications has no response
+	if err := json.Unmarshal([]byte(`[{"jsonrpc": "2.0", "method": "announce", "params": ["c"]}]`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if resp := s.Handle(context.Background(), &req); resp != nil {
+		t.Errorf("unexpected response to notification batch: %s", resp)
+	}
+}
+
+func TestServerErrorCode(t *testing.T) {
+	rpc := Local{}
+	if err := rpc.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := rpc.Call(context.Background(), nil, "elderberry")
+	errResp, ok := err.(*ErrResponse)
+	if !ok {
+		t.Fatalf("unexpected error type %T: %s", err, err)
+	}
+	if got, want := errResp.Code, -32042; got != want {
+		t.Errorf("got code: %d; want %d", got, want)
+	}
+	if got, want := errResp.Message, "quota exceeded: 3 remaining"; got != want {
+		t.Errorf("got message: %q; want %q", got, want)
+	}
+	var data QuotaError
+	if err := errResp.UnmarshalData(&data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Remaining != 3 {
+		t.Errorf("unexpected data: %s", errResp.Data)
+	}
+
+	// Errors without a code are internal errors without data
+	err = rpc.Call(context.Background(), nil, "durian")
+	if !IsErrorCode(err, ErrCodeInternal) {
+		t.Errorf("expected internal error code, got: %v", err)
+	}
+	if errResp, ok := err.(*ErrResponse); !ok || errResp.Data != nil {
+		t.Errorf("unexpected error data: %v", err)
+	}
+}
+
+func TestServerNamedParams(t *testing.T) {
+	s := Server{}
+	if err := s.Register("", &SomeType{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetParamNames("repeat", "word"); err == nil {
+		t.Error("expected error for wrong number of param names")
+	}
+	if err := s.SetParamNames("repeat", "word", "times", "suffix"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.Handle(context.Background(), &Message{
+		ID:      json.RawMessage("1"),
+		Version: Version,
+		Request: &Request{
+			Method: "repeat",
+			Params: json.RawMessage(`{"word": "ab", "times": 2}`),
+		},
+	})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+	if got, want := string(resp.Result), `"abab"`; got != want {
+		t.Errorf("got: %s; want %s", got, want)
+	}
+
+	resp = s.Handle(context.Background(), &Message{
+		ID:      json.RawMessage("2"),
+		Version: Version,
+		Request: &Request{
+			Method: "repeat",
+			Params: json.RawMessage(`{"times": 2}`),
+		},
+	})
+	if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+		t.Errorf("expected invalid params error, got: %s", resp)
+	} else if want := "missing value for required argument"; !strings.Contains(resp.Error.Message, want) {
+		t.Errorf("invalid params error is missing the cause %q: %s", want, resp.Error.Message)
+	}
+}
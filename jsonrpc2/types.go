@@ -1,12 +1,16 @@
 package jsonrpc2
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
 
 const Version = "2.0"
 
+// nullID is used in responses when the request ID could not be determined.
+var nullID = json.RawMessage("null")
+
 type ErrorCode int
 
 const (
@@ -16,6 +20,7 @@ const (
 	ErrCodeInvalidParams      = -32602
 	ErrCodeInternal           = -32603
 	ErrCodeServer             = -32000
+	ErrCodeLimitExceeded      = -32005
 )
 
 type Message struct {
@@ -23,6 +28,59 @@ type Message struct {
 	*Response
 	ID      json.RawMessage `json:"id,omitempty"`
 	Version string          `json:"jsonrpc"` // TODO: Replace this with a null-type that encodes to 2.0, like https://go-review.googlesource.com/c/tools/+/136675/1/internal/jsonrpc2/jsonrpc2.go#221
+
+	// Batch is set when the message is a batch of messages, which is encoded
+	// as a JSON array. The other fields are ignored when Batch is not nil.
+	Batch []*Message `json:"-"`
+}
+
+// message is used to encode the Message fields without recursing into the
+// custom marshalers.
+type message Message
+
+// IsBatch returns true if the message is a batch of messages, including an
+// empty batch.
+func (m *Message) IsBatch() bool {
+	return m.Batch != nil
+}
+
+// IsNotification returns true if the message is a request without an ID,
+// which does not expect a response.
+func (m *Message) IsNotification() bool {
+	return m.Request != nil && len(m.ID) == 0 && m.Batch == nil
+}
+
+// MarshalJSON encodes batch messages as an array, and single messages as an
+// object.
+func (m Message) MarshalJSON() ([]byte, error) {
+	if m.Batch != nil {
+		return json.Marshal(m.Batch)
+	}
+	return json.Marshal(message(m))
+}
+
+// UnmarshalJSON decodes a JSON array into a batch message, and a JSON object
+// into a single message. Batch entries that fail to decode are retained as
+// empty messages so that they can be answered with an invalid request error.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 || data[0] != '[' {
+		return json.Unmarshal(data, (*message)(m))
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	*m = Message{Batch: make([]*Message, 0, len(entries))}
+	for _, raw := range entries {
+		var entry Message
+		if err := json.Unmarshal(raw, (*message)(&entry)); err != nil {
+			entry = Message{ID: nullID}
+		}
+		m.Batch = append(m.Batch, &entry)
+	}
+	return nil
 }
 
 func (m Message) String() string {
@@ -74,6 +132,15 @@ func (err *ErrResponse) ErrorCode() int {
 	return err.Code
 }
 
+// UnmarshalData decodes the error's structured data into v. If the error
+// has no data, v is left unchanged.
+func (err *ErrResponse) UnmarshalData(v interface{}) error {
+	if len(err.Data) == 0 || string(err.Data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(err.Data, v)
+}
+
 // IsErrorCode returns true iff the error has an ErrorCode. If allowedCodes
 // is provided, then it also checks that it matches one of the allowedCodes.
 func IsErrorCode(err error, allowedCodes ...int) bool {
@@ -1,6 +1,9 @@
 package jsonrpc2
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestMessageFormat(t *testing.T) {
 	msg := &Message{
@@ -13,3 +16,25 @@ func TestMessageFormat(t *testing.T) {
 		t.Errorf("wrong message string formatting:\n  got: %s;\n want: %s", got, want)
 	}
 }
+
+func TestMessageBatchFormat(t *testing.T) {
+	msg := &Message{
+		Batch: []*Message{
+			{ID: []byte("1"), Version: "2.0"},
+			{ID: []byte("2"), Version: "2.0"},
+		},
+	}
+
+	got, want := msg.String(), `[{"id":1,"jsonrpc":"2.0"},{"id":2,"jsonrpc":"2.0"}]`
+	if got != want {
+		t.Errorf("wrong message string formatting:\n  got: %s;\n want: %s", got, want)
+	}
+
+	var decoded Message
+	if err := json.Unmarshal([]byte(want), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.String(); got != want {
+		t.Errorf("wrong decoded batch:\n  got: %s;\n want: %s", got, want)
+	}
+}
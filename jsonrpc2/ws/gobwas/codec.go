@@ -40,24 +40,58 @@ func clientWebSocketCodec(conn net.Conn) jsonrpc2.Codec {
 }
 
 // serverWebSocketCodec returns a server-side Codec that wraps JSON encoding and
-// decoding over a websocket connection.
-func serverWebSocketCodec(conn net.Conn) jsonrpc2.Codec {
+// decoding over a websocket connection. If maxMessageSize is set, then reading
+// a larger message fails with jsonrpc2.ErrMessageTooLarge.
+func serverWebSocketCodec(conn net.Conn, maxMessageSize int64) jsonrpc2.Codec {
 	r := wsutil.NewReader(conn, ws.StateServerSide)
 	w := wsutil.NewWriter(conn, ws.StateServerSide, ws.OpBinary)
+	limited := &limitedReader{r: r, max: maxMessageSize}
 	return &wsCodec{
-		inner:      jsonrpc2.IOCodec(rwc{r, w, conn}),
+		inner:      jsonrpc2.IOCodec(rwc{limited, w, conn}),
 		r:          r,
 		w:          w,
+		limited:    limited,
 		remoteAddr: conn.RemoteAddr().String(),
 	}
 }
 
+// limitedReader fails once more than max bytes are read since the last
+// reset. A zero max disables the limit.
+type limitedReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.max <= 0 {
+		return l.r.Read(p)
+	}
+	if l.n > l.max {
+		return 0, jsonrpc2.ErrMessageTooLarge
+	}
+	if remaining := l.max - l.n + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		return n, jsonrpc2.ErrMessageTooLarge
+	}
+	return n, err
+}
+
+func (l *limitedReader) reset() {
+	l.n = 0
+}
+
 var _ jsonrpc2.Codec = &wsCodec{}
 
 type wsCodec struct {
 	inner      jsonrpc2.Codec
 	r          *wsutil.Reader
 	w          *wsutil.Writer
+	limited    *limitedReader
 	remoteAddr string
 }
 
@@ -70,6 +104,9 @@ func (codec *wsCodec) ReadMessage() (*jsonrpc2.Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	if codec.limited != nil {
+		codec.limited.reset()
+	}
 	return codec.inner.ReadMessage()
 }
 
@@ -92,6 +129,9 @@ func (codec *wsCodec) Close() error {
 // appropriate jsonrpc2 codec.
 type Upgrader struct {
 	Upgrader ws.HTTPUpgrader
+
+	// MaxMessageSize is the received message size limit (optional).
+	MaxMessageSize int64
 }
 
 func (u *Upgrader) Upgrade(r *http.Request, w http.ResponseWriter, h http.Header) (jsonrpc2.Codec, error) {
@@ -99,5 +139,5 @@ func (u *Upgrader) Upgrade(r *http.Request, w http.ResponseWriter, h http.Header
 	if err != nil {
 		return nil, err
 	}
-	return serverWebSocketCodec(conn), nil
+	return serverWebSocketCodec(conn, u.MaxMessageSize), nil
 }
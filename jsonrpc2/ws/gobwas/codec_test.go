@@ -2,6 +2,7 @@ package gobwas
 
 import (
 	"net"
+	"strings"
 	"testing"
 
 	"github.com/vipnode/vipnode/v2/jsonrpc2"
@@ -11,7 +12,7 @@ func TestWebSocketCodec(t *testing.T) {
 	c1, c2 := net.Pipe()
 
 	clientCodec := clientWebSocketCodec(c1)
-	serverCodec := serverWebSocketCodec(c2)
+	serverCodec := serverWebSocketCodec(c2, 0)
 
 	go clientCodec.WriteMessage(&jsonrpc2.Message{Version: "foo"})
 	msg, err := serverCodec.ReadMessage()
@@ -31,3 +32,54 @@ func TestWebSocketCodec(t *testing.T) {
 		t.Errorf("wrong message: %v", msg)
 	}
 }
+
+func TestWebSocketCodecBatch(t *testing.T) {
+	c1, c2 := net.Pipe()
+
+	clientCodec := clientWebSocketCodec(c1)
+	serverCodec := serverWebSocketCodec(c2, 0)
+
+	batch := &jsonrpc2.Message{
+		Batch: []*jsonrpc2.Message{
+			{Version: "foo"},
+			{Version: "bar"},
+		},
+	}
+	go clientCodec.WriteMessage(batch)
+	msg, err := serverCodec.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.IsBatch() || len(msg.Batch) != 2 || msg.Batch[1].Version != "bar" {
+		t.Errorf("wrong message: %v", msg)
+	}
+}
+
+func TestWebSocketCodecMaxMessageSize(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	clientCodec := clientWebSocketCodec(c1)
+	serverCodec := serverWebSocketCodec(c2, 64)
+
+	written := make(chan error, 1)
+	go func() {
+		written <- clientCodec.WriteMessage(&jsonrpc2.Message{Version: "foo"})
+	}()
+	msg, err := serverCodec.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Version != "foo" {
+		t.Errorf("wrong message: %v", msg)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+
+	go clientCodec.WriteMessage(&jsonrpc2.Message{Version: strings.Repeat("x", 100)})
+	if _, err := serverCodec.ReadMessage(); err != jsonrpc2.ErrMessageTooLarge {
+		t.Errorf("expected ErrMessageTooLarge, got: %v", err)
+	}
+}
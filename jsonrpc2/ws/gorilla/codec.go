@@ -28,6 +28,9 @@ func overrideEOF(err error) error {
 	if err == nil {
 		return nil
 	}
+	if err == websocket.ErrReadLimit {
+		return jsonrpc2.ErrMessageTooLarge
+	}
 	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 		return err
 	}
@@ -68,6 +71,11 @@ func (codec *wsCodec) Close() error {
 // appropriate jsonrpc2 codec.
 type Upgrader struct {
 	websocket.Upgrader
+
+	// MaxMessageSize is the received message size limit (optional). Reading a
+	// larger message fails with jsonrpc2.ErrMessageTooLarge and closes the
+	// connection.
+	MaxMessageSize int64
 }
 
 func (u *Upgrader) Upgrade(r *http.Request, w http.ResponseWriter, h http.Header) (jsonrpc2.Codec, error) {
@@ -75,5 +83,8 @@ func (u *Upgrader) Upgrade(r *http.Request, w http.ResponseWriter, h http.Header
 	if err != nil {
 		return nil, err
 	}
+	if u.MaxMessageSize > 0 {
+		conn.SetReadLimit(u.MaxMessageSize)
+	}
 	return &wsCodec{conn: conn}, nil
 }
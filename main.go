@@ -55,19 +55,35 @@ type Options struct {
 		NodeHost       string `long:"enode.host" description:"Override just the host component of reported enode:// URI. Useful for overriding network routing."`
 		Payout         string `long:"payout" description:"Ethereum wallet address to associate pool credits."`
 		MinPeers       int    `long:"min-peers" description:"Minimum number of peers to maintain." default:"3"`
+		MaxClients     int    `long:"max-clients" description:"Maximum number of vipnode clients to serve as a host, or 0 for no limit."`
 		StrictPeers    bool   `long:"strict-peers" description:"Disconnect peers that were not provided by the pool."`
 		UpdateInterval string `long:"update-interval" description:"Time between updates sent to pool, should be under 120s." default:"60s"`
 	} `command:"agent" description:"Connect as a node to a pool or another vipnode."`
 
 	Pool struct {
-		Bind            string `long:"bind" description:"Address and port to listen on." default:"0.0.0.0:8080"`
-		Store           string `long:"store" description:"Storage driver. (persist|memory)" default:"persist"`
-		DataDir         string `long:"datadir" description:"Path for storing the persistent database."`
-		TLSHost         string `long:"tlshost" description:"Acquire an ACME TLS cert for this host (forces bind to port :443)."`
-		AllowOrigin     string `long:"allow-origin" description:"Include Access-Control-Allow-Origin header for CORS."`
-		RestrictNetwork string `long:"restrict-network" description:"Restrict nodes to a single Ethereum network, such as: mainnet, rinkeby, goerli"`
-		MaxRequestHosts int    `long:"max-request-hosts" description:"Maximum number of hosts a node is allowed to request."`
-		Contract        struct {
+		Bind               string   `long:"bind" description:"Address and port to listen on." default:"0.0.0.0:8080"`
+		Store              string   `long:"store" description:"Storage driver. (persist|memory)" default:"persist"`
+		DataDir            string   `long:"datadir" description:"Path for storing the persistent database."`
+		TLSHost            string   `long:"tlshost" description:"Acquire an ACME TLS cert for this host (forces bind to port :443)."`
+		AllowOrigin        string   `long:"allow-origin" description:"Include Access-Control-Allow-Origin header for CORS."`
+		Networks           string   `long:"networks" description:"Comma-separated Ethereum networks to serve, such as: mainnet,goerli (Default: any network)"`
+		RestrictNetwork    string   `long:"restrict-network" description:"DEPRECATED: Use --networks" hidden:"true"`
+		MaxRequestHosts    int      `long:"max-request-hosts" description:"Maximum number of hosts a node is allowed to request."`
+		MaxBlockLag        uint64   `long:"max-block-lag" description:"Maximum number of blocks a host can be behind the median block of the hosts on its network to be offered to nodes, or 0 for no limit. Hosts that are still syncing are never offered." default:"20"`
+		MetricsAddr        string   `long:"metrics-addr" description:"Address and port to serve Prometheus metrics on at /metrics, separately from --bind so that they aren't public. (Example: localhost:9090, Default: metrics disabled)"`
+		MaxConcurrent      int      `long:"max-concurrent-requests" description:"Maximum number of RPC requests handled concurrently across all connections, or 0 for unlimited." default:"1000"`
+		HostSelector       string   `long:"host-selector" description:"Strategy for choosing which hosts are offered to nodes: random, least-loaded, freshest-block, longest-uptime, reliable, or weighted combinations such as \"least-loaded:2,freshest-block:1\"." default:"random,reliable:2"`
+		InviteOnly         bool     `long:"invite-only" description:"Only allow nodes matching the allow list to join the pool."`
+		AccessFile         string   `long:"access-file" description:"Path to a JSON file of ban and allow list entries to load on startup."`
+		ClusterID          string   `long:"cluster-id" description:"Unique name of this pool instance, when running multiple instances that share a store."`
+		ClusterSecret      string   `long:"cluster-secret" description:"Secret shared by all pool instances to sign relayed calls. (Can be set with the CLUSTER_SECRET env)"`
+		ClusterPeers       []string `long:"cluster-peer" description:"Another pool instance as id=url, such as \"pool2=http://10.0.0.2:8080/\", can be repeated."`
+		FederationKey      string   `long:"federation-key" description:"Path to the hex-encoded private key that identifies this pool to its federation partners."`
+		FederationPartners []string `long:"federation-partner" description:"Partner pool that is asked for hosts when this pool has too few, as address=url, such as \"0x...=https://pool.example.com/\", can be repeated."`
+		AdminOperators     []string `long:"admin-operator" description:"Ethereum wallet address of an operator allowed to use the admin API, can be repeated. (Default: admin API disabled)"`
+		Webhooks           []string `long:"webhook" description:"URL that pool events are posted to, optionally prefixed by comma-separated topics as topics=url, such as \"low_balance,last_host_offline=https://example.com/hook\", can be repeated."`
+		WebhookSecret      string   `long:"webhook-secret" description:"Secret used to sign webhook deliveries with HMAC-SHA256, which receivers check with the X-Vipnode-Signature and X-Vipnode-Timestamp headers. (Can be set with the WEBHOOK_SECRET env)"`
+		Contract           struct {
 			RPC        string `long:"rpc" description:"Path or URL of an Ethereum RPC provider for payment contract operations. Must match the network of the contract."`
 			Addr       string `long:"address" description:"Deployed contract address, prefixed with network name scheme. (Example: \"rinkeby://0xb2f8987986259facdc539ac1745f7a0b395972b1\")"`
 			KeyStore   string `long:"keystore" description:"Path to encrypted JSON wallet keystore for contract operator. (Password set in KEYSTORE_PASSPHRASE env)"`
@@ -75,8 +91,75 @@ type Options struct {
 			MinBalance string `long:"min-balance" description:"Minimum balance required to join as a client, or 'off'." default:"off"`
 			Welcome    string `long:"welcome" description:"Welcome message for clients. (Example: \"Welcome, {{.NodeID}}\")"`
 		} `group:"contract" namespace:"contract"`
+		Shutdown struct {
+			Timeout         string `long:"timeout" description:"Deadline for shutting down gracefully when the pool receives SIGINT or SIGTERM." default:"30s"`
+			ReconnectDelay  string `long:"reconnect-delay" description:"Minimum delay that agents are asked to wait before reconnecting after a shutdown." default:"10s"`
+			ReconnectJitter string `long:"reconnect-jitter" description:"Random delay added to each agent's reconnect delay, to spread out reconnects." default:"50s"`
+		} `group:"shutdown" namespace:"shutdown"`
 	} `command:"pool" description:"Start a vipnode pool coordinator."`
 
+	Discover struct {
+		Args struct {
+			Pool string `positional-arg-name:"pool" description:"vipnode pool URL" default:"wss://pool.vipnode.org/"`
+		} `positional-args:"yes"`
+	} `command:"discover" description:"Print the OpenRPC description of a pool's RPC API."`
+
+	Admin struct {
+		Pool string `long:"pool" description:"vipnode pool URL" default:"wss://pool.vipnode.org/"`
+		Key  string `long:"key" description:"Path to the hex-encoded private key of a pool operator wallet." required:"true"`
+
+		Nodes struct{} `command:"nodes" description:"List the nodes registered with the pool."`
+		Node  struct {
+			Args struct {
+				NodeID string `positional-arg-name:"nodeid" required:"true"`
+			} `positional-args:"yes"`
+		} `command:"node" description:"Show a node's peers, balance, and reputation."`
+		Kick struct {
+			Args struct {
+				NodeID string `positional-arg-name:"nodeid" required:"true"`
+			} `positional-args:"yes"`
+		} `command:"kick" description:"Disconnect a node from the pool."`
+		Ban struct {
+			Duration string `long:"duration" description:"Duration of the ban, such as 24h. (Default: forever)"`
+			Args     struct {
+				Target string `positional-arg-name:"nodeid|account|ip|cidr" required:"true"`
+				Reason string `positional-arg-name:"reason"`
+			} `positional-args:"yes"`
+		} `command:"ban" description:"Ban a node ID, payout account, IP address or CIDR IP range, and kick the node."`
+		Unban struct {
+			Args struct {
+				Target string `positional-arg-name:"nodeid|account|ip|cidr" required:"true"`
+			} `positional-args:"yes"`
+		} `command:"unban" description:"Remove an entry from the ban list."`
+		Bans  struct{} `command:"bans" description:"List the entries of the ban list."`
+		Allow struct {
+			Duration string `long:"duration" description:"Duration of the entry, such as 720h. (Default: forever)"`
+			Args     struct {
+				Target string `positional-arg-name:"nodeid|account|ip|cidr" required:"true"`
+				Reason string `positional-arg-name:"reason"`
+			} `positional-args:"yes"`
+		} `command:"allow" description:"Add an entry to the allow list, used by invite-only pools."`
+		Disallow struct {
+			Args struct {
+				Target string `positional-arg-name:"nodeid|account|ip|cidr" required:"true"`
+			} `positional-args:"yes"`
+		} `command:"disallow" description:"Remove an entry from the allow list."`
+		Allowed struct{} `command:"allowed" description:"List the entries of the allow list."`
+		Credit  struct {
+			Args struct {
+				Target string `positional-arg-name:"nodeid|account" required:"true"`
+				Amount string `positional-arg-name:"amount" description:"Credit to add, such as \"0.01 ether\". Negative amounts must follow \"--\"." required:"true"`
+				Reason string `positional-arg-name:"reason" required:"true"`
+			} `positional-args:"yes"`
+		} `command:"credit" description:"Adjust the credit balance of a node or wallet account."`
+		Maintenance struct {
+			Args struct {
+				State string `positional-arg-name:"on|off" choice:"on" choice:"off" required:"true"`
+			} `positional-args:"yes"`
+		} `command:"maintenance" description:"Toggle maintenance mode, which rejects new connections and peering requests."`
+		Federation struct{} `command:"federation" description:"Show the usage recorded with each federation partner, by this pool and by the partner."`
+	} `command:"admin" description:"Manage a running pool as its operator."`
+
 	// DEPRECATED
 	Client struct {
 		Args struct {
@@ -211,6 +294,12 @@ func subcommand(cmd string, options Options) error {
 	if cmd == "pool" {
 		return runPool(options)
 	}
+	if cmd == "discover" {
+		return runDiscover(options)
+	}
+	if strings.HasPrefix(cmd, "admin ") {
+		return runAdmin(options, strings.TrimPrefix(cmd, "admin "))
+	}
 
 	// Run with retries for host/client
 
@@ -243,13 +332,13 @@ func subcommand(cmd string, options Options) error {
 		if err == nil {
 			// Exit cleanly
 			return nil
-		} else if err == io.EOF {
+		} else if err == io.EOF || err == jsonrpc2.ErrConnectionClosed {
 			logger.Warningf("Connection closed, retrying in %s...", waitTime)
 		} else if errRetry, ok := err.(ErrExplainRetry); ok {
 			logger.Warningf("Failed to connect, retrying in %s: %s", waitTime, errRetry)
 		} else if _, ok := err.(net.Error); ok {
 			logger.Warningf("Failed to connect, retrying in %s: %s", waitTime, err)
-		} else if err.Error() == (pool.NoHostNodesError{}).Error() {
+		} else if _, ok := err.(pool.NoHostNodesError); ok {
 			logger.Warningf("Pool does not have available hosts, retrying in %s...", waitTime)
 		} else {
 			return err
@@ -342,13 +431,17 @@ func main() {
 	cmd := "agent"
 	if parser.Active != nil {
 		cmd = parser.Active.Name
+		if parser.Active.Active != nil {
+			// Nested subcommand, such as "admin nodes"
+			cmd += " " + parser.Active.Active.Name
+		}
 	}
 	err = subcommand(cmd, options)
 	if err == nil {
 		return
 	}
 
-	if err == io.EOF {
+	if err == io.EOF || err == jsonrpc2.ErrConnectionClosed {
 		exit(3, "Connection closed.\n")
 	}
 
@@ -379,11 +472,10 @@ func explainError(err error) error {
 			switch typedErr.ErrorCode() {
 			case jsonrpc2.ErrCodeMethodNotFound, jsonrpc2.ErrCodeInvalidParams:
 				return ErrExplain{err, `Missing a required RPC method. Make sure your Ethereum node is up to date.`}
-			case jsonrpc2.ErrCodeInternal:
-				if err.Error() == (pool.NoHostNodesError{}).Error() {
-					return ErrExplain{err, `The pool does not have any hosts who are ready to serve your kind of client right now. Try again later or contact the pool operator for help.`}
-				}
-				fallthrough
+			case pool.ErrCodeNoHostNodes:
+				return ErrExplain{err, `The pool does not have any hosts who are ready to serve your kind of client right now. Try again later or contact the pool operator for help.`}
+			case pool.ErrCodeLowBalance:
+				return ErrExplain{err, `Your balance on the pool is too low to continue. Deposit more funds to your balance or contact the pool operator for help.`}
 			default:
 				return ErrExplain{err, fmt.Sprintf(`Unexpected RPC error occurred: %T (code %d). Please open an issue at https://github.com/vipnode/vipnode`, typedErr, typedErr.ErrorCode())}
 			}
@@ -11,7 +11,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"text/template"
 	"time"
 
@@ -19,9 +23,11 @@ import (
 	"github.com/dgraph-io/badger/v2"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/vipnode/vipnode/v2/ethnode"
 	"github.com/vipnode/vipnode/v2/internal/pretty"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
 	ws "github.com/vipnode/vipnode/v2/jsonrpc2/ws/gorilla"
 	"github.com/vipnode/vipnode/v2/pool"
 	"github.com/vipnode/vipnode/v2/pool/balance"
@@ -35,6 +41,13 @@ import (
 
 const healthTimeout = time.Second * 5
 
+// maxMessageSize is the size limit of RPC messages received by the pool.
+const maxMessageSize = 1024 * 1024
+
+// maxConcurrentPerConn is the number of RPC requests from a single connection
+// that the pool will handle concurrently.
+const maxConcurrentPerConn = 20
+
 // findDataDir returns a valid data dir, will create it if it doesn't
 // exist.
 func findDataDir(overridePath string) (string, error) {
@@ -51,7 +64,6 @@ func runPool(options Options) error {
 	switch options.Pool.Store {
 	case "memory":
 		storeDriver = memoryStore.New()
-		defer storeDriver.Close()
 	case "persist":
 		fallthrough
 	case "badger":
@@ -64,11 +76,35 @@ func runPool(options Options) error {
 		if err != nil {
 			return err
 		}
-		defer storeDriver.Close()
 		logger.Infof("Persistent store using badger backend: %s", dir)
 	default:
 		return errors.New("storage driver not implemented")
 	}
+	// Record store latencies and balance changes for /metrics
+	metrics := pool.NewMetrics()
+	storeDriver = metrics.Store(storeDriver)
+	events := pool.NewEvents()
+	var storeClosed int32
+	closeStore := func() error {
+		if !atomic.CompareAndSwapInt32(&storeClosed, 0, 1) {
+			return nil
+		}
+		return storeDriver.Close()
+	}
+	defer closeStore()
+
+	shutdownTimeout, err := time.ParseDuration(options.Pool.Shutdown.Timeout)
+	if err != nil {
+		return ErrExplain{err, `Failed to parse --shutdown.timeout, try a value like "30s".`}
+	}
+	reconnectDelay, err := time.ParseDuration(options.Pool.Shutdown.ReconnectDelay)
+	if err != nil {
+		return ErrExplain{err, `Failed to parse --shutdown.reconnect-delay, try a value like "10s".`}
+	}
+	reconnectJitter, err := time.ParseDuration(options.Pool.Shutdown.ReconnectJitter)
+	if err != nil {
+		return ErrExplain{err, `Failed to parse --shutdown.reconnect-jitter, try a value like "50s".`}
+	}
 
 	balanceStore := store.BalanceStore(storeDriver)
 	var settleHandler payment.SettleHandler
@@ -89,7 +125,7 @@ func runPool(options Options) error {
 		}
 
 		// Confirm we're on the right network.
-		// Note: The contract network/node can be independent of the --restrict-network setting
+		// Note: The contract network/node can be independent of the --networks setting
 		gotNetwork, err := ethclient.NetworkID(context.Background())
 		if err != nil {
 			return err
@@ -128,6 +164,9 @@ func runPool(options Options) error {
 		}
 		balanceStore = contract
 		settleHandler = contract.OpSettle
+		contract.OnSubscribeFailed(func(err error) {
+			events.Publish(pool.Event{Topic: pool.EventBalanceFallback, Message: err.Error()})
+		})
 
 		depositGetter = func(ctx context.Context) (*big.Int, error) {
 			r, err := ethclient.PendingBalanceAt(ctx, contractAddr)
@@ -172,17 +211,48 @@ func runPool(options Options) error {
 		}
 	}
 
-	var networkID ethnode.NetworkID
+	networksOption := options.Pool.Networks
 	if options.Pool.RestrictNetwork != "" {
-		networkID = ethnode.ParseNetwork(options.Pool.RestrictNetwork)
-		if networkID == ethnode.UnknownNetwork {
-			return ErrExplain{errors.New("unknown network"), `Failed to parse network ID provided to --restrict-network`}
-		}
+		// DEPRECATED: --restrict-network is the same as a single --networks
+		networksOption = strings.Join([]string{networksOption, options.Pool.RestrictNetwork}, ",")
+	}
+	networks, err := parseNetworks(networksOption)
+	if err != nil {
+		return ErrExplain{err, `Failed to parse --networks, expected network names or IDs such as: mainnet,goerli`}
 	}
 
 	p := pool.New(storeDriver, balanceManager)
 	p.MaxRequestHosts = options.Pool.MaxRequestHosts
+	p.MaxBlockLag = options.Pool.MaxBlockLag
+	p.HostSelector, err = pool.ParseHostSelector(options.Pool.HostSelector)
+	if err != nil {
+		return ErrExplain{err, `Failed to parse --host-selector, expected a strategy like "least-loaded" or weighted strategies like "least-loaded:2,freshest-block:1"`}
+	}
 	p.Version = fmt.Sprintf("vipnode/pool/%s", Version)
+	p.Metrics = metrics
+	p.InviteOnly = options.Pool.InviteOnly
+	if options.Pool.ClusterID != "" {
+		p.Cluster, err = newCluster(options.Pool.ClusterID, options.Pool.ClusterSecret, options.Pool.ClusterPeers)
+		if err != nil {
+			return err
+		}
+	}
+	if options.Pool.FederationKey != "" {
+		p.Federation, err = newFederation(options.Pool.FederationKey, options.Pool.FederationPartners)
+		if err != nil {
+			return err
+		}
+	} else if len(options.Pool.FederationPartners) > 0 {
+		return ErrExplain{
+			errors.New("missing federation key"),
+			"Federation partners identify this pool by its key. Set it with --federation-key.",
+		}
+	}
+	if options.Pool.AccessFile != "" {
+		if err := loadAccessFile(p, options.Pool.AccessFile); err != nil {
+			return ErrExplain{err, `Failed to load --access-file, expected JSON such as: {"ban": [{"target": "10.0.0.0/8", "reason": "abuse"}], "allow": [{"target": "0x..."}]}`}
+		}
+	}
 
 	if welcomeTmpl != nil {
 		p.ClientMessager = func(nodeID string) string {
@@ -200,23 +270,36 @@ func runPool(options Options) error {
 		}
 	}
 
-	p.RestrictNetwork = networkID
+	p.Networks = networks
 	p.BlockNumberProvider = func(network ethnode.NetworkID) (uint64, error) {
 		// TODO: Does it make sense also fetching this from an external service? Eg: Infura's eth_blockNumber?
-		if network != p.RestrictNetwork {
-			return 0, fmt.Errorf("block number provider does not support network: %s", network)
-		}
 		stats, err := p.Store.Stats()
 		if err != nil {
 			return 0, err
 		}
-		return stats.LatestBlockNumber, nil
+		if networkStats, ok := stats.Networks[network]; ok {
+			return networkStats.LatestBlockNumber, nil
+		}
+		return 0, nil
 	}
 
+	p.Events = events
 	handler := &server{
-		ws:           &ws.Upgrader{},
-		header:       http.Header{},
-		onDisconnect: p.CloseRemote,
+		ws:     &ws.Upgrader{MaxMessageSize: maxMessageSize},
+		header: http.Header{},
+		onDisconnect: func(remote jsonrpc2.Service) error {
+			if notifier, ok := remote.(jsonrpc2.Notifier); ok {
+				p.Events.Unsubscribe(notifier)
+			}
+			return p.CloseRemote(remote)
+		},
+		maxConcurrent: maxConcurrentPerConn,
+		metrics:       metrics,
+	}
+	handler.MaxContentLength = maxMessageSize
+	handler.Use(metrics.Interceptor)
+	if options.Pool.MaxConcurrent > 0 {
+		handler.Use(jsonrpc2.ConcurrencyLimit(options.Pool.MaxConcurrent))
 	}
 	if options.Pool.AllowOrigin != "" {
 		handler.header.Set("Access-Control-Allow-Origin", options.Pool.AllowOrigin)
@@ -225,6 +308,11 @@ func runPool(options Options) error {
 	if err := handler.Register("vipnode_", p, "connect", "disconnect", "ping", "update", "peer", "client", "host"); err != nil {
 		return err
 	}
+	for _, method := range []string{"vipnode_connect", "vipnode_update", "vipnode_peer", "vipnode_client", "vipnode_host"} {
+		if err := handler.SetParamNames(method, "sig", "nodeID", "nonce", "request"); err != nil {
+			return err
+		}
+	}
 
 	// Pool payment management API (optional)
 	payment := &payment.PaymentService{
@@ -239,11 +327,77 @@ func runPool(options Options) error {
 		},
 		WithdrawMin: big.NewInt(5000000000000000), // 0.005 ETH
 		Settle:      settleHandler,
+		Events:      p.Events,
 	}
 	if err := handler.Register("pool_", payment); err != nil {
 		return err
 	}
 
+	// Pool instance cluster API (optional)
+	if p.Cluster != nil {
+		if err := handler.Register("cluster_", &pool.ClusterService{Pool: p}); err != nil {
+			return err
+		}
+		if err := handler.SetParamNames("cluster_relay", "sig", "timestamp", "nodeID", "method", "params"); err != nil {
+			return err
+		}
+		if err := handler.SetParamNames("cluster_kick", "sig", "timestamp", "nodeID"); err != nil {
+			return err
+		}
+	}
+
+	// Pool federation API (optional)
+	if p.Federation != nil {
+		if err := handler.Register("federation_", &pool.FederationService{Pool: p}); err != nil {
+			return err
+		}
+		for method, params := range map[string][]string{
+			"federation_peer":   {"sig", "pool", "nonce", "request"},
+			"federation_update": {"sig", "pool", "nonce", "request"},
+			"federation_usage":  {"sig", "pool", "nonce"},
+		} {
+			if err := handler.SetParamNames(method, params...); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Pool operator admin API (optional)
+	if len(options.Pool.AdminOperators) > 0 {
+		admin := &pool.AdminService{
+			Pool:         p,
+			BalanceStore: balanceStore,
+			Operators:    options.Pool.AdminOperators,
+		}
+		if err := handler.Register("admin_", admin); err != nil {
+			return err
+		}
+		// Pool event subscriptions for operators, over websocket
+		if err := handler.Register("pool_", &pool.EventService{Events: p.Events, Admin: admin}); err != nil {
+			return err
+		}
+		for method, params := range map[string][]string{
+			"admin_nodes":          {"sig", "operator", "nonce"},
+			"admin_bans":           {"sig", "operator", "nonce"},
+			"admin_node":           {"sig", "operator", "nonce", "nodeID"},
+			"admin_kick":           {"sig", "operator", "nonce", "nodeID"},
+			"admin_allowed":        {"sig", "operator", "nonce"},
+			"admin_ban":            {"sig", "operator", "nonce", "target", "reason", "duration"},
+			"admin_unban":          {"sig", "operator", "nonce", "target"},
+			"admin_allow":          {"sig", "operator", "nonce", "target", "reason", "duration"},
+			"admin_disallow":       {"sig", "operator", "nonce", "target"},
+			"admin_adjustBalance":  {"sig", "operator", "nonce", "target", "credit", "reason"},
+			"admin_setMaintenance": {"sig", "operator", "nonce", "enabled"},
+			"admin_federation":     {"sig", "operator", "nonce"},
+			"pool_subscribe":       {"sig", "operator", "nonce", "topics"},
+		} {
+			if err := handler.SetParamNames(method, params...); err != nil {
+				return err
+			}
+		}
+		logger.Infof("Admin API enabled for operators: %s", strings.Join(options.Pool.AdminOperators, ", "))
+	}
+
 	// Pool status dashboard API
 	dashboard := &status.PoolStatus{
 		Store:           storeDriver,
@@ -256,6 +410,14 @@ func runPool(options Options) error {
 		return err
 	}
 
+	// OpenRPC description of all the methods registered above
+	if err := handler.RegisterDiscover(jsonrpc2.OpenRPCInfo{
+		Title:   "vipnode pool",
+		Version: Version,
+	}); err != nil {
+		return err
+	}
+
 	// PoolStatus-based healthcheck for our HTTP handler
 	handler.healthCheck = func(w io.Writer) error {
 		ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
@@ -267,19 +429,227 @@ func runPool(options Options) error {
 		return json.NewEncoder(w).Encode(status)
 	}
 
+	// Webhooks for pool events (optional)
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	var webhooksDone chan struct{}
+	if len(options.Pool.Webhooks) > 0 {
+		webhooks, err := newWebhooks(storeDriver, options.Pool.WebhookSecret, options.Pool.Webhooks)
+		if err != nil {
+			return err
+		}
+		if err := p.Events.Subscribe(webhooks, nil); err != nil {
+			return err
+		}
+		webhooksDone = make(chan struct{})
+		go func() {
+			webhooks.Run(webhooksCtx)
+			close(webhooksDone)
+		}()
+	}
+
+	// Prometheus metrics, on their own listener since they include per-host
+	// and balance data (optional)
+	if options.Pool.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Registry)
+		metricsSrv := &http.Server{Addr: options.Pool.MetricsAddr, Handler: mux}
+		defer metricsSrv.Close()
+		go func() {
+			logger.Infof("Serving metrics on: http://%s/metrics", options.Pool.MetricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("Failed to serve metrics: %s", err)
+			}
+		}()
+	}
+
+	srv := &http.Server{Addr: options.Pool.Bind, Handler: handler}
+	serveErr := make(chan error, 1)
 	if options.Pool.TLSHost != "" {
 		if !strings.HasSuffix(":443", options.Pool.Bind) {
 			logger.Warningf("Ignoring --bind value (%q) because it's not 443 and --tlshost is set.", options.Pool.Bind)
 		}
 		logger.Infof("Starting pool (version %s), acquiring ACME certificate and listening on: https://%s", Version, options.Pool.TLSHost)
-		err := http.Serve(autocert.NewListener(options.Pool.TLSHost), handler)
-		if strings.HasSuffix(err.Error(), "bind: permission denied") {
-			err = ErrExplain{err, "Hosting a pool with autocert requires CAP_NET_BIND_SERVICE capability permission to bind on low-numbered ports. See: https://superuser.com/questions/710253/allow-non-root-process-to-bind-to-port-80-and-443/892391"}
+		go func() {
+			err := srv.Serve(autocert.NewListener(options.Pool.TLSHost))
+			if strings.HasSuffix(err.Error(), "bind: permission denied") {
+				err = ErrExplain{err, "Hosting a pool with autocert requires CAP_NET_BIND_SERVICE capability permission to bind on low-numbered ports. See: https://superuser.com/questions/710253/allow-non-root-process-to-bind-to-port-80-and-443/892391"}
+			}
+			serveErr <- err
+		}()
+	} else {
+		logger.Infof("Starting pool (version %s), listening on: %s", Version, options.Pool.Bind)
+		go func() {
+			serveErr <- srv.ListenAndServe()
+		}()
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-sigCh:
+		logger.Infof("Received %s, shutting down pool within %s...", sig, shutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connects and peering requests, then stop accepting new
+	// connections and let in-flight HTTP requests finish.
+	p.Drain()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Warningf("Failed to finish serving HTTP requests before shutting down: %s", err)
+	}
+	numRemotes := handler.shutdownRemotes(ctx, reconnectDelay, reconnectJitter)
+	logger.Infof("Sent shutdown notice to %d connected agents, closing store...", numRemotes)
+
+	// Undelivered webhooks stay queued in the store until the next start
+	stopWebhooks()
+	if webhooksDone != nil {
+		<-webhooksDone
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- closeStore()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		return ErrExplain{ctx.Err(), "Pool store did not close before the --shutdown.timeout deadline, recent writes could be lost."}
+	}
+	logger.Infof("Pool shut down cleanly.")
+	return nil
+}
+
+// parseNetworks parses a comma-separated list of network names or numeric
+// network IDs.
+func parseNetworks(s string) ([]ethnode.NetworkID, error) {
+	var networks []ethnode.NetworkID
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		network := ethnode.ParseNetwork(name)
+		if network == ethnode.UnknownNetwork {
+			id, err := strconv.Atoi(name)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("unknown network: %q", name)
+			}
+			network = ethnode.NetworkID(id)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// newCluster returns the pool's Cluster, with peers given as id=url.
+func newCluster(instanceID string, secret string, peers []string) (*pool.Cluster, error) {
+	if secret == "" {
+		secret = os.Getenv("CLUSTER_SECRET")
+	}
+	if secret == "" {
+		return nil, ErrExplain{
+			errors.New("missing cluster secret"),
+			"Pool instances must share a secret to relay calls to each other. Set it with --cluster-secret or the CLUSTER_SECRET environment variable.",
+		}
+	}
+	cluster := pool.NewCluster(instanceID, secret)
+	for _, peer := range peers {
+		parts := strings.SplitN(peer, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrExplain{
+				fmt.Errorf("invalid cluster peer: %q", peer),
+				`Cluster peers must be the instance's --cluster-id and URL, such as: --cluster-peer "pool2=http://10.0.0.2:8080/"`,
+			}
+		}
+		service, err := poolHTTPService(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		cluster.AddPeer(parts[0], service)
+	}
+	logger.Infof("Pool instance %q joined cluster with %d peers", instanceID, len(peers))
+	return cluster, nil
+}
+
+// newFederation returns the pool's Federation, with partners given as
+// address=url.
+func newFederation(keyPath string, partners []string) (*pool.Federation, error) {
+	privkey, err := crypto.LoadECDSA(keyPath)
+	if err != nil {
+		return nil, ErrExplain{err, "Failed to load the federation private key. Use --federation-key to specify the path to a hex-encoded private key."}
+	}
+	federation := pool.NewFederation(privkey)
+	for _, partner := range partners {
+		parts := strings.SplitN(partner, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrExplain{
+				fmt.Errorf("invalid federation partner: %q", partner),
+				`Federation partners must be the address of the partner's --federation-key and its URL, such as: --federation-partner "0x...=https://pool.example.com/"`,
+			}
+		}
+		service, err := poolHTTPService(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if err := federation.AddPartner(parts[0], service); err != nil {
+			return nil, err
 		}
+	}
+	logger.Infof("Pool federation enabled as %s with %d partners", federation.Address, len(partners))
+	return federation, nil
+}
+
+// newWebhooks returns the pool's Webhooks, with endpoints given as url or
+// topics=url.
+func newWebhooks(queue store.WebhookStore, secret string, endpoints []string) (*pool.Webhooks, error) {
+	if secret == "" {
+		secret = os.Getenv("WEBHOOK_SECRET")
+	}
+	if secret == "" {
+		return nil, ErrExplain{
+			errors.New("missing webhook secret"),
+			"Webhook payloads are signed so that receivers can verify them. Set a secret with --webhook-secret or the WEBHOOK_SECRET environment variable.",
+		}
+	}
+	webhookEndpoints := make([]pool.WebhookEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		var e pool.WebhookEndpoint
+		if i := strings.Index(endpoint, "="); i > 0 && !strings.Contains(endpoint[:i], "://") {
+			e.Topics = strings.Split(endpoint[:i], ",")
+			endpoint = endpoint[i+1:]
+		}
+		e.URL = endpoint
+		webhookEndpoints = append(webhookEndpoints, e)
+	}
+	webhooks, err := pool.NewWebhooks(queue, secret, webhookEndpoints)
+	if err != nil {
+		return nil, ErrExplain{err, `Webhooks must be an http or https URL, optionally prefixed by known event topics, such as: --webhook "low_balance,last_host_offline=https://example.com/hook"`}
+	}
+	logger.Infof("Posting pool events to %d webhooks", len(webhookEndpoints))
+	return webhooks, nil
+}
+
+// loadAccessFile loads the ban and allow lists from a JSON file into the pool.
+func loadAccessFile(p *pool.VipnodePool, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := p.LoadAccessLists(f); err != nil {
 		return err
 	}
-	logger.Infof("Starting pool (version %s), listening on: %s", Version, options.Pool.Bind)
-	return http.ListenAndServe(options.Pool.Bind, handler)
+	logger.Infof("Loaded access lists: %s", path)
+	return nil
 }
 
 func unlockTransactor(keystorePath string) (*bind.TransactOpts, error) {
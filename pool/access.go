@@ -0,0 +1,171 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// addAccessEntry adds the target to the access list. A zero expires never
+// expires.
+func (p *VipnodePool) addAccessEntry(list store.AccessList, target string, reason string, expires time.Time) error {
+	target = store.NormalizeAccessTarget(target)
+	if target == "" {
+		return errors.New("missing access list target")
+	}
+	return p.Store.AddAccessEntry(list, store.AccessEntry{
+		Target:  target,
+		Reason:  reason,
+		Created: time.Now(),
+		Expires: expires,
+	})
+}
+
+// Ban prevents nodes matching the target from connecting, peering, or sending
+// updates to the pool. The target is a node ID, payout account, IP address,
+// or IP range in CIDR notation. A zero expires never expires.
+func (p *VipnodePool) Ban(target string, reason string, expires time.Time) error {
+	return p.addAccessEntry(store.BanList, target, reason, expires)
+}
+
+// matchingNodes returns the registered nodes that match the access target, by
+// their ID, payout account, or the IP address of their enode URI. If the store
+// can't list its nodes, only the node with the target as its ID is returned.
+func (p *VipnodePool) matchingNodes(target string) ([]store.Node, error) {
+	entry := store.AccessEntry{Target: store.NormalizeAccessTarget(target)}
+	lister, ok := p.Store.(nodeLister)
+	if !ok {
+		node, err := p.Store.GetNode(store.NodeID(entry.Target))
+		if err == store.ErrUnregisteredNode {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return []store.Node{*node}, nil
+	}
+	nodes, err := lister.AllNodes()
+	if err != nil {
+		return nil, err
+	}
+	matching := []store.Node{}
+	for _, node := range nodes {
+		if entry.Matches(node.ID, node.Payout, nodeURIIP(node.URI)) {
+			matching = append(matching, node)
+		}
+	}
+	return matching, nil
+}
+
+// Unban removes the target from the ban list.
+func (p *VipnodePool) Unban(target string) error {
+	return p.Store.RemoveAccessEntry(store.BanList, store.NormalizeAccessTarget(target))
+}
+
+// Allow adds the target to the allow list, which nodes must match to join the
+// pool if it's InviteOnly. The target is the same as with Ban.
+func (p *VipnodePool) Allow(target string, reason string, expires time.Time) error {
+	return p.addAccessEntry(store.AllowList, target, reason, expires)
+}
+
+// Disallow removes the target from the allow list.
+func (p *VipnodePool) Disallow(target string) error {
+	return p.Store.RemoveAccessEntry(store.AllowList, store.NormalizeAccessTarget(target))
+}
+
+// AccessListsFile is the format of the file loaded by LoadAccessLists.
+type AccessListsFile struct {
+	Ban   []store.AccessEntry `json:"ban"`
+	Allow []store.AccessEntry `json:"allow"`
+}
+
+// LoadAccessLists adds the entries of a JSON-encoded AccessListsFile to the
+// pool's ban and allow lists, replacing existing entries with the same
+// targets.
+func (p *VipnodePool) LoadAccessLists(r io.Reader) error {
+	var lists AccessListsFile
+	if err := json.NewDecoder(r).Decode(&lists); err != nil {
+		return err
+	}
+	for list, entries := range map[store.AccessList][]store.AccessEntry{
+		store.BanList:   lists.Ban,
+		store.AllowList: lists.Allow,
+	} {
+		for _, entry := range entries {
+			if err := p.addAccessEntry(list, entry.Target, entry.Reason, entry.Expires); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// accessRules is a snapshot of the access lists, for checking many nodes.
+type accessRules struct {
+	bans       []store.AccessEntry
+	allows     []store.AccessEntry
+	inviteOnly bool
+}
+
+func (p *VipnodePool) loadAccessRules() (*accessRules, error) {
+	bans, err := p.Store.AccessEntries(store.BanList)
+	if err != nil {
+		return nil, err
+	}
+	rules := &accessRules{
+		bans:       bans,
+		inviteOnly: p.InviteOnly,
+	}
+	if rules.inviteOnly {
+		rules.allows, err = p.Store.AccessEntries(store.AllowList)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// check returns a BannedError if the node matches the ban list, or a
+// NotAllowedError if the pool is invite-only and the node does not match the
+// allow list.
+func (rules *accessRules) check(nodeID store.NodeID, account store.Account, ip net.IP) error {
+	for _, entry := range rules.bans {
+		if entry.Matches(nodeID, account, ip) {
+			return BannedError{Ban: entry.Target, Reason: entry.Reason}
+		}
+	}
+	if !rules.inviteOnly {
+		return nil
+	}
+	for _, entry := range rules.allows {
+		if entry.Matches(nodeID, account, ip) {
+			return nil
+		}
+	}
+	return NotAllowedError{}
+}
+
+// checkAccess checks the node and the caller's IP address against the access
+// lists.
+func (p *VipnodePool) checkAccess(ctx context.Context, nodeID store.NodeID, account store.Account) error {
+	rules, err := p.loadAccessRules()
+	if err != nil {
+		return err
+	}
+	return rules.check(nodeID, account, net.ParseIP(remoteHostname(ctx)))
+}
+
+// nodeURIIP returns the IP address of an enode:// URI, or nil if it's not an
+// IP address.
+func nodeURIIP(nodeURI string) net.IP {
+	uri, err := url.Parse(nodeURI)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(uri.Hostname())
+}
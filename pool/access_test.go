@@ -0,0 +1,105 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/ethnode"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+)
+
+func TestAccessEntryMatches(t *testing.T) {
+	testcases := []struct {
+		Target  string
+		NodeID  store.NodeID
+		Account store.Account
+		IP      string
+		Want    bool
+	}{
+		{"foo", "foo", "", "", true},
+		{"foo", "bar", "", "", false},
+		{"0xAbC", "", "0xabc", "", true},
+		{"10.0.0.0/8", "", "", "10.1.2.3", true},
+		{"10.0.0.0/8", "10.0.0.0/8", "", "192.168.0.1", false},
+		{"10.0.0.1", "", "", "10.0.0.1", true},
+		{"10.0.0.1", "", "", "", false},
+		{"", "", "", "", false},
+	}
+	for i, tc := range testcases {
+		entry := store.AccessEntry{Target: tc.Target}
+		if got := entry.Matches(tc.NodeID, tc.Account, net.ParseIP(tc.IP)); got != tc.Want {
+			t.Errorf("case #%d: %q matches %+v = %t; want %t", i, tc.Target, tc, got, tc.Want)
+		}
+	}
+}
+
+func TestPoolAccessLists(t *testing.T) {
+	p := New(memory.New(), nil)
+	p.skipWhitelist = true
+
+	hosts := []store.Node{
+		{ID: "host1", URI: "enode://host1@10.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+		{ID: "host2", URI: "enode://host2@192.168.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), Payout: "0xabc"},
+		{ID: "host3", URI: "enode://host3@192.168.0.2:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+	}
+	for _, node := range append(hosts, store.Node{ID: "client", Kind: "geth", LastSeen: time.Now()}) {
+		if err := p.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := p.LoadAccessLists(strings.NewReader(`{
+		"ban": [
+			{"target": "10.0.0.0/8", "reason": "abuse"},
+			{"target": "0xABC"},
+			{"target": "expired", "expires": "2000-01-01T00:00:00Z"}
+		],
+		"allow": [{"target": "client"}, {"target": "host3"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hosts banned by IP range and payout account are not offered
+	got, err := p.requestHosts(context.Background(), "client", 3, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "host3" {
+		t.Errorf("wrong hosts: %v", got)
+	}
+
+	// Banned nodes can't send updates
+	if err := p.Ban("client", "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.checkAccess(context.Background(), "client", ""); err != (BannedError{Ban: "client"}) {
+		t.Errorf("expected BannedError, got: %v", err)
+	}
+	if err := p.Unban("client"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unban("expired"); err != store.ErrAccessEntryNotFound {
+		t.Errorf("expected expired entry to be gone, got: %v", err)
+	}
+
+	// Invite-only pools require the allow list
+	p.InviteOnly = true
+	connectReq := ConnectRequest{NodeInfo: ethnode.UserAgent{Kind: ethnode.Geth}}
+	if _, err := p.connect(context.Background(), "client", connectReq); err != nil {
+		t.Error(err)
+	}
+	if _, err := p.connect(context.Background(), "stranger", connectReq); err != (NotAllowedError{}) {
+		t.Errorf("expected NotAllowedError, got: %v", err)
+	}
+	if err := p.Disallow("client"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.requestHosts(context.Background(), "client", 3, "", nil); err != (NotAllowedError{}) {
+		t.Errorf("expected NotAllowedError for disallowed client, got: %v", err)
+	}
+}
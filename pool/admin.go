@@ -0,0 +1,402 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/internal/pretty"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// ErrNotOperator is returned when an admin request is signed by an address
+// that is not one of the pool's operators.
+var ErrNotOperator = errors.New("address is not a pool operator")
+
+// errNodeListUnsupported is returned when listing nodes from a store that
+// can't list all of its nodes.
+var errNodeListUnsupported = errors.New("store does not support listing nodes")
+
+// nodeLister is implemented by stores that can list all of their nodes.
+type nodeLister interface {
+	AllNodes() ([]store.Node, error)
+}
+
+// SetMaintenance toggles maintenance mode. While in maintenance mode, the pool
+// rejects new connections and peering requests, but nodes that are already
+// connected can continue sending updates.
+func (p *VipnodePool) SetMaintenance(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maintenance = enabled
+}
+
+// InMaintenance returns whether the pool is in maintenance mode.
+func (p *VipnodePool) InMaintenance() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maintenance
+}
+
+// Drain prepares the pool for shutting down. The pool stops accepting new
+// connections and peering requests like in maintenance mode, and forgets its
+// connected hosts so that closing their connections does not count against
+// their reputation.
+func (p *VipnodePool) Drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maintenance = true
+	p.remoteHosts = map[store.NodeID]jsonrpc2.Service{}
+	p.remoteNodeLookup = map[jsonrpc2.Service]store.NodeID{}
+}
+
+// Kick disconnects a node. Clients are disconnected by their hosts, and hosts
+// have their connection to the pool closed, through the cluster if they are
+// connected to another pool instance. Unless the node is also banned, it can
+// connect again.
+func (p *VipnodePool) Kick(ctx context.Context, nodeID store.NodeID) error {
+	node, err := p.Store.GetNode(nodeID)
+	if err != nil {
+		return err
+	}
+	p.Metrics.nodeGone(nodeID)
+	p.publish(Event{Topic: EventNodeDisconnected, NodeID: string(nodeID), Message: "kicked"})
+	if !node.IsHost {
+		peers, err := p.Store.NodePeers(nodeID)
+		if err != nil {
+			return err
+		}
+		return p.disconnectPeers(ctx, string(nodeID), peers)
+	}
+
+	ok, err := p.closeHost(nodeID)
+	if ok || err != nil {
+		return err
+	}
+	if p.Cluster != nil && node.Instance != "" && node.Instance != p.Cluster.ID {
+		return p.Cluster.kick(ctx, *node)
+	}
+	return nil
+}
+
+// closeHost closes the connection of a host that is connected to this pool
+// instance, and returns whether it was connected.
+func (p *VipnodePool) closeHost(nodeID store.NodeID) (bool, error) {
+	// Forget the remote before closing it, so that the disconnect does not
+	// count against the host's reputation.
+	p.mu.Lock()
+	remote, ok := p.remoteHosts[nodeID]
+	if ok {
+		delete(p.remoteHosts, nodeID)
+		delete(p.remoteNodeLookup, remote)
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	p.forks.Forget(nodeID)
+	p.publishLastHost(nodeID)
+	if closer, ok := remote.(interface{ Close() error }); ok {
+		return true, closer.Close()
+	}
+	return true, nil
+}
+
+// AdminNode is a node as seen by a pool operator.
+type AdminNode struct {
+	store.Node
+	Connected bool `json:"connected"` // Connected is whether the host has an open connection to the pool.
+}
+
+// AdminNodeResponse is returned on RPC calls to admin_node.
+type AdminNodeResponse struct {
+	Node       AdminNode             `json:"node"`
+	Peers      []store.Node          `json:"peers"`
+	Balance    store.Balance         `json:"balance"`
+	Reputation *store.HostReputation `json:"reputation,omitempty"`
+}
+
+// AdminService is an RPC service for pool operators to inspect and manage a
+// running pool. Every request must be signed by one of the Operators.
+type AdminService struct {
+	Pool *VipnodePool
+	// BalanceStore is used for viewing and adjusting balances. (Default: Pool.Store)
+	BalanceStore store.BalanceStore
+	// Operators are the wallet addresses that are allowed to make requests.
+	Operators []string
+}
+
+func (s *AdminService) verify(sig string, method string, operator string, nonce int64, args ...interface{}) error {
+	isOperator := false
+	for _, addr := range s.Operators {
+		if strings.EqualFold(addr, operator) {
+			isOperator = true
+			break
+		}
+	}
+	if !isOperator {
+		return VerifyFailedError{Cause: ErrNotOperator, Method: method}
+	}
+	return s.Pool.verify(sig, method, operator, nonce, args...)
+}
+
+func (s *AdminService) balanceStore() store.BalanceStore {
+	if s.BalanceStore != nil {
+		return s.BalanceStore
+	}
+	return s.Pool.Store
+}
+
+func (s *AdminService) adminNode(node store.Node) AdminNode {
+	s.Pool.mu.Lock()
+	defer s.Pool.mu.Unlock()
+	_, connected := s.Pool.remoteHosts[node.ID]
+	return AdminNode{
+		Node:      node,
+		Connected: connected,
+	}
+}
+
+// Nodes returns all of the nodes registered with the pool.
+func (s *AdminService) Nodes(ctx context.Context, sig string, operator string, nonce int64) ([]AdminNode, error) {
+	if err := s.verify(sig, "admin_nodes", operator, nonce); err != nil {
+		return nil, err
+	}
+
+	lister, ok := s.Pool.Store.(nodeLister)
+	if !ok {
+		return nil, errNodeListUnsupported
+	}
+	nodes, err := lister.AllNodes()
+	if err != nil {
+		return nil, err
+	}
+	r := make([]AdminNode, 0, len(nodes))
+	for _, node := range nodes {
+		r = append(r, s.adminNode(node))
+	}
+	return r, nil
+}
+
+// Node returns a node with its peers, balance, and reputation if it's a host.
+func (s *AdminService) Node(ctx context.Context, sig string, operator string, nonce int64, nodeID string) (*AdminNodeResponse, error) {
+	if err := s.verify(sig, "admin_node", operator, nonce, nodeID); err != nil {
+		return nil, err
+	}
+
+	node, err := s.Pool.Store.GetNode(store.NodeID(nodeID))
+	if err != nil {
+		return nil, err
+	}
+	peers, err := s.Pool.Store.NodePeers(node.ID)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := s.balanceStore().GetNodeBalance(node.ID)
+	if err != nil {
+		return nil, err
+	}
+	r := &AdminNodeResponse{
+		Node:    s.adminNode(*node),
+		Peers:   peers,
+		Balance: balance,
+	}
+	if node.IsHost {
+		rep, err := s.Pool.Store.GetHostReputation(node.ID)
+		if err != nil {
+			return nil, err
+		}
+		r.Reputation = &rep
+	}
+	return r, nil
+}
+
+// Kick disconnects a node, see VipnodePool.Kick.
+func (s *AdminService) Kick(ctx context.Context, sig string, operator string, nonce int64, nodeID string) error {
+	if err := s.verify(sig, "admin_kick", operator, nonce, nodeID); err != nil {
+		return err
+	}
+
+	logger.Printf("Operator %s kicked node: %q", operator, pretty.Abbrev(nodeID))
+	return s.Pool.Kick(ctx, store.NodeID(nodeID))
+}
+
+// expiresIn returns when an access list entry for the duration expires, or
+// zero if the duration is empty.
+func expiresIn(duration string) (time.Time, error) {
+	if duration == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid duration: %q", duration)
+	}
+	return time.Now().Add(d), nil
+}
+
+// Ban adds a node ID, payout account, IP address, or CIDR IP range to the ban
+// list for the duration (such as "24h"), or forever if the duration is empty.
+// Every registered node that the ban matches is also kicked, and KickErrors is
+// returned if any of them could not be.
+func (s *AdminService) Ban(ctx context.Context, sig string, operator string, nonce int64, target string, reason string, duration string) error {
+	if err := s.verify(sig, "admin_ban", operator, nonce, target, reason, duration); err != nil {
+		return err
+	}
+	expires, err := expiresIn(duration)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Pool.Ban(target, reason, expires); err != nil {
+		return err
+	}
+	logger.Printf("Operator %s banned %q: %s", operator, target, reason)
+
+	// Kick every node that the ban matches, so that clients are disconnected
+	// by their hosts and banned hosts lose their connection.
+	nodes, err := s.Pool.matchingNodes(target)
+	if err != nil {
+		return err
+	}
+	var errors []error
+	for _, node := range nodes {
+		if err := s.Pool.Kick(ctx, node.ID); err != nil && err != store.ErrUnregisteredNode {
+			logger.Printf("Failed to kick banned node %q: %s", node.ID, err)
+			errors = append(errors, err)
+		}
+	}
+	if len(errors) > 0 {
+		return KickErrors{Target: target, Errors: errors}
+	}
+	return nil
+}
+
+// Unban removes an entry from the ban list.
+func (s *AdminService) Unban(ctx context.Context, sig string, operator string, nonce int64, target string) error {
+	if err := s.verify(sig, "admin_unban", operator, nonce, target); err != nil {
+		return err
+	}
+
+	if err := s.Pool.Unban(target); err != nil {
+		return err
+	}
+	logger.Printf("Operator %s unbanned: %q", operator, target)
+	return nil
+}
+
+// Bans returns the entries of the ban list.
+func (s *AdminService) Bans(ctx context.Context, sig string, operator string, nonce int64) ([]store.AccessEntry, error) {
+	if err := s.verify(sig, "admin_bans", operator, nonce); err != nil {
+		return nil, err
+	}
+	return s.Pool.Store.AccessEntries(store.BanList)
+}
+
+// Allow adds an entry to the allow list for the duration, or forever if the
+// duration is empty. The allow list is only enforced if the pool is
+// invite-only.
+func (s *AdminService) Allow(ctx context.Context, sig string, operator string, nonce int64, target string, reason string, duration string) error {
+	if err := s.verify(sig, "admin_allow", operator, nonce, target, reason, duration); err != nil {
+		return err
+	}
+	expires, err := expiresIn(duration)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Pool.Allow(target, reason, expires); err != nil {
+		return err
+	}
+	logger.Printf("Operator %s allowed %q: %s", operator, target, reason)
+	return nil
+}
+
+// Disallow removes an entry from the allow list.
+func (s *AdminService) Disallow(ctx context.Context, sig string, operator string, nonce int64, target string) error {
+	if err := s.verify(sig, "admin_disallow", operator, nonce, target); err != nil {
+		return err
+	}
+
+	if err := s.Pool.Disallow(target); err != nil {
+		return err
+	}
+	logger.Printf("Operator %s disallowed: %q", operator, target)
+	return nil
+}
+
+// Allowed returns the entries of the allow list.
+func (s *AdminService) Allowed(ctx context.Context, sig string, operator string, nonce int64) ([]store.AccessEntry, error) {
+	if err := s.verify(sig, "admin_allowed", operator, nonce); err != nil {
+		return nil, err
+	}
+	return s.Pool.Store.AccessEntries(store.AllowList)
+}
+
+// AdjustBalance adds credit (in wei, can be negative) to the balance of a node
+// or a wallet account, returning the new balance. A reason is required, and is
+// logged with the adjustment.
+func (s *AdminService) AdjustBalance(ctx context.Context, sig string, operator string, nonce int64, target string, credit string, reason string) (*store.Balance, error) {
+	if err := s.verify(sig, "admin_adjustBalance", operator, nonce, target, credit, reason); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("missing reason for balance adjustment")
+	}
+	amount, ok := new(big.Int).SetString(credit, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid credit amount: %q", credit)
+	}
+
+	var balance store.Balance
+	var err error
+	balanceStore := s.balanceStore()
+	// Same heuristic as request.Verify: Short keys are wallet addresses.
+	if len(target) <= 42 {
+		account := store.Account(target)
+		if err = balanceStore.AddAccountBalance(account, amount); err != nil {
+			return nil, err
+		}
+		balance, err = balanceStore.GetAccountBalance(account)
+	} else {
+		nodeID := store.NodeID(target)
+		if err = balanceStore.AddNodeBalance(nodeID, amount); err != nil {
+			return nil, err
+		}
+		balance, err = balanceStore.GetNodeBalance(nodeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Printf("Operator %s adjusted balance of %q by %s wei (%s): %s", operator, pretty.Abbrev(target), amount, reason, balance.String())
+	return &balance, nil
+}
+
+// Federation returns the usage recorded with each federation partner, see
+// VipnodePool.FederationUsage.
+func (s *AdminService) Federation(ctx context.Context, sig string, operator string, nonce int64) ([]FederationUsage, error) {
+	if err := s.verify(sig, "admin_federation", operator, nonce); err != nil {
+		return nil, err
+	}
+	return s.Pool.FederationUsage(ctx, s.balanceStore())
+}
+
+// SetMaintenance toggles the pool's maintenance mode, see
+// VipnodePool.SetMaintenance.
+func (s *AdminService) SetMaintenance(ctx context.Context, sig string, operator string, nonce int64, enabled bool) error {
+	if err := s.verify(sig, "admin_setMaintenance", operator, nonce, enabled); err != nil {
+		return err
+	}
+
+	s.Pool.SetMaintenance(enabled)
+	logger.Printf("Operator %s set maintenance mode: %t", operator, enabled)
+	return nil
+}
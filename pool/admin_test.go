@@ -0,0 +1,190 @@
+package pool
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vipnode/vipnode/v2/ethnode"
+	"github.com/vipnode/vipnode/v2/internal/keygen"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+	"github.com/vipnode/vipnode/v2/request"
+)
+
+type closingService struct {
+	acceptingService
+	closed bool
+}
+
+func (s *closingService) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestAdminService(t *testing.T) {
+	// Wrapped like in the pool command, which the admin API must see through
+	p := New(NewMetrics().Store(memory.New()), nil)
+	operatorKey := keygen.HardcodedKeyIdx(t, 0)
+	operator := crypto.PubkeyToAddress(operatorKey.PublicKey).Hex()
+	p.Cluster = NewCluster("pool1", "secret")
+	admin := &AdminService{Pool: p, Operators: []string{operator}}
+
+	server, client := jsonrpc2.ServePipe()
+	if err := server.Server.Register("admin_", admin); err != nil {
+		t.Fatal(err)
+	}
+	call := func(privkey *ecdsa.PrivateKey, result interface{}, method string, args ...interface{}) error {
+		req := request.AddressRequest{
+			Method:    method,
+			Address:   operator,
+			Nonce:     time.Now().UnixNano(),
+			ExtraArgs: args,
+		}
+		signedArgs, err := req.SignedArgs(privkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client.Call(context.Background(), result, method, signedArgs...)
+	}
+
+	host := &closingService{}
+	rangeHost := &closingService{}
+	for _, node := range []store.Node{
+		{ID: "host", URI: "enode://host@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+		{ID: "rangehost", URI: "enode://rangehost@10.1.2.3:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+		{ID: "abroad", URI: "enode://abroad@10.4.5.6:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), Instance: "pool2"},
+		{ID: "client", Kind: "geth", LastSeen: time.Now()},
+	} {
+		if err := p.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.remoteHosts["host"] = host
+	p.remoteNodeLookup[host] = "host"
+	p.remoteHosts["rangehost"] = rangeHost
+	p.remoteNodeLookup[rangeHost] = "rangehost"
+
+	// Signed by a different key
+	if err := call(keygen.HardcodedKeyIdx(t, 1), nil, "admin_bans"); err == nil {
+		t.Error("expected verify error for non-operator signature")
+	}
+
+	var nodes []AdminNode
+	if err := call(operatorKey, &nodes, "admin_nodes"); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 4 {
+		t.Errorf("wrong number of nodes: %d", len(nodes))
+	}
+
+	var balance store.Balance
+	if err := call(operatorKey, &balance, "admin_adjustBalance", "client", "1000", ""); err == nil {
+		t.Error("expected error for missing reason")
+	}
+	if err := call(operatorKey, &balance, "admin_adjustBalance", "client", "1000", "refund"); err != nil {
+		t.Fatal(err)
+	}
+	if balance.Credit.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("wrong credit: %s", &balance.Credit)
+	}
+
+	var nodeResp AdminNodeResponse
+	if err := call(operatorKey, &nodeResp, "admin_node", "host"); err != nil {
+		t.Fatal(err)
+	}
+	if !nodeResp.Node.Connected || nodeResp.Reputation == nil {
+		t.Errorf("wrong host response: %+v", nodeResp)
+	}
+
+	// Banning a host kicks it
+	if err := call(operatorKey, nil, "admin_ban", "host", "abuse", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !host.closed {
+		t.Error("banned host was not kicked")
+	}
+	if p.NumRemotes() != 1 {
+		t.Errorf("kicked host remote was not removed")
+	}
+	// Banning an IP range kicks the hosts in it, even if some kicks fail
+	// because the host's pool instance is unknown
+	if err := call(operatorKey, nil, "admin_ban", "10.0.0.1/8", "", "1h"); err == nil {
+		t.Error("expected error kicking host on unknown pool instance")
+	}
+	if !rangeHost.closed || p.NumRemotes() != 0 {
+		t.Error("host in banned range was not kicked")
+	}
+	var bans []store.AccessEntry
+	if err := call(operatorKey, &bans, "admin_bans"); err != nil {
+		t.Fatal(err)
+	}
+	targets := []string{}
+	for _, ban := range bans {
+		targets = append(targets, ban.Target)
+	}
+	if want := []string{"10.0.0.0/8", "host"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("got bans %q; want %q", targets, want)
+	}
+
+	connectReq := ConnectRequest{NodeInfo: ethnode.UserAgent{Kind: ethnode.Geth}}
+	if _, err := p.connect(context.Background(), "host", connectReq); err == nil {
+		t.Error("expected banned node to fail connecting")
+	}
+	if err := call(operatorKey, nil, "admin_unban", "host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(operatorKey, nil, "admin_unban", "host"); err == nil {
+		t.Error("expected error unbanning a node that is not banned")
+	}
+
+	if err := call(operatorKey, nil, "admin_setMaintenance", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.connect(context.Background(), "client", connectReq); err != (MaintenanceError{}) {
+		t.Errorf("expected MaintenanceError, got: %v", err)
+	}
+	if err := call(operatorKey, nil, "admin_setMaintenance", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.connect(context.Background(), "client", connectReq); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	p := New(memory.New(), nil)
+	host := &closingService{}
+	if err := p.Store.SetNode(store.Node{ID: "host", IsHost: true, LastSeen: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	p.remoteHosts["host"] = host
+	p.remoteNodeLookup[host] = "host"
+
+	p.Drain()
+	if p.NumRemotes() != 0 {
+		t.Errorf("drained pool has remotes: %d", p.NumRemotes())
+	}
+
+	// Closing connections while shutting down is not the host's fault
+	if err := p.CloseRemote(host); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := p.Store.GetHostReputation("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.NumDisconnects != 0 {
+		t.Errorf("drained host was penalized: %+v", rep)
+	}
+
+	connectReq := ConnectRequest{NodeInfo: ethnode.UserAgent{Kind: ethnode.Geth}}
+	if _, err := p.connect(context.Background(), "client", connectReq); err != (MaintenanceError{}) {
+		t.Errorf("expected MaintenanceError, got: %v", err)
+	}
+}
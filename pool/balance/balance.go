@@ -7,16 +7,27 @@ import (
 	"github.com/vipnode/vipnode/v2/pool/store"
 )
 
+// ErrCodeLowBalance is the RPC error code used for LowBalanceError.
+const ErrCodeLowBalance = -32003
+
 // LowBalanceError is returned when the account's positive balance check fails.
 type LowBalanceError struct {
-	MinBalance     *big.Int
-	CurrentBalance *big.Int
+	MinBalance     *big.Int `json:"min_balance"`
+	CurrentBalance *big.Int `json:"current_balance"`
 }
 
 func (err LowBalanceError) Error() string {
 	return fmt.Sprintf("low balance error: Current balance (%d) is less than the required minimum (%d)", err.CurrentBalance, err.MinBalance)
 }
 
+func (err LowBalanceError) ErrorCode() int {
+	return ErrCodeLowBalance
+}
+
+func (err LowBalanceError) ErrorData() interface{} {
+	return err
+}
+
 // Manager is the minimal interface required to support a payment scheme. The
 // payment implementation will receive handler calls.
 // TODO: OnConnect, OnDisconnect, etc? OnConnect would be useful for time-based trials.
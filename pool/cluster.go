@@ -0,0 +1,248 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// ErrClusterSecret is returned when a relayed call from another pool
+// instance is not signed with the cluster secret, or the signature expired or
+// was already used.
+var ErrClusterSecret = errors.New("invalid cluster relay signature")
+
+// relayMaxAge is how long a relayed call's signature is valid for, which
+// allows for some clock drift between pool instances.
+const relayMaxAge = 30 * time.Second
+
+// relayMethods are the host methods that pool instances can relay to each
+// other's hosts.
+var relayMethods = map[string]struct{}{
+	"vipnode_whitelist":  {},
+	"vipnode_disconnect": {},
+}
+
+// HostNotConnectedError is returned when relaying a call to a host that is not
+// connected to the pool instance.
+type HostNotConnectedError struct {
+	NodeID   store.NodeID
+	Instance string
+}
+
+func (err HostNotConnectedError) Error() string {
+	return fmt.Sprintf("host %q is not connected to pool instance %q", err.NodeID, err.Instance)
+}
+
+// NewCluster returns a Cluster for the pool instance with the given ID.
+func NewCluster(instanceID string, secret string) *Cluster {
+	return &Cluster{
+		ID:     instanceID,
+		Secret: secret,
+		peers:  map[string]jsonrpc2.Service{},
+		seen:   map[string]time.Time{},
+	}
+}
+
+// Cluster links pool instances that share a store, so that any instance can
+// reach hosts that are connected to another instance. Each instance records
+// itself as the Node.Instance of the hosts that connect to it, and calls to
+// those hosts from other instances are relayed through ClusterService.
+type Cluster struct {
+	// ID is the name of this pool instance, unique within the cluster.
+	ID string
+	// Secret is shared by all instances to sign relayed calls. It is never
+	// sent over the connection.
+	Secret string
+
+	mu    sync.Mutex
+	peers map[string]jsonrpc2.Service
+	seen  map[string]time.Time // Signatures of recently relayed calls, to reject replays
+}
+
+// relaySignature returns the hex-encoded HMAC-SHA256 of the relayed call,
+// keyed with the cluster secret.
+func relaySignature(secret string, timestamp int64, nodeID string, method string, params []json.RawMessage) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s\n", timestamp, nodeID, method)
+	for _, param := range params {
+		// Params are compacted so that the signature doesn't depend on how
+		// they were encoded.
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, param); err != nil {
+			buf.Reset()
+			buf.Write(param)
+		}
+		buf.WriteByte('\n')
+		mac.Write(buf.Bytes())
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks that the relayed call was signed with the cluster secret
+// recently, and that its signature wasn't used before.
+func (c *Cluster) verify(sig string, timestamp int64, nodeID string, method string, params []json.RawMessage) error {
+	if c.Secret == "" {
+		return ErrClusterSecret
+	}
+	now := time.Now()
+	signed := time.Unix(timestamp, 0)
+	if signed.Before(now.Add(-relayMaxAge)) || signed.After(now.Add(relayMaxAge)) {
+		return ErrClusterSecret
+	}
+	if !hmac.Equal([]byte(sig), []byte(relaySignature(c.Secret, timestamp, nodeID, method, params))) {
+		return ErrClusterSecret
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for s, t := range c.seen {
+		if now.Sub(t) > 2*relayMaxAge {
+			delete(c.seen, s)
+		}
+	}
+	if _, ok := c.seen[sig]; ok {
+		return ErrClusterSecret
+	}
+	c.seen[sig] = signed
+	return nil
+}
+
+// AddPeer adds another pool instance, reachable by its cluster_ RPC service.
+func (c *Cluster) AddPeer(instanceID string, service jsonrpc2.Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peers[instanceID] = service
+}
+
+// relay returns a service which relays calls to the host through the
+// instance that it's connected to, if that instance is a known peer.
+func (c *Cluster) relay(host store.Node) (jsonrpc2.Service, bool) {
+	if host.Instance == "" || host.Instance == c.ID {
+		return nil, false
+	}
+	c.mu.Lock()
+	peer, ok := c.peers[host.Instance]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return &relayService{
+		peer:   peer,
+		secret: c.Secret,
+		hostID: host.ID,
+	}, true
+}
+
+// kick closes the connection of a host that is connected to another pool
+// instance.
+func (c *Cluster) kick(ctx context.Context, host store.Node) error {
+	c.mu.Lock()
+	peer, ok := c.peers[host.Instance]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("host %q is connected to unknown pool instance %q", host.ID, host.Instance)
+	}
+	timestamp := time.Now().Unix()
+	sig := relaySignature(c.Secret, timestamp, string(host.ID), "cluster_kick", nil)
+	return peer.Call(ctx, nil, "cluster_kick", sig, timestamp, host.ID)
+}
+
+// relayService is a jsonrpc2.Service for a host that is connected to another
+// pool instance.
+type relayService struct {
+	peer   jsonrpc2.Service
+	secret string
+	hostID store.NodeID
+}
+
+func (s *relayService) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	rawParams := make([]json.RawMessage, 0, len(params))
+	for _, param := range params {
+		raw, err := json.Marshal(param)
+		if err != nil {
+			return err
+		}
+		rawParams = append(rawParams, raw)
+	}
+	timestamp := time.Now().Unix()
+	sig := relaySignature(s.secret, timestamp, string(s.hostID), method, rawParams)
+
+	var raw json.RawMessage
+	if err := s.peer.Call(ctx, &raw, "cluster_relay", sig, timestamp, s.hostID, method, rawParams); err != nil {
+		return err
+	}
+	if result == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// ClusterService is the RPC service that pool instances use to relay calls to
+// the hosts connected to this instance.
+type ClusterService struct {
+	Pool *VipnodePool
+}
+
+// Relay calls a method on a host connected to this instance, on behalf of
+// another instance in the cluster. The call must be signed with the cluster
+// secret within relayMaxAge of the timestamp, see relaySignature.
+func (s *ClusterService) Relay(ctx context.Context, sig string, timestamp int64, nodeID string, method string, params []json.RawMessage) (json.RawMessage, error) {
+	cluster := s.Pool.Cluster
+	if cluster == nil {
+		return nil, ErrClusterSecret
+	}
+	if err := cluster.verify(sig, timestamp, nodeID, method, params); err != nil {
+		return nil, err
+	}
+	if _, ok := relayMethods[method]; !ok {
+		return nil, fmt.Errorf("method cannot be relayed: %q", method)
+	}
+
+	s.Pool.mu.Lock()
+	remote, ok := s.Pool.remoteHosts[store.NodeID(nodeID)]
+	s.Pool.mu.Unlock()
+	if !ok {
+		return nil, HostNotConnectedError{NodeID: store.NodeID(nodeID), Instance: cluster.ID}
+	}
+
+	args := make([]interface{}, 0, len(params))
+	for _, param := range params {
+		args = append(args, param)
+	}
+	var result json.RawMessage
+	if err := remote.Call(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Kick closes the connection of a host connected to this instance, on behalf
+// of another instance in the cluster. The call must be signed with the cluster
+// secret like Relay, with "cluster_kick" as the method and no params.
+func (s *ClusterService) Kick(ctx context.Context, sig string, timestamp int64, nodeID string) error {
+	cluster := s.Pool.Cluster
+	if cluster == nil {
+		return ErrClusterSecret
+	}
+	if err := cluster.verify(sig, timestamp, nodeID, "cluster_kick", nil); err != nil {
+		return err
+	}
+	ok, err := s.Pool.closeHost(store.NodeID(nodeID))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return HostNotConnectedError{NodeID: store.NodeID(nodeID), Instance: cluster.ID}
+	}
+	return nil
+}
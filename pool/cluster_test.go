@@ -0,0 +1,93 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+)
+
+type recordingService struct {
+	calls []string
+}
+
+func (s *recordingService) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	s.calls = append(s.calls, method)
+	return nil
+}
+
+func TestClusterRelay(t *testing.T) {
+	poolStore := memory.New()
+	p1, p2 := New(poolStore, nil), New(poolStore, nil)
+	p1.Cluster = NewCluster("pool1", "secret")
+	p2.Cluster = NewCluster("pool2", "secret")
+
+	peer := &jsonrpc2.Local{}
+	if err := peer.Server.Register("cluster_", &ClusterService{Pool: p2}); err != nil {
+		t.Fatal(err)
+	}
+	p1.Cluster.AddPeer("pool2", peer)
+
+	host := store.Node{ID: "host", URI: "enode://host@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), Instance: "pool2"}
+	if err := poolStore.SetNode(host); err != nil {
+		t.Fatal(err)
+	}
+	remote := &recordingService{}
+	p2.remoteHosts[host.ID] = remote
+
+	// Disconnects are relayed to the host's instance
+	if err := p1.disconnectPeers(context.Background(), "client", []store.Node{host}); err != nil {
+		t.Fatal(err)
+	}
+	if len(remote.calls) != 1 || remote.calls[0] != "vipnode_disconnect" {
+		t.Errorf("wrong relayed calls: %q", remote.calls)
+	}
+
+	svc := &ClusterService{Pool: p2}
+	relay := func(secret string, timestamp int64, nodeID string, method string, params ...json.RawMessage) (json.RawMessage, error) {
+		sig := relaySignature(secret, timestamp, nodeID, method, params)
+		return svc.Relay(context.Background(), sig, timestamp, nodeID, method, params)
+	}
+	now := time.Now().Unix()
+	if _, err := relay("wrong", now, "host", "vipnode_whitelist"); err != ErrClusterSecret {
+		t.Errorf("expected ErrClusterSecret, got: %v", err)
+	}
+	if _, err := relay("secret", now-int64(2*relayMaxAge/time.Second), "host", "vipnode_whitelist"); err != ErrClusterSecret {
+		t.Errorf("expected ErrClusterSecret for expired signature, got: %v", err)
+	}
+	sig := relaySignature("secret", now, "host", "vipnode_whitelist", []json.RawMessage{json.RawMessage(`"client"`)})
+	if _, err := svc.Relay(context.Background(), sig, now, "host", "vipnode_whitelist", []json.RawMessage{json.RawMessage(`"other"`)}); err != ErrClusterSecret {
+		t.Errorf("expected ErrClusterSecret for changed params, got: %v", err)
+	}
+	if _, err := svc.Relay(context.Background(), sig, now, "host", "vipnode_whitelist", []json.RawMessage{json.RawMessage(`"client"`)}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := svc.Relay(context.Background(), sig, now, "host", "vipnode_whitelist", []json.RawMessage{json.RawMessage(`"client"`)}); err != ErrClusterSecret {
+		t.Errorf("expected ErrClusterSecret for replayed call, got: %v", err)
+	}
+	if _, err := relay("secret", now, "host", "admin_ban"); err == nil {
+		t.Error("expected error relaying a non-host method")
+	}
+	if _, err := relay("secret", now, "other", "vipnode_whitelist"); err == nil {
+		t.Error("expected HostNotConnectedError")
+	} else if _, ok := err.(HostNotConnectedError); !ok {
+		t.Errorf("expected HostNotConnectedError, got: %v", err)
+	}
+
+	// Kicks are relayed to the host's instance
+	closing := &closingService{}
+	p2.remoteHosts[host.ID] = closing
+	if err := p1.Kick(context.Background(), host.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !closing.closed || p2.NumRemotes() != 0 {
+		t.Error("host on other instance was not kicked")
+	}
+	if err := p1.Kick(context.Background(), host.ID); err == nil {
+		t.Error("expected HostNotConnectedError kicking a closed host")
+	}
+}
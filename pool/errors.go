@@ -1,13 +1,36 @@
 package pool
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/balance"
+)
+
+// Error codes used in RPC error responses from the pool, so that clients can
+// reconstruct the typed errors.
+const (
+	ErrCodeNoHostNodes  = -32001
+	ErrCodeVerifyFailed = -32002
+	ErrCodeLowBalance   = balance.ErrCodeLowBalance
+	ErrCodeMaintenance  = -32006 // -32005 is jsonrpc2.ErrCodeLimitExceeded
+	ErrCodeBanned       = -32007
+	ErrCodeNotAllowed   = -32008
 )
 
 // NoHostNodesError is returned when the pool does not have any hosts available.
 type NoHostNodesError struct {
-	NumTried int
+	NumTried int `json:"num_tried"`
+}
+
+func (err NoHostNodesError) ErrorCode() int {
+	return ErrCodeNoHostNodes
+}
+
+func (err NoHostNodesError) ErrorData() interface{} {
+	return err
 }
 
 func (err NoHostNodesError) Error() string {
@@ -28,6 +51,68 @@ func (err VerifyFailedError) Error() string {
 	return fmt.Sprintf("method %q failed to verify signature: %s", err.Method, err.Cause)
 }
 
+func (err VerifyFailedError) ErrorCode() int {
+	return ErrCodeVerifyFailed
+}
+
+func (err VerifyFailedError) ErrorData() interface{} {
+	return verifyFailedData{
+		Method: err.Method,
+		Cause:  err.Cause.Error(),
+	}
+}
+
+type verifyFailedData struct {
+	Method string `json:"method"`
+	Cause  string `json:"cause"`
+}
+
+// MaintenanceError is returned when the pool is in maintenance mode and is
+// not accepting new connections or peering requests.
+type MaintenanceError struct{}
+
+func (err MaintenanceError) Error() string {
+	return "pool is in maintenance mode, try again later"
+}
+
+func (err MaintenanceError) ErrorCode() int {
+	return ErrCodeMaintenance
+}
+
+// BannedError is returned when a node matches an entry of the pool's ban
+// list.
+type BannedError struct {
+	Ban    string `json:"ban"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (err BannedError) Error() string {
+	if err.Reason == "" {
+		return fmt.Sprintf("banned from pool: %s", err.Ban)
+	}
+	return fmt.Sprintf("banned from pool: %s (%s)", err.Ban, err.Reason)
+}
+
+func (err BannedError) ErrorCode() int {
+	return ErrCodeBanned
+}
+
+func (err BannedError) ErrorData() interface{} {
+	return err
+}
+
+// NotAllowedError is returned when the pool is invite-only and a node does
+// not match any entry of the pool's allow list.
+type NotAllowedError struct{}
+
+func (err NotAllowedError) Error() string {
+	return "pool is invite-only and node is not on the allow list"
+}
+
+func (err NotAllowedError) ErrorCode() int {
+	return ErrCodeNotAllowed
+}
+
 // RemoteHostErrors is used when a subset of RPC calls to hosts fail.
 type RemoteHostErrors struct {
 	Method string
@@ -49,3 +134,62 @@ func (err RemoteHostErrors) Error() string {
 	}
 	return s.String()
 }
+
+// KickErrors is used when a ban took effect, but some of the nodes that it
+// matches could not be kicked.
+type KickErrors struct {
+	Target string
+	Errors []error
+}
+
+func (err KickErrors) Error() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "banned %q, but failed to kick %d nodes: ", err.Target, len(err.Errors))
+	for i, e := range err.Errors {
+		s.WriteString(e.Error())
+		if i != len(err.Errors)-1 {
+			s.WriteString("; ")
+		}
+	}
+	return s.String()
+}
+
+// remoteError reconstructs the typed pool error from an RPC error response,
+// if it has a known error code. Other errors are returned as-is.
+func remoteError(err error) error {
+	errResp, ok := err.(*jsonrpc2.ErrResponse)
+	if !ok {
+		return err
+	}
+
+	switch errResp.Code {
+	case ErrCodeNoHostNodes:
+		var typedErr NoHostNodesError
+		if errResp.UnmarshalData(&typedErr) == nil {
+			return typedErr
+		}
+	case ErrCodeVerifyFailed:
+		var data verifyFailedData
+		if errResp.UnmarshalData(&data) == nil {
+			return VerifyFailedError{
+				Cause:  errors.New(data.Cause),
+				Method: data.Method,
+			}
+		}
+	case ErrCodeMaintenance:
+		return MaintenanceError{}
+	case ErrCodeBanned:
+		var typedErr BannedError
+		if errResp.UnmarshalData(&typedErr) == nil {
+			return typedErr
+		}
+	case ErrCodeNotAllowed:
+		return NotAllowedError{}
+	case ErrCodeLowBalance:
+		var typedErr balance.LowBalanceError
+		if errResp.UnmarshalData(&typedErr) == nil {
+			return typedErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,323 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// EventTopic is the kind of an Event, used to filter subscriptions.
+type EventTopic string
+
+const (
+	// EventNodeConnected is published when a node connects to the pool.
+	EventNodeConnected EventTopic = "node_connected"
+	// EventNodeDisconnected is published when a host's connection to the pool
+	// closes, or when an operator kicks a node.
+	EventNodeDisconnected EventTopic = "node_disconnected"
+	// EventHostWhitelisted is published when a host whitelists a client that
+	// requested peers.
+	EventHostWhitelisted EventTopic = "host_whitelisted"
+	// EventPeersInvalidated is published when a node's peers are no longer
+	// corroborated by the pool.
+	EventPeersInvalidated EventTopic = "peers_invalidated"
+	// EventLowBalance is published when a client is disconnected from its
+	// hosts because its balance is too low.
+	EventLowBalance EventTopic = "low_balance"
+	// EventWithdrawSettled is published when an account's withdraw is
+	// settled.
+	EventWithdrawSettled EventTopic = "withdraw_settled"
+	// EventSettleFailed is published when an account's withdraw could not be
+	// settled, such as when the settlement transaction fails.
+	EventSettleFailed EventTopic = "settle_failed"
+	// EventLastHostOffline is published when the last connected host of a
+	// kind and network disconnects.
+	EventLastHostOffline EventTopic = "last_host_offline"
+	// EventBalanceFallback is published when the payment contract's balance
+	// subscription fails, and deposits fall back to an expiration cache.
+	EventBalanceFallback EventTopic = "balance_fallback"
+	// EventHostForked is published when a host keeps reporting different
+	// block hashes than the majority of hosts for the same block numbers, and
+	// is penalized.
+	EventHostForked EventTopic = "host_forked"
+)
+
+// EventTopics are all of the topics that can be subscribed to.
+var EventTopics = []EventTopic{
+	EventNodeConnected,
+	EventNodeDisconnected,
+	EventHostWhitelisted,
+	EventPeersInvalidated,
+	EventLowBalance,
+	EventWithdrawSettled,
+	EventSettleFailed,
+	EventLastHostOffline,
+	EventBalanceFallback,
+	EventHostForked,
+}
+
+// eventBufferSize is the number of events that are queued for a subscriber
+// before newer events are dropped.
+const eventBufferSize = 100
+
+// eventNotifyTimeout is how long sending an event to a subscriber can take
+// before it's unsubscribed.
+const eventNotifyTimeout = 10 * time.Second
+
+// Event is something that happened in the pool, which is sent to subscribers
+// with a pool_event notification.
+type Event struct {
+	Topic EventTopic `json:"topic"`
+	Time  time.Time  `json:"time"`
+	// NodeID is the node that the event is about.
+	NodeID string `json:"node_id,omitempty"`
+	// Account is the account that the event is about.
+	Account store.Account `json:"account,omitempty"`
+	// Peers are the related nodes, such as the client that a host
+	// whitelisted, or the peers that were invalidated.
+	Peers []string `json:"peers,omitempty"`
+	// Balance is the node's balance for low_balance events, or the
+	// account's new balance for withdraw_settled events.
+	Balance *store.Balance `json:"balance,omitempty"`
+	// Message describes the event, such as the reason for a disconnect or the
+	// transaction ID of a withdraw.
+	Message string `json:"message,omitempty"`
+}
+
+// NewEvents returns an empty set of event subscriptions.
+func NewEvents() *Events {
+	return &Events{
+		subscribers: map[jsonrpc2.Notifier]*subscriber{},
+	}
+}
+
+// Events publishes pool events to subscribers. Each subscriber has a queue of
+// events, so that slow subscribers don't hold up the pool. Events are dropped
+// for subscribers whose queue is full.
+type Events struct {
+	mu          sync.Mutex
+	subscribers map[jsonrpc2.Notifier]*subscriber
+}
+
+type subscriber struct {
+	topics map[EventTopic]struct{}
+	queue  chan Event
+	done   chan struct{}
+}
+
+func (s *subscriber) serve(events *Events, remote jsonrpc2.Notifier) {
+	for {
+		select {
+		case event := <-s.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), eventNotifyTimeout)
+			err := remote.Notify(ctx, "pool_event", event)
+			cancel()
+			if err != nil {
+				logger.Printf("Unsubscribing from events after failed notification: %s", err)
+				events.Unsubscribe(remote)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// parseTopics returns the set of topics, or all topics if none are given.
+func parseTopics(topics []string) (map[EventTopic]struct{}, error) {
+	r := make(map[EventTopic]struct{}, len(EventTopics))
+	if len(topics) == 0 {
+		for _, topic := range EventTopics {
+			r[topic] = struct{}{}
+		}
+		return r, nil
+	}
+	for _, topic := range topics {
+		found := false
+		for _, known := range EventTopics {
+			if EventTopic(topic) == known {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown event topic: %q", topic)
+		}
+		r[EventTopic(topic)] = struct{}{}
+	}
+	return r, nil
+}
+
+// Subscribe sends events matching the topics to the remote as pool_event
+// notifications, or events of all topics if none are given. Subscribing a
+// remote again replaces its topics.
+func (e *Events) Subscribe(remote jsonrpc2.Notifier, topics []string) error {
+	filter, err := parseTopics(topics)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if sub, ok := e.subscribers[remote]; ok {
+		sub.topics = filter
+		return nil
+	}
+	sub := &subscriber{
+		topics: filter,
+		queue:  make(chan Event, eventBufferSize),
+		done:   make(chan struct{}),
+	}
+	e.subscribers[remote] = sub
+	go sub.serve(e, remote)
+	return nil
+}
+
+// Unsubscribe stops sending events to the remote, such as when its
+// connection is closed.
+func (e *Events) Unsubscribe(remote jsonrpc2.Notifier) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sub, ok := e.subscribers[remote]
+	if !ok {
+		return
+	}
+	delete(e.subscribers, remote)
+	close(sub.done)
+}
+
+// NumSubscribers returns the number of remotes that are subscribed.
+func (e *Events) NumSubscribers() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.subscribers)
+}
+
+// Publish queues the event for the subscribers of its topic. If the event's
+// Time is not set, it's set to now.
+func (e *Events) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, sub := range e.subscribers {
+		if _, ok := sub.topics[event.Topic]; !ok {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			// Subscriber is falling behind, drop the event
+		}
+	}
+}
+
+// publish publishes the event if the pool has Events.
+func (p *VipnodePool) publish(event Event) {
+	if p.Events == nil {
+		return
+	}
+	p.Events.Publish(event)
+}
+
+// publishLastHost publishes EventLastHostOffline if the host that
+// disconnected was the last connected host of its kind and network.
+func (p *VipnodePool) publishLastHost(nodeID store.NodeID) {
+	if p.Events == nil {
+		return
+	}
+	host, err := p.Store.GetNode(nodeID)
+	if err != nil || !host.IsHost {
+		return
+	}
+	hosts, err := p.Store.ActiveHosts(host.Kind, 0)
+	if err != nil {
+		logger.Printf("Failed to check for remaining hosts of kind %q: %s", host.Kind, err)
+		return
+	}
+	p.mu.Lock()
+	for _, other := range hosts {
+		if other.ID == host.ID || other.Network != host.Network {
+			continue
+		}
+		if _, ok := p.hostRemoteLocked(other); ok {
+			p.mu.Unlock()
+			return
+		}
+	}
+	p.mu.Unlock()
+
+	kind := host.Kind
+	if kind == "" {
+		kind = "unknown"
+	}
+	p.publish(Event{
+		Topic:   EventLastHostOffline,
+		NodeID:  string(nodeID),
+		Message: fmt.Sprintf("no %s hosts are connected on %s", kind, host.Network),
+	})
+}
+
+// ErrSubscribeNotSupported is returned when subscribing over a connection
+// that can't receive notifications, such as HTTP.
+var ErrSubscribeNotSupported = errors.New("subscriptions require a websocket connection")
+
+// EventService is the RPC service for subscribing to pool events. Events
+// include node IDs, payout accounts and host URIs, so only pool operators can
+// subscribe.
+type EventService struct {
+	Events *Events
+	// Admin verifies that subscriptions are signed by one of its Operators.
+	// Subscriptions are rejected if it's nil.
+	Admin *AdminService
+}
+
+// Subscribe sends pool_event notifications for the given topics over the
+// caller's connection until it unsubscribes or disconnects. All topics are
+// subscribed to if none are given. It returns the subscribed topics. The
+// request must be signed by a pool operator, like admin requests.
+func (s *EventService) Subscribe(ctx context.Context, sig string, operator string, nonce int64, topics []string) ([]EventTopic, error) {
+	if s.Admin == nil {
+		return nil, VerifyFailedError{Cause: ErrNotOperator, Method: "pool_subscribe"}
+	}
+	if err := s.Admin.verify(sig, "pool_subscribe", operator, nonce, topics); err != nil {
+		return nil, err
+	}
+	service, err := jsonrpc2.CtxService(ctx)
+	if err != nil {
+		return nil, ErrSubscribeNotSupported
+	}
+	remote, ok := service.(jsonrpc2.Notifier)
+	if !ok {
+		return nil, ErrSubscribeNotSupported
+	}
+	if err := s.Events.Subscribe(remote, topics); err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 {
+		return EventTopics, nil
+	}
+	r := make([]EventTopic, 0, len(topics))
+	for _, topic := range topics {
+		r = append(r, EventTopic(topic))
+	}
+	return r, nil
+}
+
+// Unsubscribe stops sending pool_event notifications to the caller.
+func (s *EventService) Unsubscribe(ctx context.Context) error {
+	service, err := jsonrpc2.CtxService(ctx)
+	if err != nil {
+		return ErrSubscribeNotSupported
+	}
+	if remote, ok := service.(jsonrpc2.Notifier); ok {
+		s.Events.Unsubscribe(remote)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package pool
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vipnode/vipnode/v2/internal/keygen"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+	"github.com/vipnode/vipnode/v2/request"
+)
+
+// EventRecorder receives pool_event notifications. It's exported so that it
+// can be registered as an RPC receiver.
+type EventRecorder struct {
+	events chan Event
+}
+
+func (r *EventRecorder) Event(ctx context.Context, event Event) error {
+	r.events <- event
+	return nil
+}
+
+func TestEventService(t *testing.T) {
+	events := NewEvents()
+	operatorKey := keygen.HardcodedKeyIdx(t, 0)
+	operator := crypto.PubkeyToAddress(operatorKey.PublicKey).Hex()
+	admin := &AdminService{Pool: New(memory.New(), nil), Operators: []string{operator}}
+
+	server, client := jsonrpc2.ServePipe()
+	if err := server.Server.Register("pool_", &EventService{Events: events, Admin: admin}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &EventRecorder{events: make(chan Event, 10)}
+	if err := client.Server.Register("pool_", recorder); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	subscribe := func(privkey *ecdsa.PrivateKey, result interface{}, topics []string) error {
+		req := request.AddressRequest{
+			Method:    "pool_subscribe",
+			Address:   operator,
+			Nonce:     time.Now().UnixNano(),
+			ExtraArgs: []interface{}{topics},
+		}
+		signedArgs, err := req.SignedArgs(privkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client.Call(ctx, result, "pool_subscribe", signedArgs...)
+	}
+
+	var topics []EventTopic
+	if err := client.Call(ctx, &topics, "pool_subscribe", []string{string(EventNodeConnected)}); err == nil {
+		t.Error("expected error subscribing without a signature")
+	}
+	if err := subscribe(keygen.HardcodedKeyIdx(t, 1), &topics, []string{string(EventNodeConnected)}); err == nil {
+		t.Error("expected error subscribing as a non-operator")
+	}
+	if events.NumSubscribers() != 0 {
+		t.Errorf("wrong number of subscribers: %d", events.NumSubscribers())
+	}
+	if err := subscribe(operatorKey, &topics, []string{"not_a_topic"}); err == nil {
+		t.Error("expected error subscribing to an unknown topic")
+	}
+	if err := subscribe(operatorKey, &topics, []string{string(EventNodeConnected)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 1 || topics[0] != EventNodeConnected {
+		t.Errorf("wrong subscribed topics: %q", topics)
+	}
+	if events.NumSubscribers() != 1 {
+		t.Errorf("wrong number of subscribers: %d", events.NumSubscribers())
+	}
+
+	events.Publish(Event{Topic: EventLowBalance, NodeID: "filtered"})
+	events.Publish(Event{Topic: EventNodeConnected, NodeID: "foo"})
+	select {
+	case event := <-recorder.events:
+		if event.Topic != EventNodeConnected || event.NodeID != "foo" {
+			t.Errorf("wrong event: %+v", event)
+		}
+		if event.Time.IsZero() {
+			t.Error("event time was not set")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	// Subscribing again replaces the topics
+	if err := subscribe(operatorKey, &topics, []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != len(EventTopics) {
+		t.Errorf("wrong subscribed topics: %q", topics)
+	}
+	events.Publish(Event{Topic: EventLowBalance, NodeID: "bar"})
+	select {
+	case event := <-recorder.events:
+		if event.Topic != EventLowBalance || event.NodeID != "bar" {
+			t.Errorf("wrong event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	if err := client.Call(ctx, nil, "pool_unsubscribe"); err != nil {
+		t.Fatal(err)
+	}
+	if events.NumSubscribers() != 0 {
+		t.Errorf("wrong number of subscribers: %d", events.NumSubscribers())
+	}
+}
+
+func TestPoolEvents(t *testing.T) {
+	p := New(memory.New(), nil)
+	p.Events = NewEvents()
+	recorder := &EventRecorder{events: make(chan Event, 10)}
+	local := &jsonrpc2.Local{}
+	if err := local.Server.Register("pool_", recorder); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Events.Subscribe(local, []string{string(EventNodeDisconnected), string(EventLastHostOffline)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, node := range []store.Node{
+		{ID: "host", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+		{ID: "other", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+	} {
+		if err := p.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+		remote := &closingService{}
+		p.remoteHosts[node.ID] = remote
+		p.remoteNodeLookup[remote] = node.ID
+	}
+
+	expect := func(want Event) {
+		t.Helper()
+		select {
+		case event := <-recorder.events:
+			if event.Topic != want.Topic || event.NodeID != want.NodeID {
+				t.Errorf("got event %+v; want %+v", event, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for event: %+v", want)
+		}
+	}
+
+	// Another geth host is still connected
+	if err := p.CloseRemote(p.remoteHosts["host"]); err != nil {
+		t.Fatal(err)
+	}
+	expect(Event{Topic: EventNodeDisconnected, NodeID: "host"})
+
+	if err := p.CloseRemote(p.remoteHosts["other"]); err != nil {
+		t.Fatal(err)
+	}
+	expect(Event{Topic: EventNodeDisconnected, NodeID: "other"})
+	expect(Event{Topic: EventLastHostOffline, NodeID: "other"})
+}
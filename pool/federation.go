@@ -0,0 +1,438 @@
+package pool
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vipnode/vipnode/v2/ethnode"
+	"github.com/vipnode/vipnode/v2/internal/pretty"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/request"
+)
+
+// ErrNotPartner is returned when a federation request is signed by an
+// address that is not one of the pool's federation partners.
+var ErrNotPartner = errors.New("address is not a federation partner")
+
+// ErrNotFederated is returned when a partner pool refers to a node that does
+// not belong to it.
+var ErrNotFederated = errors.New("node does not belong to the partner pool")
+
+// FederationPeerRequest is the request for federation_peer, made by a pool on
+// behalf of one of its clients.
+type FederationPeerRequest struct {
+	NodeID    string            `json:"node_id"`
+	Kind      string            `json:"kind"`
+	Network   ethnode.NetworkID `json:"network"`
+	Protocols []string          `json:"protocols,omitempty"`
+	Num       int               `json:"num"`
+}
+
+// FederationPeerResponse is the response for federation_peer, with the hosts
+// that whitelisted the client.
+type FederationPeerResponse struct {
+	Peers []store.Node `json:"peers"`
+}
+
+// FederationUpdateRequest is the request for federation_update, made by a
+// pool when one of its clients reports its peers.
+type FederationUpdateRequest struct {
+	NodeID      string   `json:"node_id"`
+	Peers       []string `json:"peers"` // Peers are the node IDs of the partner's hosts that the client is connected to.
+	BlockNumber uint64   `json:"block_number"`
+}
+
+// FederationUpdateResponse is the response for federation_update.
+type FederationUpdateResponse struct {
+	ActivePeers []store.Node   `json:"active_peers"`
+	Balance     *store.Balance `json:"balance"` // Balance is the requesting pool's account on the partner.
+}
+
+// FederationUsage is the usage between the pool and a federation partner,
+// as recorded by each of them. Local is the partner's account on this pool,
+// credited for this pool's clients using the partner's hosts. Remote is this
+// pool's account on the partner, debited for the same usage. The pools are
+// reconciled when the operators settle the difference and adjust both
+// accounts back towards zero.
+type FederationUsage struct {
+	Partner string         `json:"partner"`
+	Local   store.Balance  `json:"local"`
+	Remote  *store.Balance `json:"remote,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// NewFederation returns a Federation for the pool identified by the private
+// key.
+func NewFederation(privkey *ecdsa.PrivateKey) *Federation {
+	return &Federation{
+		Address:  crypto.PubkeyToAddress(privkey.PublicKey).Hex(),
+		privkey:  privkey,
+		partners: map[string]jsonrpc2.Service{},
+	}
+}
+
+// Federation links independent pools, so that a pool without enough hosts of
+// its own can request hosts from its partners on behalf of its clients. Each
+// pool signs its requests with its own key, and keeps an account for each
+// partner to track the usage of the partner's hosts.
+type Federation struct {
+	// Address is the wallet address of the pool's key, which identifies it
+	// to its partners.
+	Address string
+
+	privkey *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	partners  map[string]jsonrpc2.Service
+	lastNonce int64
+}
+
+// AddPartner adds a partner pool by the address of its key, reachable by its
+// federation_ RPC service.
+func (f *Federation) AddPartner(address string, service jsonrpc2.Service) error {
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("invalid federation partner address: %q", address)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.partners[common.HexToAddress(address).Hex()] = service
+	return nil
+}
+
+// Partners returns the addresses of the partner pools.
+func (f *Federation) Partners() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := make([]string, 0, len(f.partners))
+	for address := range f.partners {
+		r = append(r, address)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (f *Federation) partner(address string) (jsonrpc2.Service, bool) {
+	if !common.IsHexAddress(address) {
+		return nil, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	service, ok := f.partners[common.HexToAddress(address).Hex()]
+	return service, ok
+}
+
+// nextNonce returns an increasing nonce, even for requests made within the
+// same clock tick.
+func (f *Federation) nextNonce() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	nonce := time.Now().UnixNano()
+	if nonce <= f.lastNonce {
+		nonce = f.lastNonce + 1
+	}
+	f.lastNonce = nonce
+	return nonce
+}
+
+// call makes a signed request to the partner pool.
+func (f *Federation) call(ctx context.Context, partner string, result interface{}, method string, args ...interface{}) error {
+	service, ok := f.partner(partner)
+	if !ok {
+		return ErrNotPartner
+	}
+	req := request.AddressRequest{
+		Method:    method,
+		Address:   f.Address,
+		Nonce:     f.nextNonce(),
+		ExtraArgs: args,
+	}
+	signedArgs, err := req.SignedArgs(f.privkey)
+	if err != nil {
+		return err
+	}
+	return remoteError(service.Call(ctx, result, method, signedArgs...))
+}
+
+// federationAccount is the account that tracks the usage between the pool
+// and the partner.
+func federationAccount(partner string) store.Account {
+	return store.Account(common.HexToAddress(partner).Hex())
+}
+
+// setFederatedNode saves a node that belongs to a partner pool, linked to the
+// partner's account so that balance changes to the node are accounted to the
+// partner. Nodes that belong to this pool are never replaced.
+func (p *VipnodePool) setFederatedNode(partner string, node store.Node) error {
+	existing, err := p.Store.GetNode(node.ID)
+	if err == nil && existing.Federation == "" {
+		return ErrNotFederated
+	} else if err != nil && err != store.ErrUnregisteredNode {
+		return err
+	}
+	node.Federation = string(federationAccount(partner))
+	node.Instance = ""
+	if err := p.Store.SetNode(node); err != nil {
+		return err
+	}
+	return p.Store.AddAccountNode(federationAccount(partner), node.ID)
+}
+
+// peerHosts returns hosts for the node like requestHosts, and requests any
+// shortfall from the federation partners.
+func (p *VipnodePool) peerHosts(ctx context.Context, nodeID string, numRequestHosts int, kind string, protocols []ethnode.Capability) ([]store.Node, error) {
+	hosts, err := p.requestHosts(ctx, nodeID, numRequestHosts, kind, protocols)
+	if p.Federation == nil {
+		return hosts, err
+	}
+	switch err.(type) {
+	case nil, NoHostNodesError, RemoteHostErrors:
+	default:
+		return hosts, err
+	}
+	if p.MaxRequestHosts > 0 && numRequestHosts > p.MaxRequestHosts {
+		numRequestHosts = p.MaxRequestHosts
+	}
+	if len(hosts) >= numRequestHosts {
+		return hosts, err
+	}
+
+	self, selfErr := p.Store.GetNode(store.NodeID(nodeID))
+	if selfErr != nil || self.IsHost {
+		// Only clients are peered through partners, since hosts aren't billed
+		return hosts, err
+	}
+	federated := p.federatedHosts(ctx, *self, numRequestHosts-len(hosts), kind, protocols)
+	if len(federated) == 0 {
+		return hosts, err
+	}
+	return append(hosts, federated...), nil
+}
+
+// federatedHosts requests hosts from the partners for a client of this pool,
+// until num hosts are found. Partners that fail are skipped.
+func (p *VipnodePool) federatedHosts(ctx context.Context, self store.Node, num int, kind string, protocols []ethnode.Capability) []store.Node {
+	req := FederationPeerRequest{
+		NodeID:  string(self.ID),
+		Kind:    kind,
+		Network: self.Network,
+	}
+	for _, protocol := range protocols {
+		req.Protocols = append(req.Protocols, protocol.String())
+	}
+
+	var hosts []store.Node
+	for _, partner := range p.Federation.Partners() {
+		if len(hosts) >= num {
+			break
+		}
+		req.Num = num - len(hosts)
+		var resp FederationPeerResponse
+		if err := p.Federation.call(ctx, partner, &resp, "federation_peer", req); err != nil {
+			logger.Printf("Federation partner %s failed to provide hosts for %q: %s", partner, pretty.Abbrev(req.NodeID), err)
+			continue
+		}
+		for _, host := range resp.Peers {
+			if len(hosts) >= num {
+				break
+			}
+			if err := p.setFederatedNode(partner, host); err != nil {
+				logger.Printf("Federation partner %s provided an invalid host %q: %s", partner, pretty.Abbrev(string(host.ID)), err)
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+		logger.Printf("Federation partner %s provided %d hosts for %q", partner, len(resp.Peers), pretty.Abbrev(req.NodeID))
+	}
+	return hosts
+}
+
+// federatedUpdate forwards the client's peers that belong to partner pools to
+// those partners, so that they can account for the usage of their hosts. The
+// partners respond with their current view of the hosts, which keeps them
+// active on this pool.
+func (p *VipnodePool) federatedUpdate(ctx context.Context, nodeID store.NodeID, peerIDs []string, blockNumber uint64) {
+	partnerPeers := map[string][]string{}
+	for _, peerID := range peerIDs {
+		peer, err := p.Store.GetNode(store.NodeID(peerID))
+		if err != nil || peer.Federation == "" {
+			continue
+		}
+		partnerPeers[peer.Federation] = append(partnerPeers[peer.Federation], peerID)
+	}
+
+	for partner, peers := range partnerPeers {
+		req := FederationUpdateRequest{
+			NodeID:      string(nodeID),
+			Peers:       peers,
+			BlockNumber: blockNumber,
+		}
+		var resp FederationUpdateResponse
+		if err := p.Federation.call(ctx, partner, &resp, "federation_update", req); err != nil {
+			logger.Printf("Federation partner %s failed to update %q: %s", partner, pretty.Abbrev(string(nodeID)), err)
+			continue
+		}
+		for _, host := range resp.ActivePeers {
+			if err := p.setFederatedNode(partner, host); err != nil {
+				logger.Printf("Federation partner %s returned an invalid host %q: %s", partner, pretty.Abbrev(string(host.ID)), err)
+			}
+		}
+	}
+}
+
+// FederationUsage returns the usage recorded by this pool and by each of its
+// partners.
+func (p *VipnodePool) FederationUsage(ctx context.Context, balanceStore store.BalanceStore) ([]FederationUsage, error) {
+	if p.Federation == nil {
+		return nil, errors.New("pool federation is not enabled")
+	}
+	partners := p.Federation.Partners()
+	r := make([]FederationUsage, 0, len(partners))
+	for _, partner := range partners {
+		local, err := balanceStore.GetAccountBalance(federationAccount(partner))
+		if err != nil {
+			return nil, err
+		}
+		usage := FederationUsage{
+			Partner: partner,
+			Local:   local,
+		}
+		var remote store.Balance
+		if err := p.Federation.call(ctx, partner, &remote, "federation_usage"); err != nil {
+			usage.Error = err.Error()
+		} else {
+			usage.Remote = &remote
+		}
+		r = append(r, usage)
+	}
+	return r, nil
+}
+
+// FederationService is the RPC service that partner pools use to request
+// hosts for their clients, and to report the usage of those hosts.
+type FederationService struct {
+	Pool *VipnodePool
+}
+
+// verify checks that the request is signed by a partner. Nonces are tracked
+// per node, so that concurrent requests for different nodes don't conflict.
+func (s *FederationService) verify(sig string, method string, partner string, nonce int64, nonceID string, args ...interface{}) error {
+	if s.Pool.Federation == nil {
+		return VerifyFailedError{Cause: ErrNotPartner, Method: method}
+	}
+	if _, ok := s.Pool.Federation.partner(partner); !ok {
+		return VerifyFailedError{Cause: ErrNotPartner, Method: method}
+	}
+	if err := request.Verify(sig, method, partner, nonce, args...); err != nil {
+		return VerifyFailedError{Cause: err, Method: method}
+	}
+	if err := s.Pool.Store.CheckAndSaveNonce(partner+":"+nonceID, nonce); err != nil {
+		return VerifyFailedError{Cause: err, Method: method}
+	}
+	return nil
+}
+
+// Peer whitelists a client of the partner pool on this pool's hosts, and
+// returns the hosts. The client's usage is charged to the partner's account.
+func (s *FederationService) Peer(ctx context.Context, sig string, partner string, nonce int64, req FederationPeerRequest) (*FederationPeerResponse, error) {
+	if err := s.verify(sig, "federation_peer", partner, nonce, req.NodeID, req); err != nil {
+		return nil, err
+	}
+	p := s.Pool
+	if p.InMaintenance() {
+		return nil, MaintenanceError{}
+	}
+	if !p.servesNetwork(req.Network) {
+		return nil, fmt.Errorf("node is on the wrong network, pool requires one of: %s", p.Networks)
+	}
+	protocols, err := ethnode.ParseCapabilities(req.Protocols)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeID := store.NodeID(req.NodeID)
+	node, err := p.Store.GetNode(nodeID)
+	if err == store.ErrUnregisteredNode {
+		node = &store.Node{
+			ID:       nodeID,
+			Kind:     req.Kind,
+			LastSeen: time.Now(),
+			Network:  req.Network,
+			Caps:     req.Protocols,
+		}
+		if err := p.setFederatedNode(partner, *node); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if node.Federation != string(federationAccount(partner)) {
+		return nil, ErrNotFederated
+	}
+	if err := p.BalanceManager.OnClient(*node); err != nil {
+		return nil, err
+	}
+
+	hosts, err := p.requestHosts(ctx, req.NodeID, req.Num, req.Kind, protocols)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Federation partner %s requested hosts for %q: %d accepted", partner, pretty.Abbrev(req.NodeID), len(hosts))
+	return &FederationPeerResponse{Peers: hosts}, nil
+}
+
+// Update records the peers of a client of the partner pool, charging the
+// partner's account for the client's use of this pool's hosts.
+func (s *FederationService) Update(ctx context.Context, sig string, partner string, nonce int64, req FederationUpdateRequest) (*FederationUpdateResponse, error) {
+	if err := s.verify(sig, "federation_update", partner, nonce, req.NodeID, req); err != nil {
+		return nil, err
+	}
+	p := s.Pool
+
+	node, err := p.Store.GetNode(store.NodeID(req.NodeID))
+	if err != nil {
+		return nil, err
+	}
+	if node.Federation != string(federationAccount(partner)) {
+		return nil, ErrNotFederated
+	}
+	if err := p.checkAccess(ctx, node.ID, node.Payout); err != nil {
+		return nil, err
+	}
+	nodeBeforeUpdate := *node
+
+	if _, err := p.Store.UpdateNodePeers(node.ID, req.Peers, req.BlockNumber); err != nil {
+		return nil, err
+	}
+	active, err := p.Store.NodePeers(node.ID)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := p.BalanceManager.OnUpdate(nodeBeforeUpdate, active)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FederationUpdateResponse{
+		ActivePeers: active,
+		Balance:     &balance,
+	}, nil
+}
+
+// Usage returns the partner's account on this pool, see FederationUsage.
+func (s *FederationService) Usage(ctx context.Context, sig string, partner string, nonce int64) (*store.Balance, error) {
+	if err := s.verify(sig, "federation_usage", partner, nonce, ""); err != nil {
+		return nil, err
+	}
+	balance, err := s.Pool.Store.GetAccountBalance(federationAccount(partner))
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/internal/keygen"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+)
+
+func TestFederationService(t *testing.T) {
+	origin, partner := New(memory.New(), nil), New(memory.New(), nil)
+	origin.Federation = NewFederation(keygen.HardcodedKeyIdx(t, 0))
+	partner.Federation = NewFederation(keygen.HardcodedKeyIdx(t, 1))
+
+	service := &jsonrpc2.Local{}
+	if err := service.Server.Register("federation_", &FederationService{Pool: partner}); err != nil {
+		t.Fatal(err)
+	}
+	if err := origin.Federation.AddPartner(partner.Federation.Address, service); err != nil {
+		t.Fatal(err)
+	}
+	if err := origin.Federation.AddPartner("not an address", service); err == nil {
+		t.Error("expected error adding an invalid partner address")
+	}
+
+	req := FederationPeerRequest{NodeID: "client", Num: 1}
+	ctx := context.Background()
+
+	// The partner doesn't know the origin yet
+	if err := origin.Federation.call(ctx, partner.Federation.Address, nil, "federation_peer", req); err == nil {
+		t.Error("expected verify error for unknown partner")
+	} else if verifyErr, ok := err.(VerifyFailedError); !ok || verifyErr.Cause.Error() != ErrNotPartner.Error() {
+		t.Errorf("expected ErrNotPartner, got: %v", err)
+	}
+
+	if err := partner.Federation.AddPartner(origin.Federation.Address, &recordingService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := origin.Federation.call(ctx, partner.Federation.Address, nil, "federation_peer", req); err != (NoHostNodesError{}) {
+		t.Errorf("expected NoHostNodesError, got: %v", err)
+	}
+	client, err := partner.Store.GetNode("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Federation != origin.Federation.Address {
+		t.Errorf("wrong federation of partner client: %q", client.Federation)
+	}
+
+	// Partners can't refer to the pool's own nodes
+	if err := partner.Store.SetNode(store.Node{ID: "local", LastSeen: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	update := FederationUpdateRequest{NodeID: "local"}
+	if err := origin.Federation.call(ctx, partner.Federation.Address, nil, "federation_update", update); err == nil {
+		t.Error("expected error updating a node of the partner pool")
+	}
+	req.NodeID = "local"
+	if err := origin.Federation.call(ctx, partner.Federation.Address, nil, "federation_peer", req); err == nil {
+		t.Error("expected error peering a node of the partner pool")
+	}
+}
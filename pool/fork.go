@@ -0,0 +1,205 @@
+package pool
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/vipnode/vipnode/v2/ethnode"
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// ForkConfirmations is the minimum number of blocks behind its head that a
+// node reports the hash of. Honest hosts often disagree for a moment at the
+// chain tip, such as during short reorgs, so only blocks that are several
+// confirmations deep are compared.
+const ForkConfirmations = 12
+
+// ForkCheckInterval aligns the blocks that nodes report the hash of, so that
+// hosts which update at different times report the same block numbers.
+const ForkCheckInterval = 32
+
+// ForkCheckpoint returns the block number that a node with the given head
+// block should report the hash of, or 0 if the chain is too short.
+func ForkCheckpoint(blockNumber uint64) uint64 {
+	if blockNumber < ForkConfirmations+ForkCheckInterval {
+		return 0
+	}
+	return (blockNumber - ForkConfirmations) / ForkCheckInterval * ForkCheckInterval
+}
+
+// forkWindow is the number of blocks behind the reference block of a network
+// that reports are kept for. Reports of blocks more than ForkCheckInterval
+// ahead of the reference block are rejected, since block numbers are
+// self-reported and a single host could otherwise move the window.
+const forkWindow = 256
+
+// minForkMajority is the number of hosts that must agree on a block hash
+// before hosts that disagree are considered forked, in addition to being a
+// strict majority of the network's active hosts.
+const minForkMajority = 3
+
+// forkStrikes is the number of consecutive checkpoints that a host must
+// disagree with the majority on before it's considered forked.
+const forkStrikes = 3
+
+func newForkDetector() *forkDetector {
+	return &forkDetector{
+		networks: map[ethnode.NetworkID]*networkBlocks{},
+	}
+}
+
+// forkDetector compares the block hashes that hosts report for the same
+// block number, to find hosts on a minority fork or a misconfigured chain.
+// Hosts update at different times, so only recent blocks are kept for each
+// network until other hosts report them. The window of recent blocks follows
+// the reference block of the network's hosts, see referenceBlock.
+type forkDetector struct {
+	mu       sync.Mutex
+	networks map[ethnode.NetworkID]*networkBlocks
+}
+
+type networkBlocks struct {
+	blocks  map[uint64]*blockReports
+	strikes map[store.NodeID]int // Consecutive blocks that hosts disagreed with the majority on
+}
+
+// blockReports are the hashes that hosts reported for a block number.
+type blockReports struct {
+	hashes   map[string]map[store.NodeID]struct{}
+	flagged  map[store.NodeID]struct{} // Hosts that already got a strike for this block
+	majority string                    // Majority hash as of the last report
+}
+
+// findMajority returns the hash that a strict majority of the network's
+// active hosts reported, if at least minForkMajority hosts agree on it.
+func (b *blockReports) findMajority(numHosts int) string {
+	reported := 0
+	for _, hosts := range b.hashes {
+		reported += len(hosts)
+	}
+	if numHosts < reported {
+		numHosts = reported
+	}
+	for hash, hosts := range b.hashes {
+		if len(hosts) >= minForkMajority && len(hosts)*2 > numHosts {
+			return hash
+		}
+	}
+	return ""
+}
+
+// Report records the block hash that the host reported for the block number,
+// where numHosts is the number of active hosts on the network and reference is
+// their reference block. It returns the majority hash for the block, if there
+// is one, and the hosts that disagreed with the majority on forkStrikes
+// consecutive blocks, which weren't returned for this block before. The
+// reporting host can be one of them.
+func (d *forkDetector) Report(nodeID store.NodeID, network ethnode.NetworkID, number uint64, hash string, numHosts int, reference uint64) (majority string, forked []store.NodeID) {
+	hash = strings.ToLower(hash)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n, ok := d.networks[network]
+	if !ok {
+		n = &networkBlocks{
+			blocks:  map[uint64]*blockReports{},
+			strikes: map[store.NodeID]int{},
+		}
+		d.networks[network] = n
+	}
+	if number > reference && number-reference > ForkCheckInterval {
+		// Too far ahead of the other hosts to compare
+		return "", nil
+	}
+	if reference > forkWindow {
+		oldest := reference - forkWindow
+		if number < oldest {
+			// Too old to compare
+			return "", nil
+		}
+		for num := range n.blocks {
+			if num < oldest {
+				delete(n.blocks, num)
+			}
+		}
+	}
+
+	b, ok := n.blocks[number]
+	if !ok {
+		b = &blockReports{
+			hashes:  map[string]map[store.NodeID]struct{}{},
+			flagged: map[store.NodeID]struct{}{},
+		}
+		n.blocks[number] = b
+	}
+	for h, hosts := range b.hashes {
+		// The host could have reorged since its last report
+		delete(hosts, nodeID)
+		if len(hosts) == 0 {
+			delete(b.hashes, h)
+		}
+	}
+	if _, ok := b.hashes[hash]; !ok {
+		b.hashes[hash] = map[store.NodeID]struct{}{}
+	}
+	b.hashes[hash][nodeID] = struct{}{}
+
+	b.majority = b.findMajority(numHosts)
+	if b.majority == "" {
+		return "", nil
+	}
+	for h, hosts := range b.hashes {
+		if h == b.majority {
+			for host := range hosts {
+				delete(n.strikes, host)
+			}
+			continue
+		}
+		for host := range hosts {
+			if _, ok := b.flagged[host]; ok {
+				continue
+			}
+			b.flagged[host] = struct{}{}
+			n.strikes[host] += 1
+			if n.strikes[host] >= forkStrikes {
+				forked = append(forked, host)
+			}
+		}
+	}
+	return b.majority, forked
+}
+
+// Majority returns the hash that the majority of hosts reported for the block
+// number, or empty if it's not known.
+func (d *forkDetector) Majority(network ethnode.NetworkID, number uint64) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n, ok := d.networks[network]
+	if !ok {
+		return ""
+	}
+	b, ok := n.blocks[number]
+	if !ok {
+		return ""
+	}
+	return b.majority
+}
+
+// Forget removes the host's reports and strikes, such as when it leaves the
+// pool.
+func (d *forkDetector) Forget(nodeID store.NodeID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, n := range d.networks {
+		delete(n.strikes, nodeID)
+		for _, b := range n.blocks {
+			for h, hosts := range b.hashes {
+				delete(hosts, nodeID)
+				if len(hosts) == 0 {
+					delete(b.hashes, h)
+				}
+			}
+			delete(b.flagged, nodeID)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package pool
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/ethnode"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+)
+
+func TestForkCheckpoint(t *testing.T) {
+	for _, tc := range []struct {
+		blockNumber uint64
+		want        uint64
+	}{
+		{0, 0},
+		{ForkConfirmations + ForkCheckInterval - 1, 0},
+		{ForkConfirmations + ForkCheckInterval, ForkCheckInterval},
+		{1000, 960},
+		{1000 + ForkCheckInterval - 1, 992},
+	} {
+		if got := ForkCheckpoint(tc.blockNumber); got != tc.want {
+			t.Errorf("wrong checkpoint of block %d: got %d; want %d", tc.blockNumber, got, tc.want)
+		}
+		if got := ForkCheckpoint(tc.blockNumber); got > 0 && got+ForkConfirmations > tc.blockNumber {
+			t.Errorf("checkpoint %d of block %d is not confirmed", got, tc.blockNumber)
+		}
+	}
+}
+
+func TestForkDetector(t *testing.T) {
+	d := newForkDetector()
+	numHosts := 5
+	reference := uint64(100)
+	report := func(nodeID string, number uint64, hash string) (string, []store.NodeID) {
+		return d.Report(store.NodeID(nodeID), ethnode.Mainnet, number, hash, numHosts, reference)
+	}
+
+	// No majority until a strict majority of the active hosts agree
+	report("a", 100, "0xaa")
+	report("b", 100, "0xbb")
+	if majority, forked := report("c", 100, "0xAA"); majority != "" || len(forked) != 0 {
+		t.Errorf("unexpected majority %q or forked hosts without a strict majority: %v", majority, forked)
+	}
+	// Strikes don't fork a host until it disagrees repeatedly
+	if majority, forked := report("d", 100, "0xaa"); majority != "0xaa" || len(forked) != 0 {
+		t.Errorf("wrong majority %q or forked hosts: %v", majority, forked)
+	}
+	if majority := d.Majority(ethnode.Mainnet, 100); majority != "0xaa" {
+		t.Errorf("wrong majority: %q", majority)
+	}
+
+	// Other networks and blocks are separate
+	if majority := d.Majority(ethnode.Goerli, 100); majority != "" {
+		t.Errorf("unexpected goerli majority: %q", majority)
+	}
+	if majority := d.Majority(ethnode.Mainnet, 132); majority != "" {
+		t.Errorf("unexpected majority of unreported block: %q", majority)
+	}
+
+	// Forked after disagreeing on consecutive blocks, and only once per block
+	for i, number := range []uint64{132, 164} {
+		reference = number
+		report("b", number, "0xbb")
+		report("a", number, "0xaa")
+		report("c", number, "0xaa")
+		_, forked := report("d", number, "0xaa")
+		if i == 0 && len(forked) != 0 {
+			t.Errorf("unexpected forked hosts before enough strikes: %v", forked)
+		} else if i == 1 && !reflect.DeepEqual(forked, []store.NodeID{"b"}) {
+			t.Errorf("wrong forked hosts: %v", forked)
+		}
+		if _, forked := report("d", number, "0xaa"); len(forked) != 0 {
+			t.Errorf("forked hosts returned twice for block %d: %v", number, forked)
+		}
+	}
+
+	// Agreeing with the majority resets the strikes
+	for _, number := range []uint64{196, 228} {
+		reference = number
+		report("b", number, "0xaa")
+		report("e", number, "0xee")
+		report("a", number, "0xaa")
+		report("c", number, "0xaa")
+	}
+	for _, number := range []uint64{260, 292} {
+		reference = number
+		report("a", number, "0xaa")
+		report("c", number, "0xaa")
+		report("d", number, "0xaa")
+		if _, forked := report("b", number, "0xbb"); len(forked) != 0 {
+			t.Errorf("unexpected forked hosts after agreeing with the majority: %v", forked)
+		}
+	}
+
+	// Hosts can reorg onto the majority hash
+	reference = 324
+	report("a", 324, "0x11")
+	report("b", 324, "0x22")
+	report("c", 324, "0x22")
+	report("a", 324, "0x22")
+	if majority := d.Majority(ethnode.Mainnet, 324); majority != "0x22" {
+		t.Errorf("wrong majority after reorg: %q", majority)
+	}
+
+	// Blocks far ahead of the reference block are rejected, without forgetting
+	// older blocks
+	for _, number := range []uint64{reference + ForkCheckInterval + 1, math.MaxUint64} {
+		for _, host := range []string{"a", "b", "c"} {
+			report(host, number, "0x44")
+		}
+		if majority := d.Majority(ethnode.Mainnet, number); majority != "" {
+			t.Errorf("unexpected majority of block %d: %q", number, majority)
+		}
+	}
+	if majority := d.Majority(ethnode.Mainnet, 100); majority != "0xaa" {
+		t.Errorf("wrong majority of old block: %q", majority)
+	}
+
+	// Old blocks are forgotten
+	reference = 100 + forkWindow + 1
+	report("a", reference, "0x33")
+	if majority := d.Majority(ethnode.Mainnet, 100); majority != "" {
+		t.Errorf("old block was not forgotten: %q", majority)
+	}
+	if majority, forked := report("b", 100, "0xbb"); majority != "" || len(forked) != 0 {
+		t.Errorf("unexpected majority %q or forked hosts for old block: %v", majority, forked)
+	}
+
+	// Hosts that leave lose their strikes
+	reference = 388
+	for _, number := range []uint64{356, 388} {
+		report("a", number, "0xaa")
+		report("c", number, "0xaa")
+		report("d", number, "0xaa")
+		report("b", number, "0xbb")
+	}
+	if strikes := d.networks[ethnode.Mainnet].strikes["b"]; strikes != 2 {
+		t.Errorf("wrong strikes before forgetting host: %d", strikes)
+	}
+	d.Forget("b")
+	if strikes := d.networks[ethnode.Mainnet].strikes["b"]; strikes != 0 {
+		t.Errorf("forgotten host has strikes: %d", strikes)
+	}
+}
+
+func TestPoolForks(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.Events = NewEvents()
+	recorder := &EventRecorder{events: make(chan Event, 10)}
+	local := &jsonrpc2.Local{}
+	if err := local.Server.Register("pool_", recorder); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Events.Subscribe(local, []string{string(EventHostForked)}); err != nil {
+		t.Fatal(err)
+	}
+
+	head := uint64(ForkCheckInterval*(forkStrikes+2) + ForkConfirmations)
+	nodes := []store.Node{
+		{ID: "host1", IsHost: true, Network: ethnode.Mainnet, LastSeen: time.Now(), BlockNumber: head},
+		{ID: "host2", IsHost: true, Network: ethnode.Mainnet, LastSeen: time.Now(), BlockNumber: head},
+		{ID: "host3", IsHost: true, Network: ethnode.Mainnet, LastSeen: time.Now(), BlockNumber: head},
+		{ID: "forked", IsHost: true, Network: ethnode.Mainnet, LastSeen: time.Now(), BlockNumber: head},
+		{ID: "client", Network: ethnode.Mainnet, LastSeen: time.Now()},
+	}
+	for _, node := range nodes {
+		if err := pool.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client, forked, hosts := nodes[4], nodes[3], nodes[:3]
+
+	quarantined := func() map[store.NodeID]bool {
+		r := map[store.NodeID]bool{}
+		for _, node := range nodes {
+			_, q, err := pool.Reputation.Get(node.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r[node.ID] = q
+		}
+		return r
+	}
+
+	for i := uint64(0); i < forkStrikes+2; i++ {
+		number := ForkCheckInterval * (i + 1)
+		// Clients don't count towards the majority
+		if majority := pool.checkFork(client, number, "0xbad"); majority != "" {
+			t.Errorf("unexpected majority: %q", majority)
+		}
+		pool.checkFork(forked, number, "0xbad")
+		for _, host := range hosts {
+			pool.checkFork(host, number, "0x100")
+		}
+		if majority := pool.checkFork(client, number, "0xbad"); majority != "0x100" {
+			t.Errorf("wrong majority for client: %q", majority)
+		}
+		if i == 0 {
+			for nodeID, q := range quarantined() {
+				if q {
+					t.Errorf("%s was quarantined after a single disagreement", nodeID)
+				}
+			}
+		}
+	}
+
+	for nodeID, q := range quarantined() {
+		if want := nodeID == forked.ID; q != want {
+			t.Errorf("wrong quarantine of %s: got %t; want %t", nodeID, q, want)
+		}
+	}
+
+	select {
+	case event := <-recorder.events:
+		if event.Topic != EventHostForked || event.NodeID != "forked" {
+			t.Errorf("wrong event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for host_forked event")
+	}
+}
+
+func TestPoolGenesis(t *testing.T) {
+	pool := New(memory.New(), nil)
+	ctx := context.Background()
+
+	req := ConnectRequest{
+		NodeInfo:    ethnode.UserAgent{Kind: ethnode.Geth, Network: ethnode.Mainnet},
+		GenesisHash: ethnode.Goerli.GenesisHash(),
+	}
+	if _, err := pool.connect(ctx, "wrong-genesis", req); err == nil {
+		t.Error("expected wrong genesis error")
+	}
+
+	for _, genesis := range []string{"", ethnode.Mainnet.GenesisHash()} {
+		req.GenesisHash = genesis
+		if _, err := pool.connect(ctx, "client", req); err != nil {
+			t.Errorf("unexpected error for genesis %q: %s", genesis, err)
+		}
+	}
+
+	// Genesis of unknown networks is not checked
+	req.NodeInfo.Network = 1337
+	req.GenesisHash = "0x1337"
+	if _, err := pool.connect(ctx, "devnet", req); err != nil {
+		t.Errorf("unexpected error for unknown network: %s", err)
+	}
+}
@@ -0,0 +1,366 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/ethnode"
+	"github.com/vipnode/vipnode/v2/internal/metrics"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// NewMetrics returns Metrics with all of the pool's metrics registered.
+func NewMetrics() *Metrics {
+	r := metrics.NewRegistry()
+	m := &Metrics{
+		Registry: r,
+
+		RPCCalls:             r.Counter("vipnode_rpc_calls_total", "RPC calls handled by the pool, by method and error code (0 for success).", "method", "code"),
+		RPCDuration:          r.Histogram("vipnode_rpc_duration_seconds", "Duration of RPC calls handled by the pool.", metrics.DefaultBuckets, "method"),
+		WhitelistCalls:       r.Counter("vipnode_whitelist_calls_total", "Whitelist calls to hosts, by result: accepted, timeout, or failed.", "result"),
+		WhitelistDuration:    r.Histogram("vipnode_whitelist_duration_seconds", "Duration of whitelist calls to hosts.", metrics.DefaultBuckets, "result"),
+		WhitelistRequests:    r.Counter("vipnode_whitelist_requests_total", "Requests for hosts that were fanned out to whitelist calls, by whether any host accepted.", "result"),
+		ActiveNodes:          r.Gauge("vipnode_active_nodes", "Nodes active within the expire interval, by type, kind, and network.", "type", "kind", "network"),
+		WebsocketConnections: r.Gauge("vipnode_websocket_connections", "Open websocket connections."),
+		WebsocketConnects:    r.Counter("vipnode_websocket_connects_total", "Websocket connections accepted."),
+		StoreDuration:        r.Histogram("vipnode_store_duration_seconds", "Duration of store operations.", metrics.DefaultBuckets, "op"),
+		StoreErrors:          r.Counter("vipnode_store_errors_total", "Store operations which returned an error.", "op"),
+		BalanceCredited:      r.Counter("vipnode_balance_credited_wei_total", "Credit added to node and account balances, in wei."),
+		BalanceDebited:       r.Counter("vipnode_balance_debited_wei_total", "Credit removed from node and account balances, in wei."),
+
+		nodes: map[store.NodeID]activeNode{},
+	}
+	r.OnCollect(m.collectNodes)
+	return m
+}
+
+// Metrics records pool activity for the Prometheus /metrics endpoint. Metrics
+// are updated as things happen, so that scrapes don't query the store.
+type Metrics struct {
+	Registry *metrics.Registry
+
+	RPCCalls             *metrics.Counter   // method, code
+	RPCDuration          *metrics.Histogram // method
+	WhitelistCalls       *metrics.Counter   // result
+	WhitelistDuration    *metrics.Histogram // result
+	WhitelistRequests    *metrics.Counter   // result
+	ActiveNodes          *metrics.Gauge     // type, kind, network
+	WebsocketConnections *metrics.Gauge
+	WebsocketConnects    *metrics.Counter
+	StoreDuration        *metrics.Histogram // op
+	StoreErrors          *metrics.Counter   // op
+	BalanceCredited      *metrics.Counter
+	BalanceDebited       *metrics.Counter
+
+	mu    sync.Mutex
+	nodes map[store.NodeID]activeNode // Nodes counted by ActiveNodes
+}
+
+type activeNode struct {
+	labels   [3]string // type, kind, network
+	lastSeen time.Time
+}
+
+// Interceptor is a jsonrpc2.Interceptor which records the RPC calls handled by
+// the server that it's used with.
+func (m *Metrics) Interceptor(next jsonrpc2.HandlerFunc) jsonrpc2.HandlerFunc {
+	return func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		start := time.Now()
+		result, err := next(ctx, method, params)
+		code := jsonrpc2.ResponseCode(err)
+		if code == jsonrpc2.ErrCodeMethodNotFound {
+			// Don't let callers add arbitrary label values
+			method = "unknown"
+		}
+		m.RPCCalls.Inc(method, strconv.Itoa(code))
+		m.RPCDuration.Since(start, method)
+		return result, err
+	}
+}
+
+// nodeSeen counts the node as active.
+func (m *Metrics) nodeSeen(node store.Node) {
+	if m == nil {
+		return
+	}
+	nodeType := "client"
+	if node.IsHost {
+		nodeType = "host"
+	}
+	kind := node.Kind
+	if kind == "" {
+		kind = "unknown"
+	}
+	m.mu.Lock()
+	m.nodes[node.ID] = activeNode{
+		labels:   [3]string{nodeType, kind, networkLabel(node.Network)},
+		lastSeen: time.Now(),
+	}
+	m.mu.Unlock()
+}
+
+// networkLabel returns the name of known networks, or the numeric ID of
+// custom networks so that they're counted separately.
+func networkLabel(network ethnode.NetworkID) string {
+	if name := network.String(); name != ethnode.UnknownNetwork.String() {
+		return name
+	}
+	return strconv.Itoa(int(network))
+}
+
+// nodeGone stops counting the node as active, such as when its connection
+// closes.
+func (m *Metrics) nodeGone(nodeID store.NodeID) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.nodes, nodeID)
+	m.mu.Unlock()
+}
+
+// collectNodes expires nodes that were not seen within the expire interval
+// and sets ActiveNodes from the rest.
+func (m *Metrics) collectNodes() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expired := time.Now().Add(-store.ExpireInterval)
+	counts := map[[3]string]int{}
+	for nodeID, node := range m.nodes {
+		if node.lastSeen.Before(expired) {
+			delete(m.nodes, nodeID)
+			continue
+		}
+		counts[node.labels]++
+	}
+	m.ActiveNodes.Reset()
+	for labels, count := range counts {
+		m.ActiveNodes.Set(float64(count), labels[:]...)
+	}
+}
+
+// whitelisted records a whitelist call to a host that started at start.
+func (m *Metrics) whitelisted(start time.Time, err error, timeout bool) {
+	if m == nil {
+		return
+	}
+	result := "accepted"
+	if timeout {
+		result = "timeout"
+	} else if err != nil {
+		result = "failed"
+	}
+	m.WhitelistCalls.Inc(result)
+	m.WhitelistDuration.Since(start, result)
+}
+
+// requestedHosts records whether any host accepted a fanned out request for
+// hosts.
+func (m *Metrics) requestedHosts(numAccepted int) {
+	if m == nil {
+		return
+	}
+	if numAccepted > 0 {
+		m.WhitelistRequests.Inc("accepted")
+	} else {
+		m.WhitelistRequests.Inc("none")
+	}
+}
+
+// Store returns a store.Store which records the latency of operations on s,
+// and the balance changes made through it.
+func (m *Metrics) Store(s store.Store) store.Store {
+	return &metricsStore{Store: s, metrics: m}
+}
+
+type metricsStore struct {
+	store.Store
+	metrics *Metrics
+}
+
+func (s *metricsStore) observe(op string, start time.Time, err error) {
+	s.metrics.StoreDuration.Since(start, op)
+	if err != nil {
+		s.metrics.StoreErrors.Inc(op)
+	}
+}
+
+func (s *metricsStore) addBalance(credit *big.Int) {
+	amount, _ := new(big.Float).SetInt(credit).Float64()
+	if amount >= 0 {
+		s.metrics.BalanceCredited.Add(amount)
+	} else {
+		s.metrics.BalanceDebited.Add(-amount)
+	}
+}
+
+// AllNodes lists the nodes of the wrapped store, so that the admin API can
+// list nodes through the wrapper.
+func (s *metricsStore) AllNodes() ([]store.Node, error) {
+	lister, ok := s.Store.(nodeLister)
+	if !ok {
+		return nil, errNodeListUnsupported
+	}
+	start := time.Now()
+	r, err := lister.AllNodes()
+	s.observe("all_nodes", start, err)
+	return r, err
+}
+
+func (s *metricsStore) CheckAndSaveNonce(ID string, nonce int64) error {
+	start := time.Now()
+	err := s.Store.CheckAndSaveNonce(ID, nonce)
+	s.observe("check_and_save_nonce", start, err)
+	return err
+}
+
+func (s *metricsStore) GetNode(nodeID store.NodeID) (*store.Node, error) {
+	start := time.Now()
+	r, err := s.Store.GetNode(nodeID)
+	s.observe("get_node", start, err)
+	return r, err
+}
+
+func (s *metricsStore) SetNode(node store.Node) error {
+	start := time.Now()
+	err := s.Store.SetNode(node)
+	s.observe("set_node", start, err)
+	return err
+}
+
+func (s *metricsStore) ActiveHosts(kind string, limit int) ([]store.Node, error) {
+	start := time.Now()
+	r, err := s.Store.ActiveHosts(kind, limit)
+	s.observe("active_hosts", start, err)
+	return r, err
+}
+
+func (s *metricsStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
+	start := time.Now()
+	r, err := s.Store.NodePeers(nodeID)
+	s.observe("node_peers", start, err)
+	return r, err
+}
+
+func (s *metricsStore) UpdateNodePeers(nodeID store.NodeID, peers []string, blockNumber uint64) ([]store.NodeID, error) {
+	start := time.Now()
+	r, err := s.Store.UpdateNodePeers(nodeID, peers, blockNumber)
+	s.observe("update_node_peers", start, err)
+	return r, err
+}
+
+func (s *metricsStore) SetNodeSyncing(nodeID store.NodeID, syncTarget uint64) error {
+	start := time.Now()
+	err := s.Store.SetNodeSyncing(nodeID, syncTarget)
+	s.observe("set_node_syncing", start, err)
+	return err
+}
+
+func (s *metricsStore) SetNodeCapacity(nodeID store.NodeID, maxClients int) error {
+	start := time.Now()
+	err := s.Store.SetNodeCapacity(nodeID, maxClients)
+	s.observe("set_node_capacity", start, err)
+	return err
+}
+
+func (s *metricsStore) GetHostReputation(nodeID store.NodeID) (store.HostReputation, error) {
+	start := time.Now()
+	r, err := s.Store.GetHostReputation(nodeID)
+	s.observe("get_host_reputation", start, err)
+	return r, err
+}
+
+func (s *metricsStore) UpdateHostReputation(nodeID store.NodeID, fn func(*store.HostReputation) error) error {
+	start := time.Now()
+	err := s.Store.UpdateHostReputation(nodeID, fn)
+	s.observe("update_host_reputation", start, err)
+	return err
+}
+
+func (s *metricsStore) AccessEntries(list store.AccessList) ([]store.AccessEntry, error) {
+	start := time.Now()
+	r, err := s.Store.AccessEntries(list)
+	s.observe("access_entries", start, err)
+	return r, err
+}
+
+func (s *metricsStore) AddAccessEntry(list store.AccessList, entry store.AccessEntry) error {
+	start := time.Now()
+	err := s.Store.AddAccessEntry(list, entry)
+	s.observe("add_access_entry", start, err)
+	return err
+}
+
+func (s *metricsStore) RemoveAccessEntry(list store.AccessList, target string) error {
+	start := time.Now()
+	err := s.Store.RemoveAccessEntry(list, target)
+	s.observe("remove_access_entry", start, err)
+	return err
+}
+
+func (s *metricsStore) AddAccountNode(account store.Account, nodeID store.NodeID) error {
+	start := time.Now()
+	err := s.Store.AddAccountNode(account, nodeID)
+	s.observe("add_account_node", start, err)
+	return err
+}
+
+func (s *metricsStore) IsAccountNode(account store.Account, nodeID store.NodeID) error {
+	start := time.Now()
+	err := s.Store.IsAccountNode(account, nodeID)
+	s.observe("is_account_node", start, err)
+	return err
+}
+
+func (s *metricsStore) GetAccountNodes(account store.Account) ([]store.NodeID, error) {
+	start := time.Now()
+	r, err := s.Store.GetAccountNodes(account)
+	s.observe("get_account_nodes", start, err)
+	return r, err
+}
+
+func (s *metricsStore) Stats() (*store.Stats, error) {
+	start := time.Now()
+	r, err := s.Store.Stats()
+	s.observe("stats", start, err)
+	return r, err
+}
+
+func (s *metricsStore) GetNodeBalance(nodeID store.NodeID) (store.Balance, error) {
+	start := time.Now()
+	r, err := s.Store.GetNodeBalance(nodeID)
+	s.observe("get_node_balance", start, err)
+	return r, err
+}
+
+func (s *metricsStore) AddNodeBalance(nodeID store.NodeID, credit *big.Int) error {
+	start := time.Now()
+	err := s.Store.AddNodeBalance(nodeID, credit)
+	s.observe("add_node_balance", start, err)
+	if err == nil {
+		s.addBalance(credit)
+	}
+	return err
+}
+
+func (s *metricsStore) GetAccountBalance(account store.Account) (store.Balance, error) {
+	start := time.Now()
+	r, err := s.Store.GetAccountBalance(account)
+	s.observe("get_account_balance", start, err)
+	return r, err
+}
+
+func (s *metricsStore) AddAccountBalance(account store.Account, credit *big.Int) error {
+	start := time.Now()
+	err := s.Store.AddAccountBalance(account, credit)
+	s.observe("add_account_balance", start, err)
+	if err == nil {
+		s.addBalance(credit)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/ethnode"
+	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	p := New(m.Store(memory.New()), nil)
+	p.Metrics = m
+
+	host := store.Node{ID: "host", URI: "enode://host@127.0.0.1:30303", IsHost: true, Kind: "geth", Network: ethnode.Mainnet, LastSeen: time.Now()}
+	client := store.Node{ID: "client", Kind: "geth", Network: ethnode.Mainnet, LastSeen: time.Now()}
+	for _, node := range []store.Node{host, client} {
+		if err := p.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+		m.nodeSeen(node)
+	}
+	p.remoteHosts[host.ID] = acceptingService{}
+	p.remoteNodeLookup[acceptingService{}] = host.ID
+
+	if _, err := p.requestHosts(context.Background(), "client", 1, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.WhitelistCalls.Value("accepted"); got != 1 {
+		t.Errorf("wrong number of accepted whitelist calls: %v", got)
+	}
+	if got := m.WhitelistRequests.Value("accepted"); got != 1 {
+		t.Errorf("wrong number of accepted requests: %v", got)
+	}
+	if got := m.StoreDuration.Count("active_hosts"); got != 1 {
+		t.Errorf("wrong number of active_hosts store calls: %d", got)
+	}
+
+	if err := p.Store.AddNodeBalance(host.ID, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Store.AddNodeBalance(client.ID, big.NewInt(-40)); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.BalanceCredited.Value(); got != 100 {
+		t.Errorf("wrong credited balance: %v", got)
+	}
+	if got := m.BalanceDebited.Value(); got != 40 {
+		t.Errorf("wrong debited balance: %v", got)
+	}
+
+	// Hosts stop being counted when their connection closes
+	if err := p.CloseRemote(acceptingService{}); err != nil {
+		t.Fatal(err)
+	}
+	// Custom networks are labelled by their numeric ID
+	m.nodeSeen(store.Node{ID: "devnet", Kind: "geth", Network: 1337})
+
+	var buf bytes.Buffer
+	if _, err := m.Registry.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if want := `vipnode_active_nodes{type="client",kind="geth",network="mainnet"} 1`; !strings.Contains(out, want) {
+		t.Errorf("missing %q in metrics:\n%s", want, out)
+	}
+	if want := `vipnode_active_nodes{type="client",kind="geth",network="1337"} 1`; !strings.Contains(out, want) {
+		t.Errorf("missing %q in metrics:\n%s", want, out)
+	}
+	if strings.Contains(out, `type="host"`) {
+		t.Errorf("disconnected host is still active:\n%s", out)
+	}
+
+	// RPC calls are recorded by method and error code
+	server := &jsonrpc2.Local{}
+	server.Server.Use(m.Interceptor)
+	if err := server.Server.Register("vipnode_", p, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	var pong string
+	if err := server.Call(context.Background(), &pong, "vipnode_ping"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Call(context.Background(), nil, "vipnode_random"); err == nil {
+		t.Error("expected error calling an unknown method")
+	}
+	if got := m.RPCCalls.Value("vipnode_ping", "0"); got != 1 {
+		t.Errorf("wrong number of vipnode_ping calls: %v", got)
+	}
+	if got := m.RPCCalls.Value("unknown", "-32601"); got != 1 {
+		t.Errorf("wrong number of unknown method calls: %v", got)
+	}
+}
+
+func TestMetricsStoreInterfaces(t *testing.T) {
+	// Optional interfaces that the pool type-asserts on its store, which the
+	// metrics wrapper must not hide.
+	optional := map[string]func(store.Store) bool{
+		"nodeLister": func(s store.Store) bool { _, ok := s.(nodeLister); return ok },
+	}
+
+	s := memory.New()
+	wrapped := NewMetrics().Store(s)
+	for name, implements := range optional {
+		if implements(s) && !implements(wrapped) {
+			t.Errorf("metrics store hides the %s interface of the wrapped store", name)
+		}
+	}
+}
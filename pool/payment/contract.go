@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -77,6 +78,17 @@ type contractPayment struct {
 	backend      bind.ContractBackend
 	balanceCache balanceCache
 	transactOpts *bind.TransactOpts
+
+	mu                sync.Mutex
+	onSubscribeFailed func(err error)
+}
+
+// OnSubscribeFailed sets a callback for when the balance subscription gives
+// up and deposits fall back to the expiration cache.
+func (p *contractPayment) OnSubscribeFailed(fn func(err error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onSubscribeFailed = fn
 }
 
 // GetNodeBalance proxies the normal store implementation
@@ -155,8 +167,9 @@ func (p *contractPayment) SubscribeBalance(ctx context.Context, handler func(acc
 		// way to bubble up errors. Need to refactor someday.
 		retryTimeout := time.Minute * 10 // Abort if we fail more often than once in 10min
 		var lastErr time.Time
+		var err error
 		for {
-			err := eventHandler()
+			err = eventHandler()
 			if err == nil {
 				// Clean exit
 				return
@@ -165,9 +178,17 @@ func (p *contractPayment) SubscribeBalance(ctx context.Context, handler func(acc
 			if lastErr.Add(retryTimeout).After(time.Now()) {
 				break
 			}
+			lastErr = time.Now()
 		}
 		logger.Printf("SubscribeBalance event loop aborted, falling back to expiration cache.")
 		p.balanceCache.Reset(time.Minute * 10)
+
+		p.mu.Lock()
+		onSubscribeFailed := p.onSubscribeFailed
+		p.mu.Unlock()
+		if onSubscribeFailed != nil {
+			onSubscribeFailed(err)
+		}
 	}()
 	return nil
 }
@@ -45,6 +45,8 @@ type PaymentService struct {
 	// the current "on-chain" balance with newBalance. It returns a transaction
 	// ID. If nil, then Withdraw calls will error with ErrWithdrawDisabled.
 	Settle SettleHandler
+	// Events receives withdraw_settled and settle_failed events. (Optional)
+	Events *pool.Events
 	// WithdrawFee (optional) takes the withdraw total and returns the new total to withdraw (with any fees applied).
 	WithdrawFee func(*big.Int) *big.Int
 	// WithdrawMin (optional) is the minimum amount required to allow a withdraw.
@@ -130,8 +132,25 @@ func (p *PaymentService) Withdraw(ctx context.Context, sig string, wallet string
 	newBalance := big.NewInt(0)
 	txID, err := p.Settle(account, total, newBalance)
 	if err != nil {
+		if p.Events != nil {
+			p.Events.Publish(pool.Event{
+				Topic:   pool.EventSettleFailed,
+				Account: account,
+				Message: err.Error(),
+			})
+		}
 		return err
 	}
 	logger.Printf("Withdraw from account %q for %d: %s", account, total, txID)
+	if p.Events != nil {
+		settled := store.Balance{Account: account}
+		settled.Credit.Set(newBalance)
+		p.Events.Publish(pool.Event{
+			Topic:   pool.EventWithdrawSettled,
+			Account: account,
+			Balance: &settled,
+			Message: txID,
+		})
+	}
 	return nil
 }
@@ -24,6 +24,20 @@ type ConnectRequest struct {
 
 	// Payout sets the wallet account to register the host credit towards. (Optional)
 	Payout string `json:"payout"`
+
+	// Caps are the sub-protocols that the node supports, such as "eth/63" or
+	// "les/2". If empty, the node's protocols are unknown and hosts are
+	// matched by kind instead. (Optional)
+	Caps []string `json:"caps,omitempty"`
+
+	// MaxClients is the number of clients a host is willing to serve, or 0
+	// for no limit. (Optional)
+	MaxClients int `json:"max_clients,omitempty"`
+
+	// GenesisHash is the hash of the node's genesis block, which must match
+	// the genesis block of the node's network if the pool knows it.
+	// (Optional)
+	GenesisHash string `json:"genesis_hash,omitempty"`
 }
 
 // ConnectResponse is the response a vipnode agent receives from the pool after
@@ -96,6 +110,37 @@ type UpdateRequest struct {
 	Peers       []string           `json:"peers,omitempty"` // DEPRECATED
 	PeerInfo    []ethnode.PeerInfo `json:"peers_info"`
 	BlockNumber uint64             `json:"block_number"`
+	// BlockHash is the hash of the node's block at BlockHashNumber, which is
+	// compared with the hashes that other hosts report for the same block to
+	// detect hosts on a fork. (Optional)
+	BlockHash string `json:"block_hash,omitempty"`
+	// BlockHashNumber is the block that BlockHash is for, which must be at
+	// least ForkConfirmations behind BlockNumber. See ForkCheckpoint.
+	BlockHashNumber uint64 `json:"block_hash_number,omitempty"`
+	// FailedPeers are node IDs of hosts from a previous peer request that
+	// the node failed to connect to. (Optional)
+	FailedPeers []string `json:"failed_peers,omitempty"`
+	// MaxClients is the number of clients a host is currently willing to
+	// serve, or 0 for no limit. It replaces the value from the connect
+	// request. (Optional)
+	MaxClients int `json:"max_clients,omitempty"`
+	// Syncing is the progress of the node importing the chain, if it's still
+	// syncing. Hosts are not offered to nodes while they're syncing.
+	// (Optional)
+	Syncing *ethnode.SyncProgress `json:"syncing,omitempty"`
+}
+
+// syncTarget returns the block that the node is syncing up to, or 0 if it's
+// not syncing. Nodes that don't know the highest block yet are syncing to the
+// block after their current one.
+func (req UpdateRequest) syncTarget() uint64 {
+	if req.Syncing == nil {
+		return 0
+	}
+	if req.Syncing.HighestBlock > req.BlockNumber {
+		return req.Syncing.HighestBlock
+	}
+	return req.BlockNumber + 1
 }
 
 // UpdateResponse is the response type for Update RPC calls.
@@ -115,6 +160,10 @@ type UpdateResponse struct {
 	ActivePeers []string `json:"active_peers"`
 	// LatestBlockNumber is the highest block number that the pool knows about.
 	LatestBlockNumber uint64 `json:"latest_block_number"`
+	// BlockHash is the hash that the majority of hosts reported for the
+	// request's BlockHashNumber, if the pool knows it. If it's different from
+	// the node's BlockHash, then the node is on a fork.
+	BlockHash string `json:"block_hash,omitempty"`
 }
 
 // PeerRequest is the request type for Peer RPC calls.
@@ -123,6 +172,10 @@ type PeerRequest struct {
 	Num int `json:"num"`
 	// Kind is the type of node we desire, such as "parity" or "geth" (optional)
 	Kind string `json:"kind,omitempty"`
+	// Protocols are the sub-protocols that peers must support, optionally
+	// with a minimum version, such as "les/2". If set, then Kind is only
+	// used for peers whose protocols are unknown. (Optional)
+	Protocols []string `json:"protocols,omitempty"`
 }
 
 // PeerResponse is the response type for Peer RPC calls.
@@ -132,6 +185,15 @@ type PeerResponse struct {
 	Peers []store.Node `json:"peers"`
 }
 
+// ShutdownNotice is sent by the pool to connected agents with a
+// vipnode_shutdown notification before it shuts down.
+type ShutdownNotice struct {
+	// ReconnectDelay is how long the agent should wait before reconnecting,
+	// in milliseconds. The pool spreads the delays of its agents, so that
+	// they don't all reconnect at the same time.
+	ReconnectDelay int64 `json:"reconnect_delay"`
+}
+
 // Pool represents a vipnode pool for coordinating between clients and hosts.
 type Pool interface {
 	// Host subscribes a host to receive vipnode_whitelist instructions.
@@ -34,6 +34,12 @@ func (p *RemotePool) getNonce() int64 {
 	return time.Now().UnixNano()
 }
 
+// call proxies the RPC call and converts known pool error responses back
+// into their typed errors.
+func (p *RemotePool) call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	return remoteError(p.client.Call(ctx, result, method, params...))
+}
+
 // DEPRECATED
 func (p *RemotePool) Host(ctx context.Context, req HostRequest) (*HostResponse, error) {
 	signedReq := request.NodeRequest{
@@ -48,7 +54,7 @@ func (p *RemotePool) Host(ctx context.Context, req HostRequest) (*HostResponse,
 		return nil, err
 	}
 	var resp HostResponse
-	if err := p.client.Call(ctx, &resp, signedReq.Method, args...); err != nil {
+	if err := p.call(ctx, &resp, signedReq.Method, args...); err != nil {
 		return nil, err
 	}
 	return &resp, nil
@@ -68,7 +74,7 @@ func (p *RemotePool) Client(ctx context.Context, req ClientRequest) (*ClientResp
 		return nil, err
 	}
 	var resp ClientResponse
-	if err := p.client.Call(ctx, &resp, signedReq.Method, args...); err != nil {
+	if err := p.call(ctx, &resp, signedReq.Method, args...); err != nil {
 		return nil, err
 	}
 
@@ -88,7 +94,7 @@ func (p *RemotePool) Connect(ctx context.Context, req ConnectRequest) (*ConnectR
 		return nil, err
 	}
 	var resp ConnectResponse
-	if err := p.client.Call(ctx, &resp, signedReq.Method, args...); err != nil {
+	if err := p.call(ctx, &resp, signedReq.Method, args...); err != nil {
 		return nil, err
 	}
 
@@ -108,7 +114,7 @@ func (p *RemotePool) Peer(ctx context.Context, req PeerRequest) (*PeerResponse,
 		return nil, err
 	}
 	var resp PeerResponse
-	if err := p.client.Call(ctx, &resp, signedReq.Method, args...); err != nil {
+	if err := p.call(ctx, &resp, signedReq.Method, args...); err != nil {
 		return nil, err
 	}
 
@@ -127,7 +133,7 @@ func (p *RemotePool) Disconnect(ctx context.Context) error {
 		return err
 	}
 	var result interface{}
-	return p.client.Call(ctx, &result, signedReq.Method, args...)
+	return p.call(ctx, &result, signedReq.Method, args...)
 }
 
 func (p *RemotePool) Update(ctx context.Context, req UpdateRequest) (*UpdateResponse, error) {
@@ -144,7 +150,7 @@ func (p *RemotePool) Update(ctx context.Context, req UpdateRequest) (*UpdateResp
 	}
 
 	var result UpdateResponse
-	if err := p.client.Call(ctx, &result, signedReq.Method, args...); err != nil {
+	if err := p.call(ctx, &result, signedReq.Method, args...); err != nil {
 		return nil, err
 	}
 
@@ -163,5 +169,5 @@ func (p *RemotePool) Withdraw(ctx context.Context) error {
 		return err
 	}
 	var result interface{}
-	return p.client.Call(ctx, &result, signedReq.Method, args...)
+	return p.call(ctx, &result, signedReq.Method, args...)
 }
@@ -112,3 +112,27 @@ func TestRemotePoolHost(t *testing.T) {
 		}
 	}
 }
+
+func TestRemotePoolErrors(t *testing.T) {
+	pool := New(memory.New(), nil)
+
+	server, client := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+
+	privkey := keygen.HardcodedKey(t)
+	remote := Remote(client, privkey)
+
+	_, err := remote.Client(context.Background(), ClientRequest{Kind: "geth"})
+	if _, ok := err.(NoHostNodesError); !ok {
+		t.Errorf("expected NoHostNodesError, got %T: %s", err, err)
+	}
+
+	// Sign with a mismatched node ID
+	remote.nodeID = discv5.PubkeyID(&keygen.HardcodedKeyIdx(t, 1).PublicKey).String()
+	_, err = remote.Connect(context.Background(), ConnectRequest{})
+	if verifyErr, ok := err.(VerifyFailedError); !ok {
+		t.Errorf("expected VerifyFailedError, got %T: %s", err, err)
+	} else if verifyErr.Method != "vipnode_connect" {
+		t.Errorf("unexpected method: %q", verifyErr.Method)
+	}
+}
@@ -0,0 +1,144 @@
+package pool
+
+import (
+	"math"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// Penalty is a kind of failure that is attributed to a host.
+type Penalty int
+
+const (
+	// PenaltyWhitelistFailure is when a host returns an error for a
+	// vipnode_whitelist request.
+	PenaltyWhitelistFailure Penalty = iota
+	// PenaltyWhitelistTimeout is when a host does not respond to a
+	// vipnode_whitelist request within the deadline.
+	PenaltyWhitelistTimeout
+	// PenaltyConnectFailure is when a client reports that it failed to
+	// connect to a host that it was given by the pool.
+	PenaltyConnectFailure
+	// PenaltyDisconnect is when a host drops its connection to the pool.
+	PenaltyDisconnect
+	// PenaltyFork is when a host keeps reporting different block hashes than
+	// the majority of hosts for the same block numbers.
+	PenaltyFork
+)
+
+func (p Penalty) String() string {
+	switch p {
+	case PenaltyWhitelistFailure:
+		return "whitelist failure"
+	case PenaltyWhitelistTimeout:
+		return "whitelist timeout"
+	case PenaltyConnectFailure:
+		return "connect failure"
+	case PenaltyDisconnect:
+		return "disconnect"
+	case PenaltyFork:
+		return "fork"
+	}
+	return "unknown"
+}
+
+// DefaultPenaltyWeights is the default amount each kind of failure adds to a
+// host's penalty. Client reports are weighted lower because they can't be
+// verified by the pool. Forks are only penalized after a host disagrees with
+// the majority repeatedly, and reach the default quarantine threshold if it
+// keeps disagreeing.
+var DefaultPenaltyWeights = map[Penalty]float64{
+	PenaltyWhitelistFailure: 1,
+	PenaltyWhitelistTimeout: 2,
+	PenaltyConnectFailure:   0.5,
+	PenaltyDisconnect:       0.5,
+	PenaltyFork:             5,
+}
+
+// NewReputation returns a Reputation tracker with default settings.
+func NewReputation(reputationStore store.ReputationStore) *Reputation {
+	return &Reputation{
+		Store:               reputationStore,
+		Weights:             DefaultPenaltyWeights,
+		HalfLife:            time.Hour,
+		QuarantineThreshold: 10,
+		QuarantineDuration:  15 * time.Minute,
+	}
+}
+
+// Reputation tracks failures attributed to hosts. Penalties decay over time,
+// and hosts whose penalty exceeds the threshold are quarantined.
+type Reputation struct {
+	Store   store.ReputationStore
+	Weights map[Penalty]float64
+
+	// HalfLife is how long it takes for a penalty to decay by half.
+	HalfLife time.Duration
+
+	// QuarantineThreshold is the penalty at which a host is quarantined for
+	// QuarantineDuration, during which it is not offered to nodes. (0 never
+	// quarantines)
+	QuarantineThreshold float64
+	QuarantineDuration  time.Duration
+
+	now func() time.Time // Overridden for testing
+}
+
+func (r *Reputation) timeNow() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// decayed returns the penalty of the reputation as of now.
+func (r *Reputation) decayed(rep store.HostReputation, now time.Time) float64 {
+	if r.HalfLife <= 0 || rep.Updated.IsZero() {
+		return rep.Penalty
+	}
+	elapsed := now.Sub(rep.Updated)
+	if elapsed <= 0 {
+		return rep.Penalty
+	}
+	return rep.Penalty * math.Pow(0.5, float64(elapsed)/float64(r.HalfLife))
+}
+
+// Penalize records a failure for the host, and quarantines the host if its
+// penalty exceeds the threshold.
+func (r *Reputation) Penalize(nodeID store.NodeID, penalty Penalty) error {
+	now := r.timeNow()
+	return r.Store.UpdateHostReputation(nodeID, func(rep *store.HostReputation) error {
+		rep.Penalty = r.decayed(*rep, now) + r.Weights[penalty]
+		rep.Updated = now
+
+		switch penalty {
+		case PenaltyWhitelistFailure:
+			rep.NumWhitelistFailures += 1
+		case PenaltyWhitelistTimeout:
+			rep.NumWhitelistTimeouts += 1
+		case PenaltyConnectFailure:
+			rep.NumConnectFailures += 1
+		case PenaltyDisconnect:
+			rep.NumDisconnects += 1
+		case PenaltyFork:
+			rep.NumForks += 1
+		}
+
+		if r.QuarantineThreshold > 0 && rep.Penalty >= r.QuarantineThreshold && !now.Before(rep.QuarantineUntil) {
+			rep.QuarantineUntil = now.Add(r.QuarantineDuration)
+			logger.Printf("Quarantining host until %s after %s: %s (penalty=%0.2f)", rep.QuarantineUntil.Format(time.RFC3339), penalty, nodeID, rep.Penalty)
+		}
+		return nil
+	})
+}
+
+// Get returns the host's current penalty, and whether it is quarantined.
+func (r *Reputation) Get(nodeID store.NodeID) (penalty float64, quarantined bool, err error) {
+	rep, err := r.Store.GetHostReputation(nodeID)
+	if err != nil {
+		return 0, false, err
+	}
+	now := r.timeNow()
+	return r.decayed(rep, now), now.Before(rep.QuarantineUntil), nil
+}
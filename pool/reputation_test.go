@@ -0,0 +1,132 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/pool/store"
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+)
+
+type failingService struct{}
+
+func (failingService) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	return errors.New("whitelist failed")
+}
+
+func TestReputation(t *testing.T) {
+	now := time.Now()
+	r := NewReputation(memory.New())
+	r.QuarantineThreshold = 3
+	r.now = func() time.Time { return now }
+
+	nodeID := store.NodeID("foo")
+	if err := r.Penalize(nodeID, PenaltyWhitelistTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if penalty, quarantined, err := r.Get(nodeID); err != nil {
+		t.Fatal(err)
+	} else if penalty != 2 || quarantined {
+		t.Errorf("got penalty=%f quarantined=%t; want 2 and false", penalty, quarantined)
+	}
+
+	// Penalty decays by half
+	now = now.Add(r.HalfLife)
+	if penalty, _, err := r.Get(nodeID); err != nil {
+		t.Fatal(err)
+	} else if penalty != 1 {
+		t.Errorf("got decayed penalty=%f; want 1", penalty)
+	}
+
+	if err := r.Penalize(nodeID, PenaltyWhitelistTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if penalty, quarantined, err := r.Get(nodeID); err != nil {
+		t.Fatal(err)
+	} else if penalty != 3 || !quarantined {
+		t.Errorf("got penalty=%f quarantined=%t; want 3 and true", penalty, quarantined)
+	}
+
+	// Quarantine expires
+	now = now.Add(r.QuarantineDuration)
+	if _, quarantined, err := r.Get(nodeID); err != nil {
+		t.Fatal(err)
+	} else if quarantined {
+		t.Error("quarantine did not expire")
+	}
+
+	rep, err := r.Store.GetHostReputation(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.NumWhitelistTimeouts != 2 {
+		t.Errorf("wrong number of timeouts: %d", rep.NumWhitelistTimeouts)
+	}
+}
+
+func TestRequestHostsQuarantine(t *testing.T) {
+	p := New(memory.New(), nil)
+	p.Reputation.QuarantineThreshold = 1
+
+	host := store.Node{ID: "host", URI: "enode://host@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()}
+	for _, node := range []store.Node{host, {ID: "client", Kind: "geth", LastSeen: time.Now()}} {
+		if err := p.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.remoteHosts[host.ID] = failingService{}
+
+	if _, err := p.requestHosts(context.Background(), "client", 3, "", nil); err == nil {
+		t.Fatal("expected whitelist error")
+	}
+	if _, quarantined, err := p.Reputation.Get(host.ID); err != nil {
+		t.Fatal(err)
+	} else if !quarantined {
+		t.Error("host was not quarantined after failing whitelist")
+	}
+
+	_, err := p.requestHosts(context.Background(), "client", 3, "", nil)
+	if _, ok := err.(NoHostNodesError); !ok {
+		t.Errorf("expected NoHostNodesError for quarantined host, got: %v", err)
+	}
+}
+
+func TestReportFailedPeers(t *testing.T) {
+	p := New(memory.New(), nil)
+	for _, node := range []store.Node{
+		{ID: "host", URI: "enode://host@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+		{ID: "other", URI: "enode://other@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()},
+		{ID: "client", Kind: "geth", LastSeen: time.Now()},
+	} {
+		if err := p.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Hosts that weren't offered to the client are ignored
+	p.reportFailedPeers("client", []string{"host", "other"}, nil)
+
+	// Connected peers and non-hosts are ignored
+	p.recordOffered("client", []store.Node{{ID: "host"}, {ID: "other"}, {ID: "unknown"}})
+	p.reportFailedPeers("client", []string{"host", "other", "client", "unknown"}, []string{"other"})
+
+	// Each offer can only be reported once
+	p.reportFailedPeers("client", []string{"host"}, nil)
+
+	// Expired offers are ignored
+	p.recordOffered("client", []store.Node{{ID: "other"}})
+	p.offered["client"]["other"] = time.Now().Add(-offerWindow - time.Second)
+	p.reportFailedPeers("client", []string{"other"}, nil)
+
+	for nodeID, want := range map[store.NodeID]int{"host": 1, "other": 0, "client": 0} {
+		rep, err := p.Store.GetHostReputation(nodeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rep.NumConnectFailures != want {
+			t.Errorf("%s: got %d connect failures; want %d", nodeID, rep.NumConnectFailures, want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package pool
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+// HostCandidate is an active host with a connected remote which can be
+// offered to a node that is requesting peers.
+type HostCandidate struct {
+	store.Node
+	NumClients int     // NumClients is the number of clients the host is currently peered with.
+	Penalty    float64 // Penalty is the host's current reputation penalty, see Reputation.
+}
+
+// HostSelector chooses which hosts are offered to a node requesting peers.
+type HostSelector interface {
+	// SelectHosts returns up to num candidates, in order of preference.
+	SelectHosts(candidates []HostCandidate, num int) []HostCandidate
+}
+
+// HostScorer scores candidates so that they can be combined with
+// WeightedSelector.
+type HostScorer interface {
+	// ScoreHosts returns a score between 0 and 1 for each candidate, where a
+	// higher score is preferred.
+	ScoreHosts(candidates []HostCandidate) []float64
+}
+
+var _ HostSelector = RandomSelector{}
+var _ HostSelector = LeastLoadedSelector{}
+var _ HostSelector = FreshestBlockSelector{}
+var _ HostSelector = LongestUptimeSelector{}
+var _ HostSelector = ReliableSelector{}
+var _ HostSelector = WeightedSelector{}
+
+// DefaultHostSelector is used when the pool's HostSelector is not set. It
+// selects hosts at random, but prefers hosts with fewer reputation penalties.
+var DefaultHostSelector HostSelector = WeightedSelector{
+	{Scorer: RandomSelector{}, Weight: 1},
+	{Scorer: ReliableSelector{}, Weight: 2},
+}
+
+// RandomSelector selects hosts at random.
+type RandomSelector struct{}
+
+// ScoreHosts returns random scores.
+func (RandomSelector) ScoreHosts(candidates []HostCandidate) []float64 {
+	scores := make([]float64, len(candidates))
+	for i := range scores {
+		scores[i] = rand.Float64()
+	}
+	return scores
+}
+
+// SelectHosts returns num hosts at random.
+func (s RandomSelector) SelectHosts(candidates []HostCandidate, num int) []HostCandidate {
+	return selectByScore(candidates, num, s.ScoreHosts(candidates))
+}
+
+// LeastLoadedSelector prefers hosts with the fewest clients.
+type LeastLoadedSelector struct{}
+
+// ScoreHosts scores hosts relative to the most loaded candidate.
+func (LeastLoadedSelector) ScoreHosts(candidates []HostCandidate) []float64 {
+	most := 0
+	for _, c := range candidates {
+		if c.NumClients > most {
+			most = c.NumClients
+		}
+	}
+	scores := make([]float64, len(candidates))
+	for i, c := range candidates {
+		if most == 0 {
+			scores[i] = 1
+			continue
+		}
+		scores[i] = 1 - float64(c.NumClients)/float64(most)
+	}
+	return scores
+}
+
+// SelectHosts returns the num least loaded hosts.
+func (s LeastLoadedSelector) SelectHosts(candidates []HostCandidate, num int) []HostCandidate {
+	return selectByScore(candidates, num, s.ScoreHosts(candidates))
+}
+
+// FreshestBlockSelector prefers hosts with the highest block number.
+type FreshestBlockSelector struct{}
+
+// ScoreHosts scores hosts by how close they are to the highest block number
+// among the candidates.
+func (FreshestBlockSelector) ScoreHosts(candidates []HostCandidate) []float64 {
+	if len(candidates) == 0 {
+		return nil
+	}
+	lowest, highest := candidates[0].BlockNumber, candidates[0].BlockNumber
+	for _, c := range candidates[1:] {
+		if c.BlockNumber < lowest {
+			lowest = c.BlockNumber
+		}
+		if c.BlockNumber > highest {
+			highest = c.BlockNumber
+		}
+	}
+	scores := make([]float64, len(candidates))
+	for i, c := range candidates {
+		if highest == lowest {
+			scores[i] = 1
+			continue
+		}
+		scores[i] = float64(c.BlockNumber-lowest) / float64(highest-lowest)
+	}
+	return scores
+}
+
+// SelectHosts returns the num hosts with the freshest blocks.
+func (s FreshestBlockSelector) SelectHosts(candidates []HostCandidate, num int) []HostCandidate {
+	return selectByScore(candidates, num, s.ScoreHosts(candidates))
+}
+
+// LongestUptimeSelector prefers hosts that have been connected to the pool
+// the longest.
+type LongestUptimeSelector struct{}
+
+// ScoreHosts scores hosts relative to the longest connected candidate.
+func (LongestUptimeSelector) ScoreHosts(candidates []HostCandidate) []float64 {
+	now := time.Now()
+	var longest time.Duration
+	uptimes := make([]time.Duration, len(candidates))
+	for i, c := range candidates {
+		if c.ConnectedSince.IsZero() {
+			continue
+		}
+		uptimes[i] = now.Sub(c.ConnectedSince)
+		if uptimes[i] > longest {
+			longest = uptimes[i]
+		}
+	}
+	scores := make([]float64, len(candidates))
+	for i := range candidates {
+		if longest <= 0 {
+			scores[i] = 1
+			continue
+		}
+		scores[i] = float64(uptimes[i]) / float64(longest)
+	}
+	return scores
+}
+
+// SelectHosts returns the num hosts with the longest uptime.
+func (s LongestUptimeSelector) SelectHosts(candidates []HostCandidate, num int) []HostCandidate {
+	return selectByScore(candidates, num, s.ScoreHosts(candidates))
+}
+
+// ReliableSelector prefers hosts with the lowest reputation penalty.
+type ReliableSelector struct{}
+
+// ScoreHosts scores hosts by their penalty, where a host without penalties
+// scores 1.
+func (ReliableSelector) ScoreHosts(candidates []HostCandidate) []float64 {
+	scores := make([]float64, len(candidates))
+	for i, c := range candidates {
+		scores[i] = 1 / (1 + c.Penalty)
+	}
+	return scores
+}
+
+// SelectHosts returns the num hosts with the lowest penalties.
+func (s ReliableSelector) SelectHosts(candidates []HostCandidate, num int) []HostCandidate {
+	return selectByScore(candidates, num, s.ScoreHosts(candidates))
+}
+
+// WeightedScorer is a HostScorer with a relative weight, used by
+// WeightedSelector.
+type WeightedScorer struct {
+	Scorer HostScorer
+	Weight float64
+}
+
+// WeightedSelector prefers hosts with the highest weighted sum of scores.
+type WeightedSelector []WeightedScorer
+
+// ScoreHosts returns the weighted average of the scores.
+func (s WeightedSelector) ScoreHosts(candidates []HostCandidate) []float64 {
+	scores := make([]float64, len(candidates))
+	var total float64
+	for _, w := range s {
+		total += w.Weight
+		for i, score := range w.Scorer.ScoreHosts(candidates) {
+			scores[i] += score * w.Weight
+		}
+	}
+	if total > 0 {
+		for i := range scores {
+			scores[i] /= total
+		}
+	}
+	return scores
+}
+
+// SelectHosts returns the num hosts with the highest weighted scores.
+func (s WeightedSelector) SelectHosts(candidates []HostCandidate, num int) []HostCandidate {
+	return selectByScore(candidates, num, s.ScoreHosts(candidates))
+}
+
+// selectByScore returns up to num candidates with the highest scores. Ties
+// are broken at random, so that equally good hosts share the load.
+func selectByScore(candidates []HostCandidate, num int, scores []float64) []HostCandidate {
+	order := rand.Perm(len(candidates))
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	if num > len(order) {
+		num = len(order)
+	}
+	r := make([]HostCandidate, 0, num)
+	for _, idx := range order[:num] {
+		r = append(r, candidates[idx])
+	}
+	return r
+}
+
+// hostScorers are the built-in strategies by name, used by ParseHostSelector.
+var hostScorers = map[string]HostScorer{
+	"random":         RandomSelector{},
+	"least-loaded":   LeastLoadedSelector{},
+	"freshest-block": FreshestBlockSelector{},
+	"longest-uptime": LongestUptimeSelector{},
+	"reliable":       ReliableSelector{},
+}
+
+// ParseHostSelector returns the selector described by s, which is either the
+// name of a built-in strategy (random, least-loaded, freshest-block,
+// longest-uptime, reliable) or a comma-separated list of strategies with weights, such
+// as "least-loaded:2,freshest-block:1".
+func ParseHostSelector(s string) (HostSelector, error) {
+	var weighted WeightedSelector
+	for _, part := range strings.Split(s, ",") {
+		name, weight := strings.TrimSpace(part), 1.0
+		if idx := strings.Index(name, ":"); idx >= 0 {
+			var err error
+			weight, err = strconv.ParseFloat(name[idx+1:], 64)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid host selector weight: %q", part)
+			}
+			name = name[:idx]
+		}
+		scorer, ok := hostScorers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown host selector: %q", name)
+		}
+		weighted = append(weighted, WeightedScorer{Scorer: scorer, Weight: weight})
+	}
+	if len(weighted) == 1 {
+		return weighted[0].Scorer.(HostSelector), nil
+	}
+	return weighted, nil
+}
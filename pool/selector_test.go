@@ -0,0 +1,78 @@
+package pool
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+func selectedIDs(hosts []HostCandidate) []store.NodeID {
+	r := make([]store.NodeID, 0, len(hosts))
+	for _, h := range hosts {
+		r = append(r, h.ID)
+	}
+	return r
+}
+
+func TestHostSelectors(t *testing.T) {
+	now := time.Now()
+	candidates := []HostCandidate{
+		{Node: store.Node{ID: "a", BlockNumber: 100, ConnectedSince: now.Add(-time.Minute)}, NumClients: 5},
+		{Node: store.Node{ID: "b", BlockNumber: 98, ConnectedSince: now.Add(-time.Hour)}, NumClients: 0},
+		{Node: store.Node{ID: "c", BlockNumber: 90, ConnectedSince: now.Add(-2 * time.Hour)}, NumClients: 2},
+	}
+
+	testcases := []struct {
+		Selector HostSelector
+		Want     []store.NodeID
+	}{
+		{LeastLoadedSelector{}, []store.NodeID{"b", "c"}},
+		{FreshestBlockSelector{}, []store.NodeID{"a", "b"}},
+		{LongestUptimeSelector{}, []store.NodeID{"c", "b"}},
+		{WeightedSelector{
+			{Scorer: LeastLoadedSelector{}, Weight: 1},
+			{Scorer: FreshestBlockSelector{}, Weight: 1},
+		}, []store.NodeID{"b", "a"}},
+	}
+
+	for i, tc := range testcases {
+		got := selectedIDs(tc.Selector.SelectHosts(candidates, 2))
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("case #%d %T: got %q; want %q", i, tc.Selector, got, tc.Want)
+		}
+	}
+
+	if got := (RandomSelector{}).SelectHosts(candidates, 5); len(got) != len(candidates) {
+		t.Errorf("random selector returned wrong number of hosts: %d", len(got))
+	}
+}
+
+func TestParseHostSelector(t *testing.T) {
+	s, err := ParseHostSelector("least-loaded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(LeastLoadedSelector); !ok {
+		t.Errorf("wrong selector: %T", s)
+	}
+
+	s, err = ParseHostSelector("least-loaded:2, freshest-block")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WeightedSelector{
+		{Scorer: LeastLoadedSelector{}, Weight: 2},
+		{Scorer: FreshestBlockSelector{}, Weight: 1},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got: %v; want %v", s, want)
+	}
+
+	for _, invalid := range []string{"", "fastest", "random:x", "random:-1"} {
+		if _, err := ParseHostSelector(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package pool
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,13 +38,20 @@ func New(storeDriver store.Store, manager balance.Manager) *VipnodePool {
 
 		Store:            storeDriver,
 		BalanceManager:   manager,
+		Reputation:       NewReputation(storeDriver),
 		remoteHosts:      map[store.NodeID]jsonrpc2.Service{},
 		remoteNodeLookup: map[jsonrpc2.Service]store.NodeID{},
+		forks:            newForkDetector(),
+		offered:          map[store.NodeID]map[store.NodeID]time.Time{},
 	}
 }
 
 const poolWhitelistTimeout = 5 * time.Second
 
+// offerWindow is how long after offering a host to a node that the node's
+// report of failing to connect to the host is accepted.
+const offerWindow = 5 * time.Minute
+
 // VipnodePool implements a Pool service with balance tracking.
 type VipnodePool struct {
 	// Version is returned as the PoolVersion in the ClientResponse when a new client connects.
@@ -51,13 +61,26 @@ type VipnodePool struct {
 	BalanceManager      balance.Manager
 	ClientMessager      func(nodeID string) string
 	MaxRequestHosts     int                                     // MaxRequestHosts is the maximum number of hosts a client is allowed to request (0 is unlimited)
-	RestrictNetwork     ethnode.NetworkID                       // TODO: Wire this up
+	MaxBlockLag         uint64                                  // MaxBlockLag is the maximum number of blocks a host can be behind the median host block of its network to be offered to nodes (0 is unlimited)
+	Networks            []ethnode.NetworkID                     // Networks restricts nodes to these networks, or any network if empty. Nodes are only matched with hosts on the same network.
 	BlockNumberProvider func(ethnode.NetworkID) (uint64, error) // BlockNumberProvider returns the latest block number that is known for the given network.
+	HostSelector        HostSelector                            // HostSelector chooses which hosts are offered to nodes requesting peers. (Default: DefaultHostSelector)
+	Reputation          *Reputation                             // Reputation tracks host failures, to deprioritize or quarantine unreliable hosts. (Optional)
+	InviteOnly          bool                                    // InviteOnly only allows nodes that match the allow list, see Allow.
+	Cluster             *Cluster                                // Cluster links pool instances that share the Store, so hosts connected to other instances can be reached. (Optional)
+	Federation          *Federation                             // Federation links partner pools, which are asked for hosts when this pool doesn't have enough. (Optional)
+	Events              *Events                                 // Events publishes what happens in the pool to subscribers. (Optional)
+	Metrics             *Metrics                                // Metrics records pool activity for the /metrics endpoint. (Optional)
 	skipWhitelist       bool                                    // skipWhitelist is used for testing.
 
 	mu               sync.Mutex
 	remoteHosts      map[store.NodeID]jsonrpc2.Service
-	remoteNodeLookup map[jsonrpc2.Service]store.NodeID // Reverse lookup
+	remoteNodeLookup map[jsonrpc2.Service]store.NodeID           // Reverse lookup
+	maintenance      bool                                        // Reject new connections and peering requests
+	forks            *forkDetector                               // Block hashes reported by hosts, to detect forked hosts
+	forkHosts        map[ethnode.NetworkID]networkHosts          // Active hosts of each network for fork checks, see activeNetworkHosts
+	forkHostsUpdated time.Time                                   // When forkHosts was loaded
+	offered          map[store.NodeID]map[store.NodeID]time.Time // Hosts recently offered to each node, see reportFailedPeers
 }
 
 // TODO: Move CloseRemote and NumRemotes, and remoteHosts etc into a separate struct?
@@ -65,17 +88,28 @@ type VipnodePool struct {
 // CloseRemote is to be called when a remote service is disconnected. It is used to clean up state.
 func (p *VipnodePool) CloseRemote(remote jsonrpc2.Service) error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	nodeID, ok := p.remoteNodeLookup[remote]
 	if !ok {
 		// Nothing to clean up
+		p.mu.Unlock()
 		return nil
 	}
 
 	delete(p.remoteNodeLookup, remote)
-	delete(p.remoteHosts, nodeID)
+	isCurrent := p.remoteHosts[nodeID] == remote
+	if isCurrent {
+		// Skip if the host already reconnected on a different remote
+		delete(p.remoteHosts, nodeID)
+	}
+	p.mu.Unlock()
 
+	if isCurrent {
+		p.forks.Forget(nodeID)
+		p.penalize(nodeID, PenaltyDisconnect)
+		p.Metrics.nodeGone(nodeID)
+		p.publish(Event{Topic: EventNodeDisconnected, NodeID: string(nodeID), Message: "connection closed"})
+		p.publishLastHost(nodeID)
+	}
 	return nil
 }
 
@@ -86,6 +120,89 @@ func (p *VipnodePool) NumRemotes() int {
 	return len(p.remoteHosts)
 }
 
+// hostRemoteLocked returns the service for calling the host, which is either
+// its connection to this pool instance or a relay through the instance in the
+// Cluster that it's connected to. p.mu must be held.
+func (p *VipnodePool) hostRemoteLocked(host store.Node) (jsonrpc2.Service, bool) {
+	if remote, ok := p.remoteHosts[host.ID]; ok {
+		return remote, true
+	}
+	if p.Cluster == nil {
+		return nil, false
+	}
+	return p.Cluster.relay(host)
+}
+
+// hostMatches returns whether the host supports all of the required
+// protocols. Hosts whose protocols are unknown, such as from older agents,
+// match by kind instead.
+func hostMatches(host store.Node, kind string, protocols []ethnode.Capability) bool {
+	if len(protocols) == 0 || len(host.Caps) == 0 {
+		return kind == "" || host.Kind == kind
+	}
+	return ethnode.SupportsAll(host.Caps, protocols)
+}
+
+// referenceBlock returns the median block number of the hosts on the network
+// that aren't syncing, which hosts are compared to when checking how far
+// behind they are. Block numbers are self-reported, so the median keeps a
+// host that reports an inflated block number from making every other host
+// look like it's lagging. The upper median is used for an even number of
+// hosts, so that hosts that are behind must be a strict majority to lower the
+// reference block, and half of the hosts being behind still counts as lagging.
+func referenceBlock(hosts []store.Node, network ethnode.NetworkID) uint64 {
+	blocks := make([]uint64, 0, len(hosts))
+	for _, node := range hosts {
+		if node.Network == network && !node.Syncing() {
+			blocks = append(blocks, node.BlockNumber)
+		}
+	}
+	if len(blocks) == 0 {
+		return 0
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	return blocks[len(blocks)/2]
+}
+
+// servesNetwork returns whether nodes on the network are allowed to join the
+// pool.
+func (p *VipnodePool) servesNetwork(network ethnode.NetworkID) bool {
+	if len(p.Networks) == 0 {
+		return true
+	}
+	for _, n := range p.Networks {
+		if n == network {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHostname returns the host component of the calling service's remote
+// address, or empty if it's not known.
+func remoteHostname(ctx context.Context) string {
+	service, err := jsonrpc2.CtxService(ctx)
+	if err != nil {
+		return ""
+	}
+	withAddr, ok := service.(interface{ RemoteAddr() string })
+	if !ok {
+		return ""
+	}
+	return (&url.URL{Host: withAddr.RemoteAddr()}).Hostname()
+}
+
+// penalize records a failure against the host's reputation, if reputation
+// tracking is enabled.
+func (p *VipnodePool) penalize(nodeID store.NodeID, penalty Penalty) {
+	if p.Reputation == nil {
+		return
+	}
+	if err := p.Reputation.Penalize(nodeID, penalty); err != nil {
+		logger.Printf("Failed to record %s penalty for host %q: %s", penalty, pretty.Abbrev(string(nodeID)), err)
+	}
+}
+
 func (p *VipnodePool) verify(sig string, method string, nodeID string, nonce int64, args ...interface{}) error {
 	// TODO: Switch nonce to strictly timestamp within X time
 	// TODO: Switch NodeID to pubkey?
@@ -108,7 +225,7 @@ func (p *VipnodePool) disconnectPeers(ctx context.Context, nodeID string, peers
 	count := 0
 	p.mu.Lock()
 	for _, peer := range peers {
-		if remote, ok := p.remoteHosts[peer.ID]; ok {
+		if remote, ok := p.hostRemoteLocked(peer); ok {
 			count += 1
 			go func() {
 				errCh <- remote.Call(callCtx, nil, "vipnode_disconnect", nodeID)
@@ -136,7 +253,6 @@ func (p *VipnodePool) disconnectPeers(ctx context.Context, nodeID string, peers
 
 // Update submits a list of peers that the node is connected to, returning the current account balance.
 func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, nonce int64, req UpdateRequest) (*UpdateResponse, error) {
-	// TODO: Send sync status?
 	if err := p.verify(sig, "vipnode_update", nodeID, nonce, req); err != nil {
 		// Try again with old version (DEPRECATED)
 		if errOld := p.verify(sig, "vipnode_update", nodeID, nonce, oldUpdateRequest{req.Peers, req.BlockNumber}); errOld != nil {
@@ -148,15 +264,36 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 	if err != nil {
 		return nil, err
 	}
+	if err := p.checkAccess(ctx, node.ID, node.Payout); err != nil {
+		return nil, err
+	}
 	nodeBeforeUpdate := *node
+	if node.IsHost && req.MaxClients != node.MaxClients {
+		// Stored so that every pool instance enforces the host's capacity
+		if err := p.Store.SetNodeCapacity(node.ID, req.MaxClients); err != nil {
+			return nil, err
+		}
+	}
 
 	peerIDs := ethnode.Peers(req.PeerInfo).IDs()
 	count := len(req.PeerInfo)
+	if !node.IsHost && p.Federation != nil {
+		p.federatedUpdate(ctx, node.ID, peerIDs, req.BlockNumber)
+	}
 
 	inactive, err := p.Store.UpdateNodePeers(store.NodeID(nodeID), peerIDs, req.BlockNumber)
 	if err != nil {
 		return nil, err
 	}
+	if syncTarget := req.syncTarget(); syncTarget != node.SyncTarget {
+		if err := p.Store.SetNodeSyncing(node.ID, syncTarget); err != nil {
+			return nil, err
+		}
+		if syncTarget == 0 {
+			logger.Printf("Node finished syncing: %q", pretty.Abbrev(nodeID))
+		}
+	}
+	p.Metrics.nodeSeen(nodeBeforeUpdate)
 	active, err := p.Store.NodePeers(store.NodeID(nodeID))
 	if err != nil {
 		return nil, err
@@ -169,11 +306,18 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 	for _, peerID := range inactive {
 		resp.InvalidPeers = append(resp.InvalidPeers, string(peerID))
 	}
+	if len(inactive) > 0 {
+		p.publish(Event{Topic: EventPeersInvalidated, NodeID: nodeID, Peers: resp.InvalidPeers})
+	}
 	for _, peerNode := range active {
 		resp.ActivePeers = append(resp.ActivePeers, peerNode.URI)
 	}
+	p.reportFailedPeers(nodeID, req.FailedPeers, peerIDs)
+	if req.BlockHash != "" && req.BlockHashNumber > 0 && req.BlockNumber >= ForkConfirmations && req.BlockHashNumber <= req.BlockNumber-ForkConfirmations {
+		resp.BlockHash = p.checkFork(nodeBeforeUpdate, req.BlockHashNumber, req.BlockHash)
+	}
 	if p.BlockNumberProvider != nil {
-		resp.LatestBlockNumber, err = p.BlockNumberProvider(p.RestrictNetwork)
+		resp.LatestBlockNumber, err = p.BlockNumberProvider(node.Network)
 		if err != nil {
 			return nil, err
 		}
@@ -182,6 +326,11 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 	nodeBalance, err := p.BalanceManager.OnUpdate(nodeBeforeUpdate, active)
 	if err != nil {
 		if _, ok := err.(balance.LowBalanceError); ok {
+			event := Event{Topic: EventLowBalance, NodeID: nodeID, Peers: resp.ActivePeers, Message: err.Error()}
+			if balance, err := p.Store.GetNodeBalance(store.NodeID(nodeID)); err == nil {
+				event.Balance = &balance
+			}
+			p.publish(event)
 			disconnectErr := p.disconnectPeers(ctx, nodeID, active)
 			if disconnectErr != nil {
 				logger.Printf("Client disconnect due to low balance: %q; disconnect RPC errors: %s", pretty.Abbrev(nodeID), disconnectErr)
@@ -203,6 +352,144 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 	return &resp, nil
 }
 
+// recordOffered remembers the hosts that were offered to the node, so that
+// the node can only report failures for hosts it was actually offered.
+func (p *VipnodePool) recordOffered(nodeID string, hosts []store.Node) {
+	if len(hosts) == 0 {
+		return
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, offers := range p.offered {
+		for hostID, since := range offers {
+			if now.Sub(since) > offerWindow {
+				delete(offers, hostID)
+			}
+		}
+		if len(offers) == 0 {
+			delete(p.offered, id)
+		}
+	}
+	offers, ok := p.offered[store.NodeID(nodeID)]
+	if !ok {
+		offers = map[store.NodeID]time.Time{}
+		p.offered[store.NodeID(nodeID)] = offers
+	}
+	for _, host := range hosts {
+		offers[host.ID] = now
+	}
+}
+
+// takeOffered returns whether the host was offered to the node within the
+// offerWindow, and forgets the offer so it can only be reported once.
+func (p *VipnodePool) takeOffered(nodeID string, hostID store.NodeID) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	offers := p.offered[store.NodeID(nodeID)]
+	since, ok := offers[hostID]
+	if !ok {
+		return false
+	}
+	delete(offers, hostID)
+	return time.Since(since) <= offerWindow
+}
+
+// reportFailedPeers penalizes hosts that the node reported it failed to
+// connect to. Reports are only accepted for hosts that the pool offered to
+// the node recently, once per offer. Reports for peers that the node is
+// connected to, or that aren't hosts, are ignored.
+func (p *VipnodePool) reportFailedPeers(nodeID string, failedPeers []string, connectedPeers []string) {
+	if len(failedPeers) == 0 {
+		return
+	}
+	connected := make(map[string]struct{}, len(connectedPeers))
+	for _, peerID := range connectedPeers {
+		connected[peerID] = struct{}{}
+	}
+	for _, peerID := range failedPeers {
+		if _, ok := connected[peerID]; ok || peerID == nodeID {
+			continue
+		}
+		if !p.takeOffered(nodeID, store.NodeID(peerID)) {
+			// Node wasn't offered this host, can't vouch for the report
+			continue
+		}
+		host, err := p.Store.GetNode(store.NodeID(peerID))
+		if err != nil || !host.IsHost {
+			continue
+		}
+		logger.Printf("Node %q reported failing to connect to host: %q", pretty.Abbrev(nodeID), pretty.Abbrev(peerID))
+		p.penalize(host.ID, PenaltyConnectFailure)
+	}
+}
+
+// forkHostsInterval is how often the active hosts that checkFork compares
+// reports with are reloaded, since hosts report block hashes on every update.
+const forkHostsInterval = 30 * time.Second
+
+// networkHosts is the number of active hosts on a network and their reference
+// block, see referenceBlock.
+type networkHosts struct {
+	count     int
+	reference uint64
+}
+
+// activeNetworkHosts returns the active hosts of the network, as of at most
+// forkHostsInterval ago.
+func (p *VipnodePool) activeNetworkHosts(network ethnode.NetworkID) (networkHosts, error) {
+	p.mu.Lock()
+	if time.Since(p.forkHostsUpdated) < forkHostsInterval {
+		hosts := p.forkHosts[network]
+		p.mu.Unlock()
+		return hosts, nil
+	}
+	p.mu.Unlock()
+
+	active, err := p.Store.ActiveHosts("", 0)
+	if err != nil {
+		return networkHosts{}, err
+	}
+	networks := map[ethnode.NetworkID]networkHosts{}
+	for _, host := range active {
+		hosts := networks[host.Network]
+		hosts.count += 1
+		networks[host.Network] = hosts
+	}
+	for n, hosts := range networks {
+		hosts.reference = referenceBlock(active, n)
+		networks[n] = hosts
+	}
+
+	p.mu.Lock()
+	p.forkHosts = networks
+	p.forkHostsUpdated = time.Now()
+	p.mu.Unlock()
+	return networks[network], nil
+}
+
+// checkFork compares the block hash that the node reported with the hashes
+// that hosts reported for the same block number, and penalizes hosts that
+// repeatedly disagree with the majority of the network's active hosts. Only
+// hosts' hashes are counted. It returns the majority hash, if it's known.
+func (p *VipnodePool) checkFork(node store.Node, number uint64, hash string) string {
+	if !node.IsHost {
+		return p.forks.Majority(node.Network, number)
+	}
+	hosts, err := p.activeNetworkHosts(node.Network)
+	if err != nil {
+		logger.Printf("Failed to count active hosts for fork check: %s", err)
+		return ""
+	}
+	majority, forked := p.forks.Report(node.ID, node.Network, number, hash, hosts.count, hosts.reference)
+	for _, hostID := range forked {
+		logger.Printf("Host keeps disagreeing with the majority of hosts on block hashes, as of block %d: %q", number, pretty.Abbrev(string(hostID)))
+		p.penalize(hostID, PenaltyFork)
+		p.publish(Event{Topic: EventHostForked, NodeID: string(hostID), Message: fmt.Sprintf("majority hash of block %d is %s", number, majority)})
+	}
+	return majority
+}
+
 // Host registers a full node to participate as a vipnode host in this pool.
 // DEPRECATED: Use Connect
 func (p *VipnodePool) Host(ctx context.Context, sig string, nodeID string, nonce int64, req HostRequest) (*HostResponse, error) {
@@ -253,7 +540,7 @@ func (p *VipnodePool) Client(ctx context.Context, sig string, nodeID string, non
 	if req.NumHosts > 0 {
 		numRequestHosts = req.NumHosts
 	}
-	hosts, err := p.requestHosts(ctx, nodeID, numRequestHosts, req.Kind)
+	hosts, err := p.peerHosts(ctx, nodeID, numRequestHosts, req.Kind, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -284,8 +571,21 @@ func (p *VipnodePool) connect(ctx context.Context, nodeID string, req ConnectReq
 	}
 
 	isHost := req.NodeInfo.IsFullNode
-	if p.RestrictNetwork != 0 && p.RestrictNetwork != req.NodeInfo.Network {
-		return nil, fmt.Errorf("node is on the wrong network, pool requires: %s", p.RestrictNetwork)
+	if p.InMaintenance() {
+		return nil, MaintenanceError{}
+	}
+	rules, err := p.loadAccessRules()
+	if err != nil {
+		return nil, err
+	}
+	if err := rules.check(store.NodeID(nodeID), store.Account(req.Payout), net.ParseIP(remoteHostname(ctx))); err != nil {
+		return nil, err
+	}
+	if !p.servesNetwork(req.NodeInfo.Network) {
+		return nil, fmt.Errorf("node is on the wrong network, pool requires one of: %s", p.Networks)
+	}
+	if genesis := req.NodeInfo.Network.GenesisHash(); genesis != "" && req.GenesisHash != "" && !strings.EqualFold(genesis, req.GenesisHash) {
+		return nil, fmt.Errorf("node's genesis block %s does not match the %s network: %s", req.GenesisHash, req.NodeInfo.Network, genesis)
 	}
 
 	response := &ConnectResponse{
@@ -306,6 +606,14 @@ func (p *VipnodePool) connect(ctx context.Context, nodeID string, req ConnectReq
 		Payout:         store.Account(req.Payout),
 		NodeVersion:    req.NodeInfo.Version,
 		VipnodeVersion: req.VipnodeVersion,
+		Network:        req.NodeInfo.Network,
+		Caps:           req.Caps,
+	}
+	if isHost && p.Cluster != nil {
+		node.Instance = p.Cluster.ID
+	}
+	if _, err := ethnode.ParseCapabilities(node.Caps); err != nil {
+		return nil, err
 	}
 
 	if isHost {
@@ -316,25 +624,29 @@ func (p *VipnodePool) connect(ctx context.Context, nodeID string, req ConnectReq
 		}
 
 		// We only care about publicly-visible nodeURIs for hosts.
-		remoteHost := ""
-		if withAddr, ok := service.(interface{ RemoteAddr() string }); ok {
-			remoteHost = (&url.URL{Host: withAddr.RemoteAddr()}).Hostname()
-		}
 		defaultPort := "30303"
-		node.URI, err = normalizeNodeURI(req.NodeURI, nodeID, remoteHost, defaultPort)
+		node.URI, err = normalizeNodeURI(req.NodeURI, nodeID, remoteHostname(ctx), defaultPort)
 		if err != nil {
 			return nil, err
 		}
+		// Clients connect to the host's advertised IP, which could differ
+		if err := rules.check(node.ID, node.Payout, nodeURIIP(node.URI)); err != nil {
+			return nil, err
+		}
 
 		p.mu.Lock()
 		p.remoteHosts[node.ID] = service
 		p.remoteNodeLookup[service] = node.ID
 		p.mu.Unlock()
+
+		node.MaxClients = req.MaxClients
+		node.ConnectedSince = time.Now()
 	}
 
 	if err := p.Store.SetNode(node); err != nil {
 		return nil, err
 	}
+	p.Metrics.nodeSeen(node)
 
 	if err := p.BalanceManager.OnClient(node); err != nil {
 		return nil, err
@@ -345,15 +657,21 @@ func (p *VipnodePool) connect(ctx context.Context, nodeID string, req ConnectReq
 		enode = "enode://" + nodeID + "@"
 	}
 	logger.Printf("Connected %s peer: %q", req.NodeInfo.KindType(), enode)
+	p.publish(Event{Topic: EventNodeConnected, NodeID: nodeID, Account: node.Payout, Message: req.NodeInfo.KindType()})
 
 	return response, nil
 }
 
 // Peer returns a list of enodes who are ready for the node to connect.
 func (p *VipnodePool) Peer(ctx context.Context, sig string, nodeID string, nonce int64, req PeerRequest) (*PeerResponse, error) {
-	// TODO: Should we use protocol capability (eth, les, pip) instead of Kind?
-	// It's hard to get self-reported protocol capability versions though (les/2 vs just les).
-	hosts, err := p.requestHosts(ctx, nodeID, req.Num, req.Kind)
+	if p.InMaintenance() {
+		return nil, MaintenanceError{}
+	}
+	protocols, err := ethnode.ParseCapabilities(req.Protocols)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := p.peerHosts(ctx, nodeID, req.Num, req.Kind, protocols)
 	if err != nil {
 		return nil, err
 	}
@@ -367,7 +685,7 @@ func (p *VipnodePool) Peer(ctx context.Context, sig string, nodeID string, nonce
 
 }
 
-func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numRequestHosts int, kind string) ([]store.Node, error) {
+func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numRequestHosts int, kind string, protocols []ethnode.Capability) ([]store.Node, error) {
 	if p.MaxRequestHosts > 0 && numRequestHosts > p.MaxRequestHosts {
 		numRequestHosts = p.MaxRequestHosts
 	}
@@ -380,6 +698,17 @@ func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numReques
 
 	// Get existing peers that we can skip
 	selfNodeID := store.NodeID(nodeID)
+	self, err := p.Store.GetNode(selfNodeID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := p.loadAccessRules()
+	if err != nil {
+		return nil, err
+	}
+	if err := rules.check(self.ID, self.Payout, net.ParseIP(remoteHostname(ctx))); err != nil {
+		return nil, err
+	}
 	peers, err := p.Store.NodePeers(selfNodeID)
 	if err != nil {
 		return nil, err
@@ -394,17 +723,61 @@ func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numReques
 	// minute. They may not be connected anymore, so we're likely to get fewer
 	// valid peers than number we want. That's okay, the agent can ask again
 	// next cycle for more.
-	r, err := p.Store.ActiveHosts(kind, numRequestHosts+len(skipPeers))
+	queryKind := kind
+	if len(protocols) > 0 {
+		// Hosts of any kind can support the protocols
+		queryKind = ""
+	}
+	r, err := p.Store.ActiveHosts(queryKind, 0)
 	if err != nil {
 		return nil, err
 	}
+	latestBlock := referenceBlock(r, self.Network)
+	matching := r[:0]
+	for _, node := range r {
+		if node.Network != self.Network || !hostMatches(node, kind, protocols) {
+			continue
+		}
+		if node.Syncing() {
+			// Host is still importing the chain
+			continue
+		}
+		if p.MaxBlockLag > 0 && latestBlock > p.MaxBlockLag && node.BlockNumber < latestBlock-p.MaxBlockLag {
+			// Host is too far behind the other hosts on its network
+			continue
+		}
+		if node.Federation != "" {
+			// Hosts of partner pools are only offered by their own pool
+			continue
+		}
+		if rules.check(node.ID, node.Payout, nodeURIIP(node.URI)) != nil {
+			// Host was banned or disallowed after it connected
+			continue
+		}
+		matching = append(matching, node)
+	}
+	r = matching
+
+	selector := p.HostSelector
+	if selector == nil {
+		selector = DefaultHostSelector
+	}
 
 	if p.skipWhitelist {
 		// Bypass whitelisting, used for making testing simpler
-		return r, nil
+		candidates := make([]HostCandidate, 0, len(r))
+		for _, node := range r {
+			candidates = append(candidates, HostCandidate{Node: node})
+		}
+		for _, c := range selector.SelectHosts(candidates, numRequestHosts) {
+			hosts = append(hosts, c.Node)
+		}
+		p.recordOffered(nodeID, hosts)
+		return hosts, nil
 	}
 
-	remotes := make([]hostService, 0, len(r))
+	candidates := make([]HostCandidate, 0, len(r))
+	remoteLookup := make(map[store.NodeID]jsonrpc2.Service, len(r))
 	p.mu.Lock()
 	for _, node := range r {
 		if _, skip := skipPeers[node.ID]; skip {
@@ -412,11 +785,10 @@ func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numReques
 			continue
 		}
 
-		remote, ok := p.remoteHosts[node.ID]
+		remote, ok := p.hostRemoteLocked(node)
 		if ok {
-			remotes = append(remotes, hostService{
-				node, remote,
-			})
+			remoteLookup[node.ID] = remote
+			candidates = append(candidates, HostCandidate{Node: node})
 		} else {
 			// TODO: Good time to mark the host as inactive? Or would that mess
 			// with assumptions about some grace period of activity we
@@ -426,6 +798,43 @@ func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numReques
 	}
 	p.mu.Unlock()
 
+	available := candidates[:0]
+	for _, c := range candidates {
+		if p.Reputation != nil {
+			penalty, quarantined, err := p.Reputation.Get(c.ID)
+			if err != nil {
+				return nil, err
+			}
+			if quarantined {
+				continue
+			}
+			c.Penalty = penalty
+		}
+		hostPeers, err := p.Store.NodePeers(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, peer := range hostPeers {
+			if !peer.IsHost {
+				c.NumClients += 1
+			}
+		}
+		if c.MaxClients > 0 && c.NumClients >= c.MaxClients {
+			// Host is at capacity
+			continue
+		}
+		available = append(available, c)
+	}
+	candidates = available
+
+	selected := selector.SelectHosts(candidates, numRequestHosts)
+	remotes := make([]hostService, 0, len(selected))
+	for _, c := range selected {
+		remotes = append(remotes, hostService{
+			c.Node, remoteLookup[c.ID],
+		})
+	}
+
 	accepted := make([]store.Node, 0, len(remotes))
 	callCtx, cancel := context.WithTimeout(ctx, poolWhitelistTimeout)
 
@@ -435,7 +844,17 @@ func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numReques
 
 	for _, remote := range remotes {
 		go func(service jsonrpc2.Service, node store.Node) {
-			if err := service.Call(callCtx, nil, "vipnode_whitelist", nodeID); err != nil {
+			start := time.Now()
+			err := service.Call(callCtx, nil, "vipnode_whitelist", nodeID)
+			p.Metrics.whitelisted(start, err, ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded)
+			if err != nil {
+				if ctx.Err() != nil {
+					// The requesting node went away, not the host's fault
+				} else if callCtx.Err() == context.DeadlineExceeded {
+					p.penalize(node.ID, PenaltyWhitelistTimeout)
+				} else {
+					p.penalize(node.ID, PenaltyWhitelistFailure)
+				}
 				errChan <- err
 			} else {
 				acceptChan <- node
@@ -448,12 +867,15 @@ func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numReques
 		select {
 		case node := <-acceptChan:
 			accepted = append(accepted, node)
+			p.publish(Event{Topic: EventHostWhitelisted, NodeID: string(node.ID), Peers: []string{nodeID}})
 		case err := <-errChan:
 			errors = append(errors, err)
 		}
 	}
 	cancel()
-	// TODO: Penalize hosts that failed to respond within the deadline?
+	if len(remotes) > 0 {
+		p.Metrics.requestedHosts(len(accepted))
+	}
 
 	if len(errors) > 0 {
 		err = RemoteHostErrors{"vipnode_whitelist", errors}
@@ -464,6 +886,7 @@ func (p *VipnodePool) requestHosts(ctx context.Context, nodeID string, numReques
 
 	if len(accepted) >= 1 {
 		// We're okay returning without an error as long as some hosts succeeded.
+		p.recordOffered(nodeID, accepted)
 		return accepted, nil
 	}
 
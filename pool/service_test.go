@@ -2,12 +2,17 @@ package pool
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/v2/ethnode"
 	"github.com/vipnode/vipnode/v2/internal/keygen"
 	"github.com/vipnode/vipnode/v2/jsonrpc2"
+	"github.com/vipnode/vipnode/v2/pool/store"
 	"github.com/vipnode/vipnode/v2/pool/store/memory"
 	"github.com/vipnode/vipnode/v2/request"
 )
@@ -78,3 +83,210 @@ func TestPoolService(t *testing.T) {
 		}
 	}
 }
+
+func TestPoolNetworks(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.Networks = []ethnode.NetworkID{ethnode.Mainnet, ethnode.Goerli}
+	pool.skipWhitelist = true
+
+	for _, node := range []store.Node{
+		{ID: "mainnet-host", URI: "enode://mainnet-host@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), Network: ethnode.Mainnet},
+		{ID: "goerli-host", URI: "enode://goerli-host@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), Network: ethnode.Goerli},
+		{ID: "client", Kind: "geth", LastSeen: time.Now(), Network: ethnode.Goerli},
+	} {
+		if err := pool.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hosts, err := pool.requestHosts(context.Background(), "client", 3, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].ID != "goerli-host" {
+		t.Errorf("wrong hosts for goerli client: %v", hosts)
+	}
+
+	req := ConnectRequest{
+		NodeInfo: ethnode.UserAgent{Kind: ethnode.Geth, Network: ethnode.Rinkeby},
+	}
+	if _, err := pool.connect(context.Background(), "rinkeby-client", req); err == nil {
+		t.Error("expected wrong network error")
+	}
+}
+
+func TestPoolProtocols(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+
+	for _, node := range []store.Node{
+		{ID: "geth-les", URI: "enode://geth-les@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), Caps: []string{"eth/63", "les"}},
+		{ID: "geth-eth", URI: "enode://geth-eth@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), Caps: []string{"eth/63"}},
+		{ID: "parity-les", URI: "enode://parity-les@127.0.0.1:30303", IsHost: true, Kind: "parity", LastSeen: time.Now(), Caps: []string{"eth/63", "les/2"}},
+		{ID: "client", Kind: "geth", LastSeen: time.Now()},
+	} {
+		if err := pool.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	protocols := []ethnode.Capability{{Name: "les", Version: 2}}
+	hosts, err := pool.requestHosts(context.Background(), "client", 10, "geth", protocols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.Nodes(hosts).IDs(), []string{"geth-les", "parity-les"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts: %q; want %q", got, want)
+	}
+
+	// Older agents don't report caps, so their hosts are matched by kind
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	privkey := keygen.HardcodedKeyIdx(t, 0)
+	nodeID := discv5.PubkeyID(&privkey.PublicKey).String()
+	req := ConnectRequest{
+		NodeInfo: ethnode.UserAgent{Kind: ethnode.Geth, IsFullNode: true, EthProtocol: "0x3f"},
+		NodeURI:  fmt.Sprintf("enode://%s@127.0.0.1:30303", nodeID),
+	}
+	if _, err := Remote(host, privkey).Connect(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err = pool.requestHosts(context.Background(), "client", 10, "geth", protocols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.Nodes(hosts).IDs(), []string{nodeID, "geth-les", "parity-les"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts: %q; want %q", got, want)
+	}
+	hosts, err = pool.requestHosts(context.Background(), "client", 10, "parity", protocols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.Nodes(hosts).IDs(), []string{"geth-les", "parity-les"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts: %q; want %q", got, want)
+	}
+}
+
+func TestPoolBlockLag(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+	pool.MaxBlockLag = 10
+
+	for _, node := range []store.Node{
+		{ID: "latest", URI: "enode://latest@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: 1000},
+		{ID: "current", URI: "enode://current@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: 1000},
+		{ID: "recent", URI: "enode://recent@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: 999},
+		{ID: "behind", URI: "enode://behind@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: 989},
+		{ID: "lagging", URI: "enode://lagging@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: 988},
+		{ID: "syncing", URI: "enode://syncing@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: 1000, SyncTarget: 1001},
+		{ID: "goerli", URI: "enode://goerli@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: 5000, Network: ethnode.Goerli},
+		{ID: "client", Kind: "geth", LastSeen: time.Now(), BlockNumber: 2000},
+	} {
+		if err := pool.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hosts, err := pool.requestHosts(context.Background(), "client", 10, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.Nodes(hosts).IDs(), []string{"behind", "current", "latest", "recent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts: %q; want %q", got, want)
+	}
+
+	// A host reporting an inflated block number only moves the reference block
+	// to the next host's
+	inflated := store.Node{ID: "inflated", URI: "enode://inflated@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now(), BlockNumber: math.MaxUint64 - 1}
+	if err := pool.Store.SetNode(inflated); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err = pool.requestHosts(context.Background(), "client", 10, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.Nodes(hosts).IDs(), []string{"current", "inflated", "latest", "recent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts: %q; want %q", got, want)
+	}
+
+	// Lagging hosts are offered without a limit, syncing hosts are not
+	pool.MaxBlockLag = 0
+	hosts, err = pool.requestHosts(context.Background(), "client", 10, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.Nodes(hosts).IDs(), []string{"behind", "current", "inflated", "lagging", "latest", "recent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts: %q; want %q", got, want)
+	}
+
+	// Half of the hosts being behind doesn't lower the reference block
+	even := []store.Node{
+		{Network: ethnode.Mainnet, BlockNumber: 1000},
+		{Network: ethnode.Mainnet, BlockNumber: 900},
+		{Network: ethnode.Mainnet, BlockNumber: 1000},
+		{Network: ethnode.Mainnet, BlockNumber: 900},
+	}
+	if got := referenceBlock(even, ethnode.Mainnet); got != 1000 {
+		t.Errorf("wrong reference block: %d", got)
+	}
+
+	for _, tc := range []struct {
+		req  UpdateRequest
+		want uint64
+	}{
+		{UpdateRequest{BlockNumber: 100}, 0},
+		{UpdateRequest{BlockNumber: 100, Syncing: &ethnode.SyncProgress{CurrentBlock: 100, HighestBlock: 200}}, 200},
+		{UpdateRequest{BlockNumber: 100, Syncing: &ethnode.SyncProgress{}}, 101},
+	} {
+		if got := tc.req.syncTarget(); got != tc.want {
+			t.Errorf("wrong sync target for %+v: got %d; want %d", tc.req.Syncing, got, tc.want)
+		}
+	}
+}
+
+type acceptingService struct{}
+
+func (acceptingService) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	return nil
+}
+
+func TestPoolHostCapacity(t *testing.T) {
+	pool := New(memory.New(), nil)
+
+	host := store.Node{ID: "host", URI: "enode://host@127.0.0.1:30303", IsHost: true, Kind: "geth", LastSeen: time.Now()}
+	for _, node := range []store.Node{
+		host,
+		{ID: "client1", Kind: "geth", LastSeen: time.Now()},
+		{ID: "client2", Kind: "geth", LastSeen: time.Now()},
+	} {
+		if err := pool.Store.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool.remoteHosts[host.ID] = acceptingService{}
+	if err := pool.Store.SetNodeCapacity(host.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Host is already serving client1
+	if _, err := pool.Store.UpdateNodePeers(host.ID, []string{"client1"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := pool.requestHosts(context.Background(), "client2", 3, "", nil)
+	if _, ok := err.(NoHostNodesError); !ok {
+		t.Errorf("expected NoHostNodesError for full host, got: %v", err)
+	}
+
+	// Host raises its capacity
+	if err := pool.Store.SetNodeCapacity(host.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := pool.requestHosts(context.Background(), "client2", 3, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].ID != host.ID {
+		t.Errorf("wrong hosts: %v", hosts)
+	}
+}
@@ -18,8 +18,13 @@ type Host struct {
 	ShortID     string    `json:"short_id"`
 	LastSeen    time.Time `json:"last_seen"`
 	Kind        string    `json:"kind"`
+	Network     string    `json:"network"`
 	BlockNumber uint64    `json:"block_number"`
 	NumPeers    int       `json:"num_peers"`
+	// Syncing is set if the host is still importing the chain, up to
+	// SyncTarget. Syncing hosts are not offered to nodes.
+	Syncing    bool   `json:"syncing"`
+	SyncTarget uint64 `json:"sync_target,omitempty"`
 
 	NodeVersion    string `json:"node_version"`
 	VipnodeVersion string `json:"vipnode_version"`
@@ -34,8 +39,11 @@ func nodeHost(n store.Node, numPeers int) Host {
 		ShortID:     shortID,
 		LastSeen:    n.LastSeen,
 		Kind:        n.Kind,
+		Network:     n.Network.String(),
 		BlockNumber: n.BlockNumber,
 		NumPeers:    numPeers,
+		Syncing:     n.Syncing(),
+		SyncTarget:  n.SyncTarget,
 
 		NodeVersion:    n.NodeVersion,
 		VipnodeVersion: n.VipnodeVersion,
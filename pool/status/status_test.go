@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/vipnode/vipnode/v2/ethnode"
 	"github.com/vipnode/vipnode/v2/pool/store"
 	"github.com/vipnode/vipnode/v2/pool/store/memory"
 )
@@ -55,7 +56,7 @@ func TestPoolStatus(t *testing.T) {
 
 	compareJSON(t, r, expected)
 
-	hostNode := store.Node{ID: "12345678901234567890", IsHost: true, Kind: "geth", LastSeen: now}
+	hostNode := store.Node{ID: "12345678901234567890", IsHost: true, Kind: "geth", LastSeen: now, Network: ethnode.Goerli, BlockNumber: 100, SyncTarget: 500}
 	if err := s.Store.SetNode(hostNode); err != nil {
 		t.Fatal(err)
 	}
@@ -81,14 +82,23 @@ func TestPoolStatus(t *testing.T) {
 		TimeStarted: now,
 		Version:     "foo",
 		Stats: &store.Stats{
-			NumTotalHosts:  1,
-			NumActiveHosts: 1,
+			NumTotalHosts:     1,
+			NumActiveHosts:    1,
+			NumSyncingHosts:   1,
+			LatestBlockNumber: 100,
+			Networks: map[ethnode.NetworkID]*store.NetworkStats{
+				ethnode.Goerli: {Name: "goerli", NumTotalHosts: 1, NumActiveHosts: 1, NumSyncingHosts: 1, LatestBlockNumber: 100},
+			},
 		},
 		ActiveHosts: []Host{
 			Host{
-				ShortID:  "123456789012",
-				LastSeen: now,
-				Kind:     "geth",
+				ShortID:     "123456789012",
+				LastSeen:    now,
+				Kind:        "geth",
+				Network:     "goerli",
+				BlockNumber: 100,
+				Syncing:     true,
+				SyncTarget:  500,
 			},
 		},
 		Error: nil,
@@ -319,7 +319,8 @@ func (s *badgerStore) ActiveHosts(kind string, limit int) ([]store.Node, error)
 		return r, nil
 	}
 
-	// FIXME: Is there a different sorting method we want to use? Maybe sort by last seen?
+	// The pool's HostSelector does any preferential selection, so a random
+	// subset is fine here.
 	rand.Shuffle(len(r), func(i, j int) {
 		r[i], r[j] = r[j], r[i]
 	})
@@ -382,6 +383,37 @@ func (s *badgerStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
 	return r, err
 }
 
+// SetNodeSyncing sets the node's SyncTarget, which is 0 once the node is done
+// syncing.
+func (s *badgerStore) SetNodeSyncing(nodeID store.NodeID, syncTarget uint64) error {
+	nodeKey := []byte(fmt.Sprintf("vip:node:%s", nodeID))
+	return s.db.Update(func(txn *badger.Txn) error {
+		var node store.Node
+		if err := getItem(txn, nodeKey, &node); err == badger.ErrKeyNotFound {
+			return store.ErrUnregisteredNode
+		} else if err != nil {
+			return err
+		}
+		node.SyncTarget = syncTarget
+		return setItem(txn, nodeKey, &node)
+	})
+}
+
+// SetNodeCapacity sets the node's MaxClients, where 0 is unlimited.
+func (s *badgerStore) SetNodeCapacity(nodeID store.NodeID, maxClients int) error {
+	nodeKey := []byte(fmt.Sprintf("vip:node:%s", nodeID))
+	return s.db.Update(func(txn *badger.Txn) error {
+		var node store.Node
+		if err := getItem(txn, nodeKey, &node); err == badger.ErrKeyNotFound {
+			return store.ErrUnregisteredNode
+		} else if err != nil {
+			return err
+		}
+		node.MaxClients = maxClients
+		return setItem(txn, nodeKey, &node)
+	})
+}
+
 // UpdateNodePeers updates the Node's peers and the node's LastSeen timestamp.
 // This is used as a keepalive, and to keep track of which client is connected
 // to which host.
@@ -447,6 +479,123 @@ func (s *badgerStore) UpdateNodePeers(nodeID store.NodeID, peers []string, block
 	return
 }
 
+// GetHostReputation returns the host's reputation, which is empty if nothing
+// was recorded for the host.
+func (s *badgerStore) GetHostReputation(nodeID store.NodeID) (store.HostReputation, error) {
+	reputationKey := []byte(fmt.Sprintf("vip:reputation:%s", nodeID))
+	var r store.HostReputation
+	err := s.db.View(func(txn *badger.Txn) error {
+		return getItem(txn, reputationKey, &r)
+	})
+	if err == badger.ErrKeyNotFound {
+		// Default to empty reputation
+		return r, nil
+	}
+	return r, err
+}
+
+// UpdateHostReputation atomically applies fn to the host's reputation and
+// saves the result, unless fn returns an error.
+func (s *badgerStore) UpdateHostReputation(nodeID store.NodeID, fn func(*store.HostReputation) error) error {
+	reputationKey := []byte(fmt.Sprintf("vip:reputation:%s", nodeID))
+	return s.db.Update(func(txn *badger.Txn) error {
+		var r store.HostReputation
+		if err := getItem(txn, reputationKey, &r); err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err := fn(&r); err != nil {
+			return err
+		}
+		return setItem(txn, reputationKey, &r)
+	})
+}
+
+func accessKey(list store.AccessList, target string) []byte {
+	return []byte(fmt.Sprintf("vip:access:%s:%s", list, target))
+}
+
+// AddAccessEntry adds the entry to the list, replacing any entry with the
+// same target. Expiring entries are saved with a TTL.
+func (s *badgerStore) AddAccessEntry(list store.AccessList, entry store.AccessEntry) error {
+	key := accessKey(list, entry.Target)
+	return s.db.Update(func(txn *badger.Txn) error {
+		if entry.Expires.IsZero() {
+			return setItem(txn, key, &entry)
+		}
+		ttl := time.Until(entry.Expires)
+		if ttl <= 0 {
+			// Already expired, make sure an older entry does not linger
+			return txn.Delete(key)
+		}
+		return setExpiringItem(txn, key, &entry, ttl)
+	})
+}
+
+// RemoveAccessEntry removes the entry with the target from the list.
+func (s *badgerStore) RemoveAccessEntry(list store.AccessList, target string) error {
+	key := accessKey(list, target)
+	return s.db.Update(func(txn *badger.Txn) error {
+		if !hasKey(txn, key) {
+			return store.ErrAccessEntryNotFound
+		}
+		return txn.Delete(key)
+	})
+}
+
+// AccessEntries returns the unexpired entries of the list, sorted by target.
+func (s *badgerStore) AccessEntries(list store.AccessList) ([]store.AccessEntry, error) {
+	now := time.Now()
+	r := []store.AccessEntry{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		var entry store.AccessEntry
+		return loopItem(txn, []byte(fmt.Sprintf("vip:access:%s:", list)), &entry, func() error {
+			if !entry.Expired(now) {
+				r = append(r, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func webhookKey(id string) []byte {
+	return []byte(fmt.Sprintf("vip:webhook:%s", id))
+}
+
+// SaveWebhookDelivery adds the delivery to the queue, replacing any delivery
+// with the same ID.
+func (s *badgerStore) SaveWebhookDelivery(delivery store.WebhookDelivery) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return setItem(txn, webhookKey(delivery.ID), &delivery)
+	})
+}
+
+// RemoveWebhookDelivery removes the delivery with the ID from the queue.
+func (s *badgerStore) RemoveWebhookDelivery(id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(webhookKey(id))
+	})
+}
+
+// WebhookDeliveries returns the queued deliveries, sorted by ID.
+func (s *badgerStore) WebhookDeliveries() ([]store.WebhookDelivery, error) {
+	r := []store.WebhookDelivery{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		var delivery store.WebhookDelivery
+		return loopItem(txn, []byte("vip:webhook:"), &delivery, func() error {
+			r = append(r, delivery)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // Stats returns aggregate statistics about the store state.
 func (s *badgerStore) Stats() (*store.Stats, error) {
 	stats := store.Stats{}
@@ -13,3 +13,6 @@ var ErrMalformedNode = errors.New("malformed node")
 
 // ErrNotAuthorized is returned when a node is not an authorized spender of an account's balance.
 var ErrNotAuthorized = errors.New("node is not an authorized spender")
+
+// ErrAccessEntryNotFound is returned when removing an access list entry that does not exist.
+var ErrAccessEntryNotFound = errors.New("access list entry not found")
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,6 +18,10 @@ func New() *memoryStore {
 		accounts: map[store.NodeID]store.Account{},
 		trials:   map[store.NodeID]store.Balance{},
 		nonces:   map[string]int64{},
+
+		reputations: map[store.NodeID]store.HostReputation{},
+		access:      map[store.AccessList]map[string]store.AccessEntry{},
+		webhooks:    map[string]store.WebhookDelivery{},
 	}
 }
 
@@ -45,6 +50,14 @@ type memoryStore struct {
 	trials map[store.NodeID]store.Balance
 
 	nonces map[string]int64
+
+	// Host reputations
+	reputations map[store.NodeID]store.HostReputation
+
+	// Ban and allow lists, by target
+	access map[store.AccessList]map[string]store.AccessEntry
+	// Queued webhook deliveries by ID
+	webhooks map[string]store.WebhookDelivery
 }
 
 // CheckAndSaveNonce asserts that this is the highest nonce seen for this NodeID.
@@ -219,7 +232,6 @@ func (s *memoryStore) ActiveHosts(kind string, limit int) ([]store.Node, error)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	// TODO: Do something other than random, such as by availability?
 	for _, n := range s.nodes {
 		// Ranging over a map is implicitly random, so
 		// results are shuffled as is desireable.
@@ -243,6 +255,17 @@ func (s *memoryStore) ActiveHosts(kind string, limit int) ([]store.Node, error)
 	return r, nil
 }
 
+// AllNodes returns all registered nodes.
+func (s *memoryStore) AllNodes() ([]store.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := make([]store.Node, 0, len(s.nodes))
+	for _, n := range s.nodes {
+		r = append(r, n.Node)
+	}
+	return r, nil
+}
+
 // NodePeers returns a list of active connected peers that this pool knows
 // about for this NodeID.
 func (s *memoryStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
@@ -261,6 +284,33 @@ func (s *memoryStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
 	return peers, nil
 }
 
+// SetNodeSyncing sets the node's SyncTarget, which is 0 once the node is done
+// syncing.
+func (s *memoryStore) SetNodeSyncing(nodeID store.NodeID, syncTarget uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node, ok := s.nodes[nodeID]
+	if !ok {
+		return store.ErrUnregisteredNode
+	}
+	node.SyncTarget = syncTarget
+	s.nodes[nodeID] = node
+	return nil
+}
+
+// SetNodeCapacity sets the node's MaxClients, where 0 is unlimited.
+func (s *memoryStore) SetNodeCapacity(nodeID store.NodeID, maxClients int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node, ok := s.nodes[nodeID]
+	if !ok {
+		return store.ErrUnregisteredNode
+	}
+	node.MaxClients = maxClients
+	s.nodes[nodeID] = node
+	return nil
+}
+
 // UpdateNodePeers updates the Node.peers lookup with the current timestamp
 // of nodes we know about. This is used as a keepalive, and to keep track of
 // which client is connected to which host.
@@ -305,6 +355,27 @@ func (s *memoryStore) UpdateNodePeers(nodeID store.NodeID, peers []string, block
 	return
 }
 
+// GetHostReputation returns the host's reputation, which is empty if nothing
+// was recorded for the host.
+func (s *memoryStore) GetHostReputation(nodeID store.NodeID) (store.HostReputation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reputations[nodeID], nil
+}
+
+// UpdateHostReputation atomically applies fn to the host's reputation and
+// saves the result, unless fn returns an error.
+func (s *memoryStore) UpdateHostReputation(nodeID store.NodeID, fn func(*store.HostReputation) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.reputations[nodeID]
+	if err := fn(&r); err != nil {
+		return err
+	}
+	s.reputations[nodeID] = r
+	return nil
+}
+
 // Stats returns aggregate statistics about the store state.
 func (s *memoryStore) Stats() (*store.Stats, error) {
 	stats := store.Stats{}
@@ -327,3 +398,76 @@ func (s *memoryStore) Stats() (*store.Stats, error) {
 func (s *memoryStore) Close() error {
 	return nil
 }
+
+// AddAccessEntry adds the entry to the list, replacing any entry with the
+// same target.
+func (s *memoryStore) AddAccessEntry(list store.AccessList, entry store.AccessEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, ok := s.access[list]
+	if !ok {
+		entries = map[string]store.AccessEntry{}
+		s.access[list] = entries
+	}
+	entries[entry.Target] = entry
+	return nil
+}
+
+// RemoveAccessEntry removes the entry with the target from the list.
+func (s *memoryStore) RemoveAccessEntry(list store.AccessList, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.access[list][target]
+	if !ok || entry.Expired(time.Now()) {
+		return store.ErrAccessEntryNotFound
+	}
+	delete(s.access[list], target)
+	return nil
+}
+
+// AccessEntries returns the unexpired entries of the list, sorted by target.
+func (s *memoryStore) AccessEntries(list store.AccessList) ([]store.AccessEntry, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.access[list]
+	r := make([]store.AccessEntry, 0, len(entries))
+	for target, entry := range entries {
+		if entry.Expired(now) {
+			delete(entries, target)
+			continue
+		}
+		r = append(r, entry)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Target < r[j].Target })
+	return r, nil
+}
+
+// SaveWebhookDelivery adds the delivery to the queue, replacing any delivery
+// with the same ID.
+func (s *memoryStore) SaveWebhookDelivery(delivery store.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[delivery.ID] = delivery
+	return nil
+}
+
+// RemoveWebhookDelivery removes the delivery with the ID from the queue.
+func (s *memoryStore) RemoveWebhookDelivery(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.webhooks, id)
+	return nil
+}
+
+// WebhookDeliveries returns the queued deliveries, sorted by ID.
+func (s *memoryStore) WebhookDeliveries() ([]store.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := make([]store.WebhookDelivery, 0, len(s.webhooks))
+	for _, delivery := range s.webhooks {
+		r = append(r, delivery)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].ID < r[j].ID })
+	return r, nil
+}
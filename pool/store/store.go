@@ -3,9 +3,12 @@ package store
 import (
 	"fmt"
 	"math/big"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/vipnode/ether"
+	"github.com/vipnode/vipnode/v2/ethnode"
 )
 
 // KeepaliveInterval is the rate of when clients and hosts are expected to send
@@ -62,16 +65,117 @@ type Node struct {
 	Kind        string    `json:"kind"`
 	IsHost      bool
 	Payout      Account
-	BlockNumber uint64 `json:"block_number"`
+	BlockNumber uint64            `json:"block_number"`
+	SyncTarget  uint64            `json:"sync_target,omitempty"` // SyncTarget is the highest block that the node is importing the chain up to, if it's still syncing.
+	Network     ethnode.NetworkID `json:"network"`
+	Caps        []string          `json:"caps,omitempty"`       // Caps are the sub-protocols the node advertises, such as "eth/63" or "les/2".
+	Instance    string            `json:"instance,omitempty"`   // Instance is the pool instance that a host is connected to, when running multiple instances.
+	Federation  string            `json:"federation,omitempty"` // Federation is the address of the partner pool that the node belongs to, if it's not this pool's own node.
+
+	MaxClients     int       `json:"max_clients,omitempty"`     // MaxClients is the number of clients a host accepts, or 0 if unlimited.
+	ConnectedSince time.Time `json:"connected_since,omitempty"` // ConnectedSince is when the host's current connection to the pool was established.
 
 	NodeVersion    string `json:"node_version"`
 	VipnodeVersion string `json:"vipnode_version"`
 }
 
+// Syncing returns whether the node reported that it's still importing the
+// chain.
+func (n Node) Syncing() bool {
+	return n.SyncTarget > 0
+}
+
+// HostReputation is the record of failures attributed to a host, used to
+// deprioritize unreliable hosts.
+type HostReputation struct {
+	// Penalty is the sum of weighted failures, decayed as of Updated.
+	Penalty float64   `json:"penalty"`
+	Updated time.Time `json:"updated"`
+	// QuarantineUntil is when the host can be offered to nodes again, if it
+	// was quarantined for exceeding the penalty threshold.
+	QuarantineUntil time.Time `json:"quarantine_until"`
+
+	NumWhitelistFailures int `json:"num_whitelist_failures"`
+	NumWhitelistTimeouts int `json:"num_whitelist_timeouts"`
+	NumConnectFailures   int `json:"num_connect_failures"`
+	NumDisconnects       int `json:"num_disconnects"`
+	NumForks             int `json:"num_forks"`
+}
+
+// AccessList is the name of a list of AccessEntry rules.
+type AccessList string
+
+const (
+	// BanList entries are denied access to the pool.
+	BanList AccessList = "ban"
+	// AllowList entries are granted access to invite-only pools.
+	AllowList AccessList = "allow"
+)
+
+// AccessEntry is a rule of an AccessList. The Target is a node ID, a payout
+// account, an IP address, or an IP range in CIDR notation.
+type AccessEntry struct {
+	Target  string    `json:"target"`
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitempty"` // Expires is zero if the entry does not expire.
+}
+
+// WebhookDelivery is a payload queued for delivery to a webhook endpoint. IDs
+// sort in the order that deliveries were queued.
+type WebhookDelivery struct {
+	ID          string    `json:"id"`
+	Endpoint    string    `json:"endpoint"`
+	Topic       string    `json:"topic"`
+	Payload     []byte    `json:"payload"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Expired returns whether the entry is expired as of now.
+func (e AccessEntry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// Matches returns whether the entry applies to the node ID, payout account,
+// or IP address. Empty values never match.
+func (e AccessEntry) Matches(nodeID NodeID, account Account, ip net.IP) bool {
+	if _, ipNet, err := net.ParseCIDR(e.Target); err == nil {
+		return ip != nil && ipNet.Contains(ip)
+	}
+	if targetIP := net.ParseIP(e.Target); targetIP != nil {
+		return ip != nil && targetIP.Equal(ip)
+	}
+	if e.Target == "" {
+		return false
+	}
+	if nodeID != "" && NodeID(e.Target) == nodeID {
+		return true
+	}
+	// Accounts are hex-encoded addresses, which can be checksum-cased.
+	return account != "" && strings.EqualFold(e.Target, string(account))
+}
+
+// NormalizeAccessTarget returns the canonical form of an AccessEntry target,
+// so that equivalent IP addresses and ranges are stored under the same
+// target.
+func NormalizeAccessTarget(target string) string {
+	target = strings.TrimSpace(target)
+	if _, ipNet, err := net.ParseCIDR(target); err == nil {
+		return ipNet.String()
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		return ip.String()
+	}
+	return target
+}
+
 // Stats contains various aggregate stats of the store state, used for
 // providing a dashboard.
 type Stats struct {
 	NumActiveHosts    int     `json:"num_active_hosts"`
+	NumSyncingHosts   int     `json:"num_syncing_hosts"` // NumSyncingHosts is the number of active hosts which are still importing the chain.
 	NumTotalHosts     int     `json:"num_total_hosts"`
 	NumActiveClients  int     `json:"num_active_clients"`
 	NumTotalClients   int     `json:"num_total_clients"`
@@ -80,9 +184,43 @@ type Stats struct {
 	TotalDeposit      big.Int `json:"total_deposit"`
 	NumTrialBalances  int     `json:"num_trial_balances"`
 
+	// Networks contains the node stats of each network, by network ID.
+	Networks map[ethnode.NetworkID]*NetworkStats `json:"networks,omitempty"`
+
 	activeSince time.Time
 }
 
+// NetworkStats contains the aggregate node stats of a single network.
+type NetworkStats struct {
+	Name              string `json:"name"` // Name of the network for display, "unknown" for custom networks
+	NumActiveHosts    int    `json:"num_active_hosts"`
+	NumSyncingHosts   int    `json:"num_syncing_hosts"`
+	NumTotalHosts     int    `json:"num_total_hosts"`
+	NumActiveClients  int    `json:"num_active_clients"`
+	NumTotalClients   int    `json:"num_total_clients"`
+	LatestBlockNumber uint64 `json:"latest_block_number"`
+}
+
+func (stats *NetworkStats) countNode(n Node, isActive bool) {
+	if n.IsHost {
+		stats.NumTotalHosts += 1
+		if isActive {
+			stats.NumActiveHosts += 1
+			if n.Syncing() {
+				stats.NumSyncingHosts += 1
+			}
+		}
+	} else {
+		stats.NumTotalClients += 1
+		if isActive {
+			stats.NumActiveClients += 1
+		}
+	}
+	if n.BlockNumber > stats.LatestBlockNumber {
+		stats.LatestBlockNumber = n.BlockNumber
+	}
+}
+
 // CountNode is a helper for aggregating node-related stats. It is not
 // goroutine-safe.
 func (stats *Stats) CountNode(n Node) {
@@ -94,6 +232,9 @@ func (stats *Stats) CountNode(n Node) {
 		stats.NumTotalHosts += 1
 		if isActive {
 			stats.NumActiveHosts += 1
+			if n.Syncing() {
+				stats.NumSyncingHosts += 1
+			}
 		}
 	} else {
 		stats.NumTotalClients += 1
@@ -104,6 +245,16 @@ func (stats *Stats) CountNode(n Node) {
 	if n.BlockNumber > stats.LatestBlockNumber {
 		stats.LatestBlockNumber = n.BlockNumber
 	}
+
+	if stats.Networks == nil {
+		stats.Networks = map[ethnode.NetworkID]*NetworkStats{}
+	}
+	networkStats, ok := stats.Networks[n.Network]
+	if !ok {
+		networkStats = &NetworkStats{Name: n.Network.String()}
+		stats.Networks[n.Network] = networkStats
+	}
+	networkStats.countNode(n, isActive)
 }
 
 // CountBalance is a helper for aggregating balance-related stats. It is not
@@ -121,6 +272,9 @@ type Store interface {
 	NonceStore
 	PoolStore
 	AccountStore
+	ReputationStore
+	AccessStore
+	WebhookStore
 
 	// Stats returns aggregate statistics about the store state.
 	Stats() (*Stats, error)
@@ -155,6 +309,47 @@ type PoolStore interface {
 	// from the known peers and returned. It also updates nodeID's
 	// LastSeen.
 	UpdateNodePeers(nodeID NodeID, peers []string, blockNumber uint64) (inactive []NodeID, err error)
+	// SetNodeSyncing sets the node's SyncTarget, which is 0 once the node is
+	// done syncing. It doesn't change the node's peers or LastSeen.
+	SetNodeSyncing(nodeID NodeID, syncTarget uint64) error
+	// SetNodeCapacity sets the node's MaxClients, where 0 is unlimited. It
+	// doesn't change the node's peers or LastSeen.
+	SetNodeCapacity(nodeID NodeID, maxClients int) error
+}
+
+// ReputationStore persists the reputation of hosts.
+type ReputationStore interface {
+	// GetHostReputation returns the host's reputation, which is empty if
+	// nothing was recorded for the host.
+	GetHostReputation(nodeID NodeID) (HostReputation, error)
+	// UpdateHostReputation atomically applies fn to the host's reputation and
+	// saves the result, unless fn returns an error.
+	UpdateHostReputation(nodeID NodeID, fn func(*HostReputation) error) error
+}
+
+// AccessStore persists the ban and allow lists.
+type AccessStore interface {
+	// AddAccessEntry adds the entry to the list, replacing any entry with the
+	// same target.
+	AddAccessEntry(list AccessList, entry AccessEntry) error
+	// RemoveAccessEntry removes the entry with the target from the list, or
+	// returns ErrAccessEntryNotFound.
+	RemoveAccessEntry(list AccessList, target string) error
+	// AccessEntries returns the unexpired entries of the list.
+	AccessEntries(list AccessList) ([]AccessEntry, error)
+}
+
+// WebhookStore persists the queue of webhook deliveries, so that undelivered
+// payloads survive restarts.
+type WebhookStore interface {
+	// SaveWebhookDelivery adds the delivery to the queue, replacing any
+	// delivery with the same ID.
+	SaveWebhookDelivery(delivery WebhookDelivery) error
+	// RemoveWebhookDelivery removes the delivery with the ID from the queue,
+	// if it's queued.
+	RemoveWebhookDelivery(id string) error
+	// WebhookDeliveries returns the queued deliveries, sorted by ID.
+	WebhookDeliveries() ([]WebhookDelivery, error)
 }
 
 // AccountStore manages the accounts associated with nodes and their balances.
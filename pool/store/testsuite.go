@@ -7,6 +7,8 @@ import (
 	"sort"
 	"testing"
 	"time"
+
+	"github.com/vipnode/vipnode/v2/ethnode"
 )
 
 // TestSuite runs a suite of tests against a store implementation.
@@ -125,6 +127,9 @@ func TestSuite(t *testing.T, newStore func() Store) {
 			NumTotalClients:  1,
 			TotalCredit:      *big.NewInt(-5),
 			NumTrialBalances: 1,
+			Networks: map[ethnode.NetworkID]*NetworkStats{
+				ethnode.UnknownNetwork: {Name: "unknown", NumTotalClients: 1},
+			},
 		}
 		wantStats.activeSince = gotStats.activeSince
 		if !reflect.DeepEqual(gotStats, wantStats) {
@@ -213,6 +218,50 @@ func TestSuite(t *testing.T, newStore func() Store) {
 				t.Errorf("wrong active peers:\n got: %s\nwant: %s", peerIDs, active.IDs())
 			}
 		}
+
+		// Syncing doesn't affect peers
+		if err := s.SetNodeSyncing(nodes[9].ID, 100); err != ErrUnregisteredNode {
+			t.Errorf("expected unregistered error, got: %s", err)
+		}
+		if err := s.SetNodeSyncing(node.ID, 100); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if n, err := s.GetNode(node.ID); err != nil {
+			t.Errorf("unexpected GetNode error: %s", err)
+		} else if !n.Syncing() || n.SyncTarget != 100 || n.BlockNumber != blockNumber {
+			t.Errorf("wrong syncing node: %+v", n)
+		}
+		if peers, err := s.NodePeers(node.ID); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if peerIDs := Nodes(peers).IDs(); !reflect.DeepEqual(peerIDs, active.IDs()) {
+			t.Errorf("wrong active peers after syncing:\n got: %s\nwant: %s", peerIDs, active.IDs())
+		}
+		if err := s.SetNodeSyncing(node.ID, 0); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if n, err := s.GetNode(node.ID); err != nil {
+			t.Errorf("unexpected GetNode error: %s", err)
+		} else if n.Syncing() {
+			t.Errorf("node is still syncing: %+v", n)
+		}
+
+		// Capacity doesn't affect peers
+		if err := s.SetNodeCapacity(nodes[9].ID, 5); err != ErrUnregisteredNode {
+			t.Errorf("expected unregistered error, got: %s", err)
+		}
+		if err := s.SetNodeCapacity(node.ID, 5); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if n, err := s.GetNode(node.ID); err != nil {
+			t.Errorf("unexpected GetNode error: %s", err)
+		} else if n.MaxClients != 5 || n.BlockNumber != blockNumber {
+			t.Errorf("wrong node capacity: %+v", n)
+		}
+		if peers, err := s.NodePeers(node.ID); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if peerIDs := Nodes(peers).IDs(); !reflect.DeepEqual(peerIDs, active.IDs()) {
+			t.Errorf("wrong active peers after capacity change:\n got: %s\nwant: %s", peerIDs, active.IDs())
+		}
 	})
 
 	t.Run("Node", func(t *testing.T) {
@@ -233,10 +282,18 @@ func TestSuite(t *testing.T, newStore func() Store) {
 				ID:          node.ID,
 				IsHost:      i%2 == 0, // Half hosts, interlaced to check for insertion order bugs
 				BlockNumber: uint64(100 + i),
+				Network:     ethnode.Mainnet,
+			}
+			if i >= 8 {
+				node.Network = ethnode.Goerli
 			}
 			if i > 5 {
 				node.LastSeen = now
 			}
+			if i == 6 || i == 4 {
+				// Only active hosts are counted as syncing
+				node.SyncTarget = 200
+			}
 			if err := s.SetNode(node); err != nil {
 				t.Error(err)
 			}
@@ -250,6 +307,12 @@ func TestSuite(t *testing.T, newStore func() Store) {
 			t.Errorf("got: %v; want: %v", got, want)
 		}
 
+		if n, err := s.GetNode(nodes[8].ID); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if n.Network != ethnode.Goerli {
+			t.Errorf("wrong network: %s", n.Network)
+		}
+
 		if hosts, err := s.ActiveHosts("", 1); err != nil {
 			t.Errorf("unexpected error: %s", err)
 		} else if len(hosts) != 1 {
@@ -265,9 +328,14 @@ func TestSuite(t *testing.T, newStore func() Store) {
 		wantStats := &Stats{
 			NumTotalHosts:     5,
 			NumActiveHosts:    2,
+			NumSyncingHosts:   1,
 			NumTotalClients:   5,
 			NumActiveClients:  2,
 			LatestBlockNumber: 109,
+			Networks: map[ethnode.NetworkID]*NetworkStats{
+				ethnode.Mainnet: {Name: "mainnet", NumTotalHosts: 4, NumActiveHosts: 1, NumSyncingHosts: 1, NumTotalClients: 4, NumActiveClients: 1, LatestBlockNumber: 107},
+				ethnode.Goerli:  {Name: "goerli", NumTotalHosts: 1, NumActiveHosts: 1, NumTotalClients: 1, NumActiveClients: 1, LatestBlockNumber: 109},
+			},
 		}
 		wantStats.activeSince = gotStats.activeSince
 		if !reflect.DeepEqual(gotStats, wantStats) {
@@ -275,6 +343,35 @@ func TestSuite(t *testing.T, newStore func() Store) {
 		}
 	})
 
+	t.Run("CustomNetworkStats", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		nodes := makeNodes(0, 2)
+		for i, node := range nodes {
+			node.IsHost = true
+			node.Network = ethnode.NetworkID(1337 + i)
+			node.BlockNumber = uint64(100 * (i + 1))
+			if err := s.SetNode(node); err != nil {
+				t.Error(err)
+			}
+		}
+
+		stats, err := s.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Custom networks share a name but not their stats
+		for i, want := range []uint64{100, 200} {
+			networkStats, ok := stats.Networks[ethnode.NetworkID(1337+i)]
+			if !ok {
+				t.Errorf("missing stats of network %d", 1337+i)
+			} else if networkStats.LatestBlockNumber != want || networkStats.NumTotalHosts != 1 {
+				t.Errorf("wrong stats of network %d: %+v", 1337+i, networkStats)
+			}
+		}
+	})
+
 	t.Run("Spender", func(t *testing.T) {
 		s := newStore()
 		defer s.Close()
@@ -375,6 +472,137 @@ func TestSuite(t *testing.T, newStore func() Store) {
 		}
 
 	})
+
+	t.Run("Reputation", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		node := makeNode(0)
+		if r, err := s.GetHostReputation(node.ID); err != nil {
+			t.Error(err)
+		} else if r != (HostReputation{}) {
+			t.Errorf("expected empty reputation: %+v", r)
+		}
+
+		updated := time.Now().Round(0)
+		if err := s.UpdateHostReputation(node.ID, func(r *HostReputation) error {
+			r.Penalty += 1.5
+			r.Updated = updated
+			r.NumWhitelistFailures += 1
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+
+		// Failed updates are not saved
+		errAbort := fmt.Errorf("abort")
+		if err := s.UpdateHostReputation(node.ID, func(r *HostReputation) error {
+			r.Penalty += 100
+			return errAbort
+		}); err != errAbort {
+			t.Errorf("expected abort error, got: %s", err)
+		}
+
+		if r, err := s.GetHostReputation(node.ID); err != nil {
+			t.Error(err)
+		} else if r.Penalty != 1.5 || r.NumWhitelistFailures != 1 || !r.Updated.Equal(updated) {
+			t.Errorf("invalid reputation: %+v", r)
+		}
+	})
+
+	t.Run("AccessLists", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		now := time.Now().Round(0)
+		entries := []AccessEntry{
+			{Target: "10.0.0.0/8", Reason: "abuse", Created: now},
+			{Target: "foo", Created: now, Expires: now.Add(time.Hour)},
+		}
+		for _, entry := range entries {
+			if err := s.AddAccessEntry(BanList, entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Expired entries are not returned
+		if err := s.AddAccessEntry(BanList, AccessEntry{Target: "bar", Created: now, Expires: now.Add(-time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddAccessEntry(AllowList, AccessEntry{Target: "baz", Created: now}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.AccessEntries(BanList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(entries) {
+			t.Fatalf("wrong number of ban entries: %+v", got)
+		}
+		for i := range got {
+			if got[i].Target != entries[i].Target || got[i].Reason != entries[i].Reason || !got[i].Expires.Equal(entries[i].Expires) {
+				t.Errorf("entry #%d: got %+v; want %+v", i, got[i], entries[i])
+			}
+		}
+
+		if err := s.RemoveAccessEntry(BanList, "foo"); err != nil {
+			t.Error(err)
+		}
+		if err := s.RemoveAccessEntry(BanList, "foo"); err != ErrAccessEntryNotFound {
+			t.Errorf("expected ErrAccessEntryNotFound, got: %v", err)
+		}
+		if got, err := s.AccessEntries(AllowList); err != nil {
+			t.Error(err)
+		} else if len(got) != 1 || got[0].Target != "baz" {
+			t.Errorf("wrong allow entries: %+v", got)
+		}
+	})
+
+	t.Run("WebhookDeliveries", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		next := time.Now().Round(0)
+		for _, delivery := range []WebhookDelivery{
+			{ID: "2", Endpoint: "https://example.com/b", Payload: []byte(`{"b":2}`)},
+			{ID: "1", Endpoint: "https://example.com/a", Payload: []byte(`{"a":1}`), LastError: "timeout"},
+		} {
+			if err := s.SaveWebhookDelivery(delivery); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Retries replace the delivery
+		retry := WebhookDelivery{ID: "2", Endpoint: "https://example.com/b", Payload: []byte(`{"b":2}`), Attempts: 1, NextAttempt: next}
+		if err := s.SaveWebhookDelivery(retry); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.WebhookDeliveries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].ID != "1" || got[1].ID != "2" {
+			t.Fatalf("wrong deliveries: %+v", got)
+		}
+		if got[0].LastError != "timeout" || string(got[0].Payload) != `{"a":1}` {
+			t.Errorf("wrong delivery: %+v", got[0])
+		}
+		if got[1].Attempts != 1 || !got[1].NextAttempt.Equal(next) || got[1].LastError != "" {
+			t.Errorf("wrong retried delivery: %+v", got[1])
+		}
+
+		if err := s.RemoveWebhookDelivery("1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RemoveWebhookDelivery("1"); err != nil {
+			t.Errorf("removing a missing delivery failed: %s", err)
+		}
+		if got, err := s.WebhookDeliveries(); err != nil {
+			t.Error(err)
+		} else if len(got) != 1 || got[0].ID != "2" {
+			t.Errorf("wrong deliveries after remove: %+v", got)
+		}
+	})
 }
 
 type Nodes []Node
@@ -0,0 +1,392 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/pool/store"
+)
+
+const (
+	// WebhookEventHeader is the HTTP header with the topic of the posted event.
+	WebhookEventHeader = "X-Vipnode-Event"
+	// WebhookDeliveryHeader is the HTTP header with the ID of the delivery,
+	// which is the same for every attempt.
+	WebhookDeliveryHeader = "X-Vipnode-Delivery"
+	// WebhookTimestampHeader is the HTTP header with the unix time in seconds
+	// that the delivery attempt was signed at.
+	WebhookTimestampHeader = "X-Vipnode-Timestamp"
+	// WebhookSignatureHeader is the HTTP header with the WebhookSignature of
+	// the delivery.
+	WebhookSignatureHeader = "X-Vipnode-Signature"
+)
+
+// ErrWebhookSignature is returned by VerifyWebhook when a delivery is not
+// signed with the webhook secret.
+var ErrWebhookSignature = errors.New("invalid webhook signature")
+
+// WebhookSignature returns the signature of a webhook delivery, which is
+// "sha256=" followed by the hex-encoded HMAC-SHA256 keyed with the secret of:
+// the timestamp, a newline, the delivery ID, a newline, and the payload.
+// Signing the delivery ID and timestamp lets receivers reject replayed
+// deliveries, see VerifyWebhook.
+func WebhookSignature(secret string, deliveryID string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n", timestamp, deliveryID)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks that a received delivery is signed with the secret, and
+// that it was signed within maxAge of now, such as 5 minutes, allowing for the
+// same clock drift in the future. A captured delivery can still be replayed
+// until it's stale, so receivers should also remember the delivery IDs that
+// they processed for at least maxAge and ignore repeats of them. Failed
+// attempts are retried with the same delivery ID and a new timestamp.
+func VerifyWebhook(secret string, header http.Header, payload []byte, maxAge time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return ErrWebhookSignature
+	}
+	sig := WebhookSignature(secret, header.Get(WebhookDeliveryHeader), timestamp, payload)
+	if !hmac.Equal([]byte(header.Get(WebhookSignatureHeader)), []byte(sig)) {
+		return ErrWebhookSignature
+	}
+	now := time.Now()
+	signed := time.Unix(timestamp, 0)
+	if signed.Before(now.Add(-maxAge)) || signed.After(now.Add(maxAge)) {
+		return fmt.Errorf("stale webhook delivery signed at %s", signed)
+	}
+	return nil
+}
+
+// WebhookEndpoint is a URL that pool events are posted to.
+type WebhookEndpoint struct {
+	URL string
+	// Topics are the events that are posted, or all events if empty.
+	Topics []string
+}
+
+// NewWebhooks returns a Webhooks dispatcher which queues deliveries in the
+// store and signs their payloads with the secret.
+func NewWebhooks(queue store.WebhookStore, secret string, endpoints []WebhookEndpoint) (*Webhooks, error) {
+	w := &Webhooks{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 10,
+		MinBackoff:  10 * time.Second,
+		MaxBackoff:  time.Hour,
+
+		queue:     queue,
+		secret:    secret,
+		endpoints: make(map[string]map[EventTopic]struct{}, len(endpoints)),
+		wake:      make(chan struct{}, 1),
+	}
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("webhook endpoint must be an http or https URL: %q", endpoint.URL)
+		}
+		topics, err := parseTopics(endpoint.Topics)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := w.endpoints[endpoint.URL]; ok {
+			return nil, fmt.Errorf("duplicate webhook endpoint: %q", endpoint.URL)
+		}
+		w.endpoints[endpoint.URL] = topics
+		w.order = append(w.order, endpoint.URL)
+	}
+	return w, nil
+}
+
+// Webhooks posts pool events to HTTP endpoints. Deliveries are queued in the
+// store, so that they're resumed after a restart, and failed deliveries are
+// retried with exponential backoff.
+//
+// Webhooks implements jsonrpc2.Notifier, so that it can be subscribed to
+// Events like a websocket remote.
+type Webhooks struct {
+	// Client is used to post payloads.
+	Client *http.Client
+	// MaxAttempts is the number of attempts before a delivery is dropped.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, which doubles for each
+	// following retry up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	queue     store.WebhookStore
+	secret    string
+	endpoints map[string]map[EventTopic]struct{}
+	order     []string // Endpoint URLs in the order they were added
+	wake      chan struct{}
+
+	mu     sync.Mutex
+	lastID int64
+}
+
+// nextID returns a delivery ID which sorts after every previous ID, including
+// those from before a restart.
+func (w *Webhooks) nextID() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := time.Now().UnixNano()
+	if id <= w.lastID {
+		id = w.lastID + 1
+	}
+	w.lastID = id
+	return fmt.Sprintf("%019d", id)
+}
+
+// Notify queues a pool_event for delivery. It never fails, so that Events
+// doesn't unsubscribe the webhooks; queueing errors are logged instead.
+func (w *Webhooks) Notify(ctx context.Context, method string, params ...interface{}) error {
+	if method != "pool_event" || len(params) != 1 {
+		logger.Printf("Ignoring unsupported webhook notification: %s", method)
+		return nil
+	}
+	event, ok := params[0].(Event)
+	if !ok {
+		logger.Printf("Ignoring webhook notification with unsupported params: %T", params[0])
+		return nil
+	}
+	if err := w.Enqueue(event); err != nil {
+		logger.Printf("Failed to queue webhook delivery of %s event: %s", event.Topic, err)
+	}
+	return nil
+}
+
+// Enqueue queues the event for delivery to every endpoint that wants its
+// topic.
+func (w *Webhooks) Enqueue(event Event) error {
+	var payload []byte
+	for _, endpoint := range w.order {
+		if _, ok := w.endpoints[endpoint][event.Topic]; !ok {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		delivery := store.WebhookDelivery{
+			ID:          w.nextID(),
+			Endpoint:    endpoint,
+			Topic:       string(event.Topic),
+			Payload:     payload,
+			NextAttempt: time.Now(),
+		}
+		if err := w.queue.SaveWebhookDelivery(delivery); err != nil {
+			return err
+		}
+	}
+	if payload != nil {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run delivers queued payloads until the context is cancelled.
+func (w *Webhooks) Run(ctx context.Context) error {
+	for {
+		next, err := w.deliverDue(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.Printf("Failed to process webhook queue: %s", err)
+			next = time.Now().Add(w.MinBackoff)
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-w.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// deliverDue attempts the deliveries that are due, and returns when the next
+// queued delivery is due, or zero if the queue is empty. Endpoints are
+// delivered to concurrently, so that a slow or unreachable endpoint doesn't
+// delay the others.
+func (w *Webhooks) deliverDue(ctx context.Context) (next time.Time, err error) {
+	deliveries, err := w.queue.WebhookDeliveries()
+	if err != nil {
+		return next, err
+	}
+	schedule := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	now := time.Now()
+	due := map[string][]store.WebhookDelivery{}
+	for _, delivery := range deliveries {
+		if delivery.NextAttempt.After(now) {
+			schedule(delivery.NextAttempt)
+			continue
+		}
+		if _, ok := w.endpoints[delivery.Endpoint]; !ok {
+			logger.Printf("Dropping webhook delivery %s to endpoint that is no longer configured: %s", delivery.ID, delivery.Endpoint)
+			if err := w.queue.RemoveWebhookDelivery(delivery.ID); err != nil {
+				return next, err
+			}
+			continue
+		}
+		due[delivery.Endpoint] = append(due[delivery.Endpoint], delivery)
+	}
+
+	type result struct {
+		next time.Time
+		err  error
+	}
+	results := make(chan result, len(due))
+	for _, queued := range due {
+		go func(queued []store.WebhookDelivery) {
+			next, err := w.deliverEndpoint(ctx, queued)
+			results <- result{next, err}
+		}(queued)
+	}
+	for range due {
+		r := <-results
+		if !r.next.IsZero() {
+			schedule(r.next)
+		}
+		if r.err != nil && err == nil {
+			err = r.err
+		}
+	}
+	if ctx.Err() != nil {
+		return next, ctx.Err()
+	}
+	return next, err
+}
+
+// deliverEndpoint attempts the due deliveries to a single endpoint, in order.
+// Once a delivery fails, the endpoint's remaining deliveries are postponed
+// until its retry so that they stay in order. It returns when the endpoint's
+// next delivery is due, or zero if none are left.
+func (w *Webhooks) deliverEndpoint(ctx context.Context, deliveries []store.WebhookDelivery) (time.Time, error) {
+	for i, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return time.Time{}, ctx.Err()
+		}
+		deliverErr := w.deliver(ctx, delivery)
+		if deliverErr == nil {
+			if err := w.queue.RemoveWebhookDelivery(delivery.ID); err != nil {
+				return time.Time{}, err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// Shutting down, try again after restarting
+			return time.Time{}, ctx.Err()
+		}
+
+		var retry time.Time
+		delivery.Attempts += 1
+		delivery.LastError = deliverErr.Error()
+		if delivery.Attempts >= w.MaxAttempts {
+			logger.Printf("Dropping webhook delivery %s of %s event to %s after %d attempts: %s", delivery.ID, delivery.Topic, delivery.Endpoint, delivery.Attempts, deliverErr)
+			if err := w.queue.RemoveWebhookDelivery(delivery.ID); err != nil {
+				return time.Time{}, err
+			}
+			retry = time.Now().Add(w.MinBackoff)
+		} else {
+			delivery.NextAttempt = time.Now().Add(w.backoff(delivery.Attempts))
+			logger.Printf("Webhook delivery %s to %s failed, retrying at %s: %s", delivery.ID, delivery.Endpoint, delivery.NextAttempt.Format(time.RFC3339), deliverErr)
+			if err := w.queue.SaveWebhookDelivery(delivery); err != nil {
+				return time.Time{}, err
+			}
+			retry = delivery.NextAttempt
+		}
+
+		remaining := deliveries[i+1:]
+		if len(remaining) == 0 {
+			if delivery.Attempts >= w.MaxAttempts {
+				return time.Time{}, nil
+			}
+			return retry, nil
+		}
+		for _, postponed := range remaining {
+			postponed.NextAttempt = retry
+			if err := w.queue.SaveWebhookDelivery(postponed); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return retry, nil
+	}
+	return time.Time{}, nil
+}
+
+// backoff returns the delay before retrying a delivery that failed attempts
+// times.
+func (w *Webhooks) backoff(attempts int) time.Duration {
+	delay := w.MinBackoff
+	for i := 1; i < attempts && delay < w.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.MaxBackoff {
+		delay = w.MaxBackoff
+	}
+	return delay
+}
+
+// deliver posts the delivery's payload to its endpoint.
+func (w *Webhooks) deliver(ctx context.Context, delivery store.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.Endpoint, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.Topic)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	if w.secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(WebhookSignatureHeader, WebhookSignature(w.secret, delivery.ID, timestamp, delivery.Payload))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain some of the body so that the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint responded with status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/v2/pool/store/memory"
+)
+
+type webhookReceiver struct {
+	secret string
+	fail   int // Number of requests to fail before accepting
+
+	mu       sync.Mutex
+	received chan Event
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := VerifyWebhook(r.secret, req.Header, body, time.Minute); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	r.mu.Lock()
+	fail := r.fail > 0
+	r.fail -= 1
+	r.mu.Unlock()
+	if fail {
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+		return
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if got := req.Header.Get(WebhookEventHeader); got != string(event.Topic) {
+		http.Error(w, "wrong event header: "+got, http.StatusBadRequest)
+		return
+	}
+	r.received <- event
+}
+
+func (r *webhookReceiver) next(t *testing.T) Event {
+	t.Helper()
+	select {
+	case event := <-r.received:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+	}
+	return Event{}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"topic":"low_balance"}`)
+	now := time.Now().Unix()
+	header := func(id string, timestamp int64, sig string) http.Header {
+		h := http.Header{}
+		h.Set(WebhookDeliveryHeader, id)
+		h.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+		h.Set(WebhookSignatureHeader, sig)
+		return h
+	}
+
+	if err := VerifyWebhook("hunter2", header("1", now, WebhookSignature("hunter2", "1", now, payload)), payload, time.Minute); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := VerifyWebhook("hunter2", header("2", now, WebhookSignature("hunter2", "1", now, payload)), payload, time.Minute); err != ErrWebhookSignature {
+		t.Errorf("expected ErrWebhookSignature for changed delivery ID, got: %v", err)
+	}
+	if err := VerifyWebhook("hunter2", header("1", now+1, WebhookSignature("hunter2", "1", now, payload)), payload, time.Minute); err != ErrWebhookSignature {
+		t.Errorf("expected ErrWebhookSignature for changed timestamp, got: %v", err)
+	}
+	if err := VerifyWebhook("hunter2", header("1", now, WebhookSignature("wrong", "1", now, payload)), payload, time.Minute); err != ErrWebhookSignature {
+		t.Errorf("expected ErrWebhookSignature for wrong secret, got: %v", err)
+	}
+	stale := now - 120
+	if err := VerifyWebhook("hunter2", header("1", stale, WebhookSignature("hunter2", "1", stale, payload)), payload, time.Minute); err == nil {
+		t.Error("expected error for stale delivery")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	receiver := &webhookReceiver{secret: "hunter2", fail: 2, received: make(chan Event, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	queue := memory.New()
+	endpoints := []WebhookEndpoint{{URL: server.URL, Topics: []string{"low_balance", "last_host_offline"}}}
+	webhooks, err := NewWebhooks(queue, "hunter2", endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks.MinBackoff = 10 * time.Millisecond
+
+	// Queued before running, such as before a restart
+	if err := webhooks.Notify(context.Background(), "pool_event", Event{Topic: EventNodeConnected, NodeID: "filtered"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := webhooks.Notify(context.Background(), "pool_event", Event{Topic: EventLowBalance, NodeID: "client"}); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, err := queue.WebhookDeliveries(); err != nil {
+		t.Fatal(err)
+	} else if len(deliveries) != 1 {
+		t.Fatalf("wrong number of queued deliveries: %d", len(deliveries))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- webhooks.Run(ctx) }()
+
+	// Delivered after retrying
+	if event := receiver.next(t); event.Topic != EventLowBalance || event.NodeID != "client" {
+		t.Errorf("wrong event: %+v", event)
+	}
+
+	// Delivered through a subscription to Events
+	events := NewEvents()
+	if err := events.Subscribe(webhooks, nil); err != nil {
+		t.Fatal(err)
+	}
+	events.Publish(Event{Topic: EventLastHostOffline, NodeID: "host"})
+	if event := receiver.next(t); event.Topic != EventLastHostOffline || event.NodeID != "host" {
+		t.Errorf("wrong event: %+v", event)
+	}
+
+	events.Unsubscribe(webhooks)
+
+	// Delivered payloads are removed from the queue
+	for i := 0; ; i++ {
+		deliveries, err := queue.WebhookDeliveries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 0 {
+			break
+		}
+		if i > 100 {
+			t.Fatalf("deliveries left in queue: %+v", deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected Run error: %v", err)
+	}
+}
+
+func TestWebhooksDrop(t *testing.T) {
+	// Receiver with the wrong secret rejects every delivery
+	receiver := &webhookReceiver{secret: "wrong", received: make(chan Event, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	queue := memory.New()
+	webhooks, err := NewWebhooks(queue, "hunter2", []WebhookEndpoint{{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks.MaxAttempts = 2
+	webhooks.MinBackoff = time.Millisecond
+	if err := webhooks.Enqueue(Event{Topic: EventSettleFailed}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	next, err := webhooks.deliverDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := queue.WebhookDeliveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].LastError == "" {
+		t.Fatalf("wrong deliveries after failure: %+v", deliveries)
+	}
+	if !next.Equal(deliveries[0].NextAttempt) {
+		t.Errorf("wrong next delivery time: %s", next)
+	}
+
+	time.Sleep(time.Until(next))
+	if _, err := webhooks.deliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, err := queue.WebhookDeliveries(); err != nil {
+		t.Fatal(err)
+	} else if len(deliveries) != 0 {
+		t.Errorf("delivery was not dropped after max attempts: %+v", deliveries)
+	}
+
+	if _, err := NewWebhooks(queue, "", []WebhookEndpoint{{URL: "ftp://example.com"}}); err == nil {
+		t.Error("expected error for non-http endpoint")
+	}
+	if _, err := NewWebhooks(queue, "", []WebhookEndpoint{{URL: server.URL, Topics: []string{"foo"}}}); err == nil {
+		t.Error("expected error for unknown topic")
+	}
+}
+
+func TestWebhooksConcurrentEndpoints(t *testing.T) {
+	// Endpoint that doesn't respond until the test is done
+	release := make(chan struct{})
+	stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer stuck.Close()
+	defer close(release)
+
+	receiver := &webhookReceiver{secret: "hunter2", received: make(chan Event, 10)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks, err := NewWebhooks(memory.New(), "hunter2", []WebhookEndpoint{{URL: stuck.URL}, {URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nodeID := range []string{"first", "second"} {
+		if err := webhooks.Enqueue(Event{Topic: EventLowBalance, NodeID: nodeID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- webhooks.Run(ctx) }()
+
+	// Delivered in order while the other endpoint is stuck
+	for _, want := range []string{"first", "second"} {
+		if event := receiver.next(t); event.NodeID != want {
+			t.Errorf("wrong event: %+v; want node %q", event, want)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected Run error: %v", err)
+	}
+}
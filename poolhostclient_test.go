@@ -170,6 +170,77 @@ func TestCloseHost(t *testing.T) {
 	h.Wait()
 }
 
+func TestReconnectHost(t *testing.T) {
+	privkey := keygen.HardcodedKeyIdx(t, 0)
+
+	p := pool.New(memory.New(), nil)
+	poolConns := make(chan net.Conn, 2)
+	dial := func(ctx context.Context) (jsonrpc2.Codec, error) {
+		c1, c2 := net.Pipe()
+		rpcPool2Host := &jsonrpc2.Remote{
+			Codec:  jsonrpc2.IOCodec(c1),
+			Client: &jsonrpc2.Client{},
+			Server: &jsonrpc2.Server{},
+		}
+		if err := rpcPool2Host.Server.Register("vipnode_", p); err != nil {
+			return nil, err
+		}
+		go func() {
+			rpcPool2Host.Serve()
+			p.CloseRemote(rpcPool2Host)
+		}()
+		poolConns <- c1
+		return jsonrpc2.IOCodec(c2), nil
+	}
+
+	hostNodeID := discv5.PubkeyID(&privkey.PublicKey).String()
+	h := agent.Agent{
+		EthNode: fakenode.Node(hostNodeID),
+		NodeURI: fmt.Sprintf("enode://%s@127.0.0.1:30303", hostNodeID),
+	}
+	reconnected := make(chan error, 1)
+	rpcHost2Pool := &jsonrpc2.ReconnectingRemote{
+		Dial:       dial,
+		Server:     &jsonrpc2.Server{},
+		MinBackoff: time.Millisecond,
+		OnReconnect: func() {
+			reconnected <- h.Reconnect(context.Background())
+		},
+	}
+	defer rpcHost2Pool.Close()
+	if err := rpcHost2Pool.Server.(*jsonrpc2.Server).RegisterMethod("vipnode_whitelist", &h, "Whitelist"); err != nil {
+		t.Fatalf("failed to register vipnode_ rpc for host: %s", err)
+	}
+	if err := rpcHost2Pool.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	go rpcHost2Pool.Serve()
+
+	if err := h.Start(pool.Remote(rpcHost2Pool, privkey)); err != nil {
+		t.Fatalf("failed to start host: %s", err)
+	}
+	defer h.Stop()
+
+	if got, want := p.NumRemotes(), 1; got != want {
+		t.Errorf("wrong number of remotes: got %d; want %d", got, want)
+	}
+
+	// Drop the connection on the pool's side
+	(<-poolConns).Close()
+
+	select {
+	case err := <-reconnected:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the host to reconnect")
+	}
+	if got, want := p.NumRemotes(), 1; got != want {
+		t.Errorf("wrong number of remotes after reconnect: got %d; want %d", got, want)
+	}
+}
+
 func TestPoolHostConnectPeers(t *testing.T) {
 	hostKeys := []*ecdsa.PrivateKey{}
 	clientKeys := []*ecdsa.PrivateKey{}
@@ -341,3 +412,142 @@ func TestPoolHostConnectPeers(t *testing.T) {
 		t.Errorf("wrong number of remotes: got %d; want %d", got, want)
 	}
 }
+
+func TestPoolCluster(t *testing.T) {
+	// Several pool instances share one store, with hosts and clients
+	// connected to different instances.
+	poolStore := memory.New()
+	instances := []string{"pool1", "pool2", "pool3"}
+	pools := map[string]*pool.VipnodePool{}
+	for _, id := range instances {
+		p := pool.New(poolStore, nil)
+		p.Cluster = pool.NewCluster(id, "secret")
+		pools[id] = p
+	}
+	for id, p := range pools {
+		for peerID, peer := range pools {
+			if peerID == id {
+				continue
+			}
+			service := &jsonrpc2.Local{}
+			if err := service.Server.Register("cluster_", &pool.ClusterService{Pool: peer}); err != nil {
+				t.Fatal(err)
+			}
+			p.Cluster.AddPeer(peerID, service)
+		}
+	}
+
+	hosts1, err := fakecluster.New(pools["pool1"], []*ecdsa.PrivateKey{keygen.HardcodedKeyIdx(t, 0)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hosts1.Close()
+	hosts2, err := fakecluster.New(pools["pool2"], []*ecdsa.PrivateKey{keygen.HardcodedKeyIdx(t, 1)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hosts2.Close()
+
+	// The client's instance has no hosts of its own, so both whitelist
+	// requests are relayed.
+	clients, err := fakecluster.New(pools["pool3"], nil, []*ecdsa.PrivateKey{keygen.HardcodedKeyIdx(t, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clients.Close()
+
+	if got := pools["pool3"].NumRemotes(); got != 0 {
+		t.Errorf("client instance has unexpected remotes: %d", got)
+	}
+
+	client := clients.Clients[0]
+	if peers, err := client.Node.Peers(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(peers), 2; got != want {
+		t.Errorf("client has wrong number of peers: got %d; want %d", got, want)
+	}
+	for _, host := range append(hosts1.Hosts, hosts2.Hosts...) {
+		if !host.Node.Calls.Has("AddTrustedPeer", client.Node.NodeID) {
+			t.Errorf("host missing relayed whitelist of client, got:\n%s", host.Node.Calls)
+		}
+		node, err := poolStore.GetNode(store.NodeID(host.Node.NodeID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node.Instance != "pool1" && node.Instance != "pool2" {
+			t.Errorf("wrong host instance: %q", node.Instance)
+		}
+	}
+}
+
+func TestPoolFederation(t *testing.T) {
+	// Two independent pools with their own stores, where the client's pool
+	// has no hosts and asks its partner.
+	storeA, storeB := memory.New(), memory.New()
+	poolA := pool.New(storeA, balance.PayPerInterval(storeA, time.Nanosecond*1, big.NewInt(10)))
+	poolB := pool.New(storeB, balance.PayPerInterval(storeB, time.Nanosecond*1, big.NewInt(10)))
+	poolA.Federation = pool.NewFederation(keygen.HardcodedKeyIdx(t, 10))
+	poolB.Federation = pool.NewFederation(keygen.HardcodedKeyIdx(t, 11))
+	for _, link := range []struct{ from, to *pool.VipnodePool }{{poolA, poolB}, {poolB, poolA}} {
+		service := &jsonrpc2.Local{}
+		if err := service.Server.Register("federation_", &pool.FederationService{Pool: link.to}); err != nil {
+			t.Fatal(err)
+		}
+		if err := link.from.Federation.AddPartner(link.to.Federation.Address, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hosts, err := fakecluster.New(poolB, []*ecdsa.PrivateKey{keygen.HardcodedKeyIdx(t, 0)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hosts.Close()
+	clients, err := fakecluster.New(poolA, nil, []*ecdsa.PrivateKey{keygen.HardcodedKeyIdx(t, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clients.Close()
+
+	host, client := hosts.Hosts[0], clients.Clients[0]
+	if peers, err := client.Node.Peers(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(peers), 1; got != want {
+		t.Errorf("client has wrong number of peers: got %d; want %d", got, want)
+	}
+	if !host.Node.Calls.Has("AddTrustedPeer", client.Node.NodeID) {
+		t.Errorf("partner host missing whitelist of client, got:\n%s", host.Node.Calls)
+	}
+
+	if err := client.UpdatePeers(context.Background(), client.RemotePool); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client paid its own pool, which owes the partner for the same usage.
+	owedByA, err := storeA.GetAccountBalance(store.Account(poolB.Federation.Address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owedToB, err := storeB.GetAccountBalance(store.Account(poolA.Federation.Address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owedByA.Credit.Sign() <= 0 || owedToB.Credit.Sign() >= 0 {
+		t.Errorf("unexpected federation balances: pool=%s partner=%s", owedByA.String(), owedToB.String())
+	}
+	hostBalance, err := storeB.GetNodeBalance(store.NodeID(host.Node.NodeID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostBalance.Credit.Sign() <= 0 {
+		t.Errorf("partner host was not credited: %s", hostBalance.String())
+	}
+
+	usage, err := poolA.FederationUsage(context.Background(), storeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[0].Remote == nil || usage[0].Remote.Credit.Cmp(&owedToB.Credit) != 0 {
+		t.Errorf("wrong federation usage: %+v", usage)
+	}
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/vipnode/vipnode/v2/jsonrpc2"
 	"github.com/vipnode/vipnode/v2/jsonrpc2/ws"
+	"github.com/vipnode/vipnode/v2/pool"
 )
 
 type wsHandler interface {
@@ -20,7 +25,62 @@ type server struct {
 	debugLog     bool
 	header       http.Header
 	onDisconnect func(remote jsonrpc2.Service) error
-	healthCheck  func(w io.Writer) error
+	// maxConcurrent is the per-connection limit of concurrent requests for
+	// websocket connections (optional).
+	maxConcurrent int
+	healthCheck   func(w io.Writer) error
+	metrics       *pool.Metrics
+
+	mu      sync.Mutex
+	remotes map[*jsonrpc2.Remote]struct{} // Connected websocket remotes
+}
+
+func (s *server) addRemote(remote *jsonrpc2.Remote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.remotes == nil {
+		s.remotes = map[*jsonrpc2.Remote]struct{}{}
+	}
+	s.remotes[remote] = struct{}{}
+	if s.metrics != nil {
+		s.metrics.WebsocketConnects.Inc()
+		s.metrics.WebsocketConnections.Set(float64(len(s.remotes)))
+	}
+}
+
+func (s *server) removeRemote(remote *jsonrpc2.Remote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.remotes, remote)
+	if s.metrics != nil {
+		s.metrics.WebsocketConnections.Set(float64(len(s.remotes)))
+	}
+}
+
+// shutdownRemotes sends a vipnode_shutdown notice to every connected
+// websocket remote and closes its connection, returning the number of
+// remotes. Each remote is asked to wait for the reconnect delay plus a random
+// share of the jitter, so that they don't all reconnect at once.
+func (s *server) shutdownRemotes(ctx context.Context, reconnectDelay time.Duration, jitter time.Duration) int {
+	s.mu.Lock()
+	remotes := make([]*jsonrpc2.Remote, 0, len(s.remotes))
+	for remote := range s.remotes {
+		remotes = append(remotes, remote)
+	}
+	s.mu.Unlock()
+
+	for _, remote := range remotes {
+		delay := reconnectDelay
+		if jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(jitter)))
+		}
+		notice := pool.ShutdownNotice{ReconnectDelay: int64(delay / time.Millisecond)}
+		if err := remote.Notify(ctx, "vipnode_shutdown", notice); err != nil {
+			logger.Debugf("Failed to send shutdown notice: %s", err)
+		}
+		remote.Codec.Close()
+	}
+	return len(remotes)
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -60,12 +120,13 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Server: &s.HTTPServer.Server,
 			Client: &jsonrpc2.Client{},
 
-			PendingLimit:   50,
-			PendingDiscard: 10,
+			MaxConcurrent: s.maxConcurrent,
 		}
+		s.addRemote(remote)
 		if err := remote.Serve(); err != nil && err != io.EOF {
 			logger.Warningf("jsonrpc2.Remote.Serve() error: %s", err)
 		}
+		s.removeRemote(remote)
 
 		if s.onDisconnect != nil {
 			if err := s.onDisconnect(remote); err != nil {